@@ -1,23 +1,35 @@
 // Command import-sqlite copies data from a legacy SQLite whoknows.db into
 // the configured Postgres database. It preserves primary keys and bumps
 // sequences afterwards. Safe to run multiple times (uses ON CONFLICT DO NOTHING).
+//
+// Page tags are imported from a comma-separated `tags` column on the legacy
+// pages table when present, and from an optional JSON sidecar file mapping
+// page titles to tag names:
+//
+//	{"Go (programming language)": ["programming", "go"]}
 package main
 
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "modernc.org/sqlite"
+
+	"whoknows_variations/server_go/internal/db"
 )
 
 func main() {
 	sqlitePath := flag.String("sqlite", "whoknows.db", "path to the legacy SQLite file")
+	tagsPath := flag.String("tags", "", "optional JSON file mapping page titles to tag names")
 	flag.Parse()
 
 	dsn := os.Getenv("DATABASE_URL")
@@ -45,6 +57,9 @@ func main() {
 	if err := importPages(ctx, src, dst); err != nil {
 		log.Fatalf("import pages: %v", err)
 	}
+	if err := importPageTags(ctx, src, dst, *tagsPath); err != nil {
+		log.Fatalf("import page tags: %v", err)
+	}
 	if err := resetUserSequence(ctx, dst); err != nil {
 		log.Fatalf("reset users sequence: %v", err)
 	}
@@ -144,6 +159,80 @@ func importPages(ctx context.Context, src *sql.DB, dst *pgxpool.Pool) error {
 	return nil
 }
 
+// importPageTags merges tags from the legacy `tags` column (if the column
+// exists) with those from the sidecar file (if given) and attaches them to
+// the imported pages. Tags for pages that don't exist are skipped.
+func importPageTags(ctx context.Context, src *sql.DB, dst *pgxpool.Pool, sidecarPath string) error {
+	pageTags := map[string][]string{}
+
+	var hasColumn bool
+	if err := src.QueryRowContext(ctx,
+		"SELECT COUNT(*) > 0 FROM pragma_table_info('pages') WHERE name = 'tags'",
+	).Scan(&hasColumn); err != nil {
+		return err
+	}
+	if hasColumn {
+		rows, err := src.QueryContext(ctx, "SELECT title, tags FROM pages WHERE tags IS NOT NULL AND tags != ''")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rows.Close() }()
+		for rows.Next() {
+			var title, tags string
+			if err := rows.Scan(&title, &tags); err != nil {
+				return err
+			}
+			pageTags[title] = append(pageTags[title], strings.Split(tags, ",")...)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	if sidecarPath != "" {
+		// #nosec G304 -- Path is an operator-supplied CLI flag.
+		data, err := os.ReadFile(sidecarPath)
+		if err != nil {
+			return err
+		}
+		var sidecar map[string][]string
+		if err := json.Unmarshal(data, &sidecar); err != nil {
+			return err
+		}
+		for title, tags := range sidecar {
+			pageTags[title] = append(pageTags[title], tags...)
+		}
+	}
+
+	if len(pageTags) == 0 {
+		log.Println("page tags: nothing to import")
+		return nil
+	}
+
+	count := 0
+	for title, tags := range pageTags {
+		for _, name := range tags {
+			if db.Slugify(name) == "" {
+				continue
+			}
+			tag, err := db.EnsureTag(ctx, dst, name)
+			if err != nil {
+				return err
+			}
+			if err := db.AddPageTag(ctx, dst, title, tag.ID); err != nil {
+				if errors.Is(err, db.ErrPageNotFound) {
+					log.Printf("page tags: skipping unknown page %q", title)
+					break
+				}
+				return err
+			}
+			count++
+		}
+	}
+	log.Printf("page tags: imported %d tag assignments", count)
+	return nil
+}
+
 // resetUserSequence bumps the users_id_seq so future inserts don't collide
 // with the ids we copied over.
 func resetUserSequence(ctx context.Context, dst *pgxpool.Pool) error {
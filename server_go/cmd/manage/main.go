@@ -0,0 +1,263 @@
+// Command manage runs one-off administrative tasks against the configured
+// Postgres database.
+//
+// Usage:
+//
+//	manage promote -username alice -role admin
+//	manage revoke-sessions -username alice
+//	manage unlock-login -username alice
+//	manage unlock-login -ip 203.0.113.7
+//	manage reset-2fa -username alice
+//	manage export -username alice -format zip -out alice.zip
+//	manage import-search-log -file searches.log
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/export"
+	"whoknows_variations/server_go/internal/searchlog"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, pool *pgxpool.Pool, args []string) error
+}
+
+var commands = []command{
+	{"promote", "set a user's role (user, editor or admin)", promote},
+	{"revoke-sessions", "log a user out on every device", revokeSessions},
+	{"unlock-login", "lift a login lockout for a username or IP", unlockLogin},
+	{"reset-2fa", "turn off two-factor login for a user who lost their device", resetTwoFactor},
+	{"export", "write everything stored about a user to a JSON or ZIP file", exportUser},
+	{"import-search-log", "load a searches.log file into the search analytics", importSearchLog},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == os.Args[1] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+
+	ctx := context.Background()
+	pool, err := db.Open(ctx, dsn)
+	if err != nil {
+		log.Fatalf("open postgres: %v", err)
+	}
+	defer pool.Close()
+
+	if err := cmd.run(ctx, pool, os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", cmd.name, err) // #nosec G706 -- Command name comes from the fixed commands table.
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: manage <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", c.name, c.usage)
+	}
+}
+
+// lookupUser resolves the -username flag shared by most commands.
+func lookupUser(ctx context.Context, pool *pgxpool.Pool, username string) (*db.UserRow, error) {
+	if username == "" {
+		return nil, fmt.Errorf("-username is required")
+	}
+	return db.GetUserByUsername(ctx, pool, username)
+}
+
+func promote(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("promote", flag.ExitOnError)
+	username := fs.String("username", "", "user to promote")
+	role := fs.String("role", db.RoleAdmin, "role to give: "+strings.Join(db.Roles, ", "))
+	_ = fs.Parse(args)
+
+	u, err := lookupUser(ctx, pool, *username)
+	if err != nil {
+		return err
+	}
+	if err := db.SetUserRole(ctx, pool, u.ID, *role); err != nil {
+		return err
+	}
+	log.Printf("%s is now %s (was %s)", u.Username, *role, u.Role) // #nosec G706 -- Username is read back from our own database; role was validated.
+	return nil
+}
+
+func revokeSessions(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("revoke-sessions", flag.ExitOnError)
+	username := fs.String("username", "", "user whose sessions to revoke")
+	_ = fs.Parse(args)
+
+	u, err := lookupUser(ctx, pool, *username)
+	if err != nil {
+		return err
+	}
+	n, err := db.DeleteUserSessions(ctx, pool, u.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("revoked %d sessions for %s", n, u.Username) // #nosec G706 -- Username is read back from our own database.
+	return nil
+}
+
+func unlockLogin(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("unlock-login", flag.ExitOnError)
+	username := fs.String("username", "", "username to unlock")
+	ip := fs.String("ip", "", "client IP to unlock")
+	_ = fs.Parse(args)
+
+	scope, key := db.ThrottleScopeAccount, strings.ToLower(strings.TrimSpace(*username))
+	if *ip != "" {
+		scope, key = db.ThrottleScopeIP, strings.TrimSpace(*ip)
+	}
+	if key == "" {
+		return fmt.Errorf("-username or -ip is required")
+	}
+
+	cleared, err := db.ClearLoginFailures(ctx, pool, scope, key)
+	if err != nil {
+		return err
+	}
+	if !cleared {
+		log.Printf("%s %s had no recorded failures", scope, key) // #nosec G706 -- Operator-supplied CLI flag.
+		return nil
+	}
+	e := db.AuthEventRow{Type: db.EventLoginUnlock, Detail: "by manage unlock-login"}
+	if scope == db.ThrottleScopeIP {
+		e.Detail = "ip " + key + " " + e.Detail
+	} else {
+		e.Username = key
+	}
+	if err := db.RecordAuthEvent(ctx, pool, e); err != nil {
+		log.Printf("record unlock auth event failed: %v", err)
+	}
+	log.Printf("unlocked %s %s", scope, key) // #nosec G706 -- Operator-supplied CLI flag.
+	return nil
+}
+
+func resetTwoFactor(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("reset-2fa", flag.ExitOnError)
+	username := fs.String("username", "", "user whose two-factor login to turn off")
+	_ = fs.Parse(args)
+
+	u, err := lookupUser(ctx, pool, *username)
+	if err != nil {
+		return err
+	}
+	if err := db.DisableTOTP(ctx, pool, u.ID); err != nil {
+		return err
+	}
+	log.Printf("two-factor login is off for %s", u.Username) // #nosec G706 -- Username is read back from our own database.
+	return nil
+}
+
+func exportUser(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	username := fs.String("username", "", "user whose data to export")
+	format := fs.String("format", "json", "json or zip")
+	out := fs.String("out", "", "file to write (default stdout)")
+	_ = fs.Parse(args)
+
+	if *format != "json" && *format != "zip" {
+		return fmt.Errorf("-format must be json or zip")
+	}
+	u, err := lookupUser(ctx, pool, *username)
+	if err != nil {
+		return err
+	}
+	archive, err := export.Default.Collect(ctx, pool, u.ID)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		// #nosec G304 -- Operator-supplied CLI flag.
+		f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	}
+	if *format == "zip" {
+		err = archive.WriteZip(w)
+	} else {
+		err = archive.WriteJSON(w)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("exported %d sections for %s", len(archive.Sections), u.Username) // #nosec G706 -- Username is read back from our own database.
+	return nil
+}
+
+func importSearchLog(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	fs := flag.NewFlagSet("import-search-log", flag.ExitOnError)
+	file := fs.String("file", "searches.log", "search log to import")
+	_ = fs.Parse(args)
+
+	// #nosec G304 -- Operator-supplied CLI flag.
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	// Redact and hash like the server does, so old plaintext logs don't
+	// bypass its privacy settings.
+	redact := os.Getenv("WHOKNOWS_SEARCH_LOG_REDACT")
+	if redact == "" {
+		redact = searchlog.DefaultRedact
+	}
+	privacy, err := searchlog.ParsePrivacy(redact, os.Getenv("WHOKNOWS_SEARCH_LOG_REDACT_PATTERN"), os.Getenv("WHOKNOWS_SEARCH_LOG_HASH_KEY"))
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	err = searchlog.Decode(f, func(e searchlog.Entry) error {
+		if e.Query != "" {
+			e = privacy.Apply(e)
+		}
+		n++
+		return db.RecordSearchLog(ctx, pool, db.SearchLogRow{
+			SearchedAt:  e.Time,
+			Query:       e.Query,
+			QueryHash:   e.QueryHash,
+			Language:    e.Language,
+			ResultCount: e.ResultCount,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("imported %d searches from %s", n, *file) // #nosec G706 -- Operator-supplied CLI flag.
+	return nil
+}
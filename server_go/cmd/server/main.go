@@ -3,19 +3,31 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/sessions"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
 
 	_ "whoknows_variations/server_go/docs"
+	"whoknows_variations/server_go/internal/alerts"
+	"whoknows_variations/server_go/internal/auth"
 	"whoknows_variations/server_go/internal/db"
 	"whoknows_variations/server_go/internal/httpapi"
+	"whoknows_variations/server_go/internal/mail"
+	"whoknows_variations/server_go/internal/metrics"
+	"whoknows_variations/server_go/internal/oidc"
+	"whoknows_variations/server_go/internal/searchlog"
+	"whoknows_variations/server_go/internal/sessionstore"
 )
 
 // @title WhoKnows API
@@ -24,7 +36,9 @@ import (
 // @host huw.dk
 // @BasePath /
 func main() {
-	ctx := context.Background()
+	// SIGTERM comes from docker stop during a blue/green deploy.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" {
@@ -39,21 +53,117 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer pool.Close()
 
-	secretKey := os.Getenv("WHOKNOWS_SECRET_KEY")
-	if secretKey == "" {
-		secretKey = "default-secret-change-me"
+	go trackLegacyPasswordHashes(ctx, pool, 5*time.Minute)
+
+	retentionDays := 90
+	if v := os.Getenv("WHOKNOWS_AUTH_EVENT_RETENTION_DAYS"); v != "" {
+		retentionDays, err = strconv.Atoi(v)
+		if err != nil || retentionDays < 0 {
+			log.Fatalf("WHOKNOWS_AUTH_EVENT_RETENTION_DAYS must be a number of days, got %q", sanitizeLogValue(v)) // #nosec G706 -- Value is newline-sanitized before logging; source is deployment configuration.
+		}
+	}
+	if retentionDays > 0 {
+		go pruneAuthEvents(ctx, pool, time.Duration(retentionDays)*24*time.Hour, time.Hour)
 	}
-	store := sessions.NewCookieStore([]byte(secretKey))
 
-	s := &httpapi.Server{DB: pool, Sessions: store}
-	router := httpapi.NewRouter(s)
+	devMode := os.Getenv("WHOKNOWS_DEV_MODE") == "true"
+	keys, err := loadSessionKeys(devMode)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	port := os.Getenv("WHOKNOWS_PORT")
 	if port == "" {
 		port = "8080"
 	}
+	baseURL := strings.TrimSuffix(os.Getenv("WHOKNOWS_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+	// Browsers drop Secure cookies over plain HTTP, so only set the flag
+	// when the site is served over HTTPS.
+	secureCookies := strings.HasPrefix(baseURL, "https://")
+
+	store := sessionstore.New(pool, keys.Pairs()...)
+	store.Options.Secure = secureCookies
+	go store.Sweep(ctx, 15*time.Minute)
+
+	verification, err := httpapi.ParseEmailVerificationPolicy(os.Getenv("WHOKNOWS_EMAIL_VERIFICATION"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	twoFactorRole, err := httpapi.ParseTwoFactorPolicy(os.Getenv("WHOKNOWS_2FA_REQUIRED_ROLE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	provider, err := newOIDCProvider(ctx, baseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mailer := newMailer()
+
+	alertEvery := time.Hour
+	if v := os.Getenv("WHOKNOWS_SAVED_SEARCH_INTERVAL"); v != "" {
+		alertEvery, err = time.ParseDuration(v)
+		if err != nil || alertEvery < 0 {
+			log.Fatalf("WHOKNOWS_SAVED_SEARCH_INTERVAL must be a duration such as 1h, got %q", sanitizeLogValue(v)) // #nosec G706 -- Value is newline-sanitized before logging; source is deployment configuration.
+		}
+	}
+	if alertEvery > 0 {
+		checker := &alerts.Checker{
+			DB: pool,
+			Notifiers: map[string]alerts.Notifier{
+				db.NotifyEmail: &alerts.MailNotifier{Mailer: mailer},
+				// Webhooks may only reach private addresses in dev mode.
+				db.NotifyWebhook: alerts.NewWebhookNotifier(devMode),
+			},
+			BaseURL: baseURL,
+			Every:   alertEvery,
+		}
+		go checker.Run(ctx, time.Minute)
+	}
+
+	searchLogRetentionDays := 90
+	if v := os.Getenv("WHOKNOWS_SEARCH_LOG_RETENTION_DAYS"); v != "" {
+		searchLogRetentionDays, err = strconv.Atoi(v)
+		if err != nil || searchLogRetentionDays < 0 {
+			log.Fatalf("WHOKNOWS_SEARCH_LOG_RETENTION_DAYS must be a number of days, got %q", sanitizeLogValue(v)) // #nosec G706 -- Value is newline-sanitized before logging; source is deployment configuration.
+		}
+	}
+	searchLogRetention := time.Duration(searchLogRetentionDays) * 24 * time.Hour
+
+	searchLog, err := newSearchLog(pool, searchLogRetention)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go reopenSearchLogOnHUP(searchLog)
+	if searchLogRetention > 0 {
+		go purgeSearchLog(ctx, searchLog, searchLogRetention, time.Hour)
+	}
+
+	s := &httpapi.Server{
+		DB:                    pool,
+		Sessions:              store,
+		Mailer:                mailer,
+		SearchLog:             searchLog,
+		BaseURL:               baseURL,
+		SecureCookies:         secureCookies,
+		SigningKeys:           keys.Signing,
+		EmailVerification:     verification,
+		TrustProxy:            os.Getenv("WHOKNOWS_TRUST_PROXY") == "true",
+		TwoFactorRequiredRole: twoFactorRole,
+		AllowGetLogout:        os.Getenv("WHOKNOWS_ALLOW_GET_LOGOUT") == "true",
+		OIDC:                  provider,
+		OIDCName:              os.Getenv("WHOKNOWS_OIDC_NAME"),
+		OIDCAutoProvision:     os.Getenv("WHOKNOWS_OIDC_AUTO_PROVISION") == "true",
+	}
+	go s.SweepLoginThrottles(ctx, 15*time.Minute)
+	router := httpapi.NewRouter(s)
+
 	addr := os.Getenv("WHOKNOWS_ADDR")
 	if addr == "" {
 		addr = "0.0.0.0"
@@ -69,7 +179,53 @@ func main() {
 		IdleTimeout:       60 * time.Second,
 	}
 
-	log.Fatal(srv.ListenAndServe())
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Print("shutting down")
+
+	// Finish the requests in flight, then write the searches they queued
+	// before the pool the Postgres sink needs goes away. docker stop waits
+	// 10 seconds before it kills the container.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("http shutdown failed: %v", err)
+	}
+	if err := searchLog.Close(); err != nil {
+		log.Printf("close search log failed: %v", err)
+	}
+	pool.Close()
+}
+
+// loadSessionKeys reads the cookie keys from WHOKNOWS_SECRET_KEYS, or the
+// older single WHOKNOWS_SECRET_KEY, and WHOKNOWS_ENCRYPTION_KEYS. Without
+// keys, or with the default secret, it only succeeds in dev mode.
+func loadSessionKeys(devMode bool) (sessionstore.Keys, error) {
+	signing := os.Getenv("WHOKNOWS_SECRET_KEYS")
+	if signing == "" {
+		signing = os.Getenv("WHOKNOWS_SECRET_KEY")
+	}
+	if signing == "" {
+		signing = sessionstore.InsecureDefaultSecret
+	}
+
+	keys, err := sessionstore.ParseKeys(signing, os.Getenv("WHOKNOWS_ENCRYPTION_KEYS"))
+	if err != nil {
+		return sessionstore.Keys{}, fmt.Errorf("invalid session keys: %w", err)
+	}
+	if keys.UsesDefault() {
+		if !devMode {
+			return sessionstore.Keys{}, errors.New("refusing to start with the default session secret: set WHOKNOWS_SECRET_KEYS, or WHOKNOWS_DEV_MODE=true for local development")
+		}
+		log.Print("WARNING: using the default session secret, which is only fit for development")
+	}
+	return keys, nil
 }
 
 func runMigrations(dsn string) error {
@@ -95,6 +251,267 @@ func runMigrations(dsn string) error {
 	return goose.Up(sqlDB, migrationsDir)
 }
 
+// newOIDCProvider discovers the single sign-on provider configured with
+// WHOKNOWS_OIDC_ISSUER, WHOKNOWS_OIDC_CLIENT_ID and
+// WHOKNOWS_OIDC_CLIENT_SECRET. It returns nil when no issuer is set.
+func newOIDCProvider(ctx context.Context, baseURL string) (*oidc.Provider, error) {
+	issuer := os.Getenv("WHOKNOWS_OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	redirectURL := os.Getenv("WHOKNOWS_OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = baseURL + "/login/oidc/callback"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	return oidc.Discover(ctx, oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("WHOKNOWS_OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("WHOKNOWS_OIDC_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
+	})
+}
+
+// newMailer picks the mail backend from WHOKNOWS_MAIL_BACKEND: "smtp",
+// "file" (.eml files in WHOKNOWS_MAIL_DIR, default "./mail") or "log". When
+// unset it uses SMTP if WHOKNOWS_SMTP_ADDR is configured and files otherwise.
+func newMailer() mail.Mailer {
+	from := os.Getenv("WHOKNOWS_MAIL_FROM")
+	if from == "" {
+		from = "WhoKnows <noreply@localhost>"
+	}
+
+	backend := os.Getenv("WHOKNOWS_MAIL_BACKEND")
+	if backend == "" {
+		backend = "file"
+		if os.Getenv("WHOKNOWS_SMTP_ADDR") != "" {
+			backend = "smtp"
+		}
+	}
+
+	switch backend {
+	case "smtp":
+		return &mail.SMTPMailer{
+			Addr:     os.Getenv("WHOKNOWS_SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("WHOKNOWS_SMTP_USERNAME"),
+			Password: os.Getenv("WHOKNOWS_SMTP_PASSWORD"),
+		}
+	case "log":
+		return mail.LogMailer{}
+	case "file":
+		dir := os.Getenv("WHOKNOWS_MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		log.Printf("writing mail to %s", sanitizeLogValue(dir)) // #nosec G706 -- Value is newline-sanitized before logging; source is deployment configuration.
+		return &mail.FileMailer{Dir: dir, From: from}
+	default:
+		log.Fatalf("unknown WHOKNOWS_MAIL_BACKEND %q (want smtp, file or log)", sanitizeLogValue(backend)) // #nosec G706 -- Value is newline-sanitized before logging; source is deployment configuration.
+		return nil
+	}
+}
+
+// newSearchLog sets up the search log sinks named in the comma-separated
+// WHOKNOWS_SEARCH_LOG_SINKS: "file" (JSONL at WHOKNOWS_SEARCH_LOG_PATH,
+// default "searches.log"), "postgres" (the search_log table behind the admin
+// analytics), "stdout" and "syslog". The default is "file,postgres"; "none"
+// turns search logging off. WHOKNOWS_SEARCH_LOG_QUEUE sizes the queue.
+//
+// Queries are redacted by the rules in WHOKNOWS_SEARCH_LOG_REDACT (default
+// "email,phone,digits") and WHOKNOWS_SEARCH_LOG_REDACT_PATTERN, and logged
+// only as a keyed hash when WHOKNOWS_SEARCH_LOG_HASH_KEY is set. With a
+// retention, the file is rotated at least daily so it can be purged.
+func newSearchLog(pool *pgxpool.Pool, retention time.Duration) (*searchlog.Logger, error) {
+	privacy, err := searchLogPrivacy()
+	if err != nil {
+		return nil, err
+	}
+
+	spec := os.Getenv("WHOKNOWS_SEARCH_LOG_SINKS")
+	if spec == "" {
+		spec = "file,postgres"
+	}
+
+	var sinks []searchlog.Sink
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "none", "":
+		case "file":
+			path := os.Getenv("WHOKNOWS_SEARCH_LOG_PATH")
+			if path == "" {
+				path = "searches.log"
+			}
+			opts, err := searchLogFileOptions()
+			if err != nil {
+				return nil, err
+			}
+			if retention > 0 && (opts.RotateEvery == 0 || opts.RotateEvery > 24*time.Hour) {
+				opts.RotateEvery = 24 * time.Hour
+			}
+			sink, err := searchlog.NewFileSink(path, opts)
+			if err != nil {
+				return nil, fmt.Errorf("open search log: %w", err)
+			}
+			sinks = append(sinks, sink)
+		case "postgres":
+			sinks = append(sinks, searchlog.PostgresSink{DB: pool})
+		case "stdout":
+			sinks = append(sinks, searchlog.WriterSink{W: os.Stdout})
+		case "syslog":
+			sink, err := searchlog.NewSyslogSink("whoknows-search")
+			if err != nil {
+				return nil, fmt.Errorf("connect to syslog: %w", err)
+			}
+			sinks = append(sinks, sink)
+		default:
+			return nil, fmt.Errorf("unknown search log sink %q in WHOKNOWS_SEARCH_LOG_SINKS (want file, postgres, stdout, syslog or none)", sanitizeLogValue(name))
+		}
+	}
+
+	queueSize := searchlog.DefaultQueueSize
+	if v := os.Getenv("WHOKNOWS_SEARCH_LOG_QUEUE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("WHOKNOWS_SEARCH_LOG_QUEUE must be a positive number, got %q", sanitizeLogValue(v))
+		}
+		queueSize = n
+	}
+	return searchlog.New(searchlog.Options{QueueSize: queueSize, Privacy: privacy}, sinks...), nil
+}
+
+// searchLogPrivacy reads the search log's redaction rules and hash key.
+// The manage command applies the same settings to imported logs.
+func searchLogPrivacy() (searchlog.Privacy, error) {
+	redact := os.Getenv("WHOKNOWS_SEARCH_LOG_REDACT")
+	if redact == "" {
+		redact = searchlog.DefaultRedact
+	}
+	p, err := searchlog.ParsePrivacy(redact, os.Getenv("WHOKNOWS_SEARCH_LOG_REDACT_PATTERN"), os.Getenv("WHOKNOWS_SEARCH_LOG_HASH_KEY"))
+	if err != nil {
+		return p, fmt.Errorf("WHOKNOWS_SEARCH_LOG_REDACT: %w", err)
+	}
+	return p, nil
+}
+
+// searchLogFileOptions reads the search log file's rotation settings:
+// WHOKNOWS_SEARCH_LOG_MAX_SIZE_MB (default 100), WHOKNOWS_SEARCH_LOG_ROTATE
+// (a duration such as 24h), WHOKNOWS_SEARCH_LOG_COMPRESS (default true),
+// WHOKNOWS_SEARCH_LOG_MAX_BACKUPS (default 10) and
+// WHOKNOWS_SEARCH_LOG_MAX_AGE_DAYS. 0 turns a limit off.
+func searchLogFileOptions() (searchlog.FileOptions, error) {
+	opts := searchlog.FileOptions{Compress: os.Getenv("WHOKNOWS_SEARCH_LOG_COMPRESS") != "false"}
+
+	number := func(name string, def int) (int, error) {
+		v := os.Getenv(name)
+		if v == "" {
+			return def, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%s must be a number, got %q", name, sanitizeLogValue(v))
+		}
+		return n, nil
+	}
+	maxSizeMB, err := number("WHOKNOWS_SEARCH_LOG_MAX_SIZE_MB", 100)
+	if err != nil {
+		return opts, err
+	}
+	opts.MaxSize = int64(maxSizeMB) << 20
+	if opts.MaxBackups, err = number("WHOKNOWS_SEARCH_LOG_MAX_BACKUPS", 10); err != nil {
+		return opts, err
+	}
+	maxAgeDays, err := number("WHOKNOWS_SEARCH_LOG_MAX_AGE_DAYS", 0)
+	if err != nil {
+		return opts, err
+	}
+	opts.MaxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+
+	if v := os.Getenv("WHOKNOWS_SEARCH_LOG_ROTATE"); v != "" {
+		opts.RotateEvery, err = time.ParseDuration(v)
+		if err != nil || opts.RotateEvery < 0 {
+			return opts, fmt.Errorf("WHOKNOWS_SEARCH_LOG_ROTATE must be a duration such as 24h, got %q", sanitizeLogValue(v))
+		}
+	}
+	return opts, nil
+}
+
+// reopenSearchLogOnHUP reopens the search log file on SIGHUP, so an
+// external logrotate can move it away and signal the server.
+func reopenSearchLogOnHUP(searchLog *searchlog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := searchLog.Reopen(); err != nil {
+			log.Printf("reopen search log failed: %v", err)
+		} else {
+			log.Print("reopened search log")
+		}
+	}
+}
+
+// trackLegacyPasswordHashes keeps the legacy hash gauge in line with the
+// database, including rehashes done by the other blue/green container.
+func trackLegacyPasswordHashes(ctx context.Context, pool *pgxpool.Pool, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		n, err := db.CountLegacyPasswordHashes(ctx, pool, auth.Argon2idPrefix)
+		if err != nil {
+			log.Printf("count legacy password hashes failed: %v", err)
+		} else {
+			metrics.SetLegacyPasswordHashes(n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneAuthEvents deletes audit log events older than retention every
+// interval. Like the session sweep it's safe to run in both containers.
+func pruneAuthEvents(ctx context.Context, pool *pgxpool.Pool, retention, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		n, err := db.DeleteAuthEventsBefore(ctx, pool, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("prune auth events failed: %v", err)
+		} else if n > 0 {
+			log.Printf("pruned %d auth events older than %s", n, retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeSearchLog deletes logged searches older than retention every
+// interval, from the search_log table and the rotated log files.
+func purgeSearchLog(ctx context.Context, searchLog *searchlog.Logger, retention, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if err := searchLog.Purge(time.Now().Add(-retention)); err != nil {
+			log.Printf("purge search log failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func sanitizeLogValue(value string) string {
 	value = strings.ReplaceAll(value, "\r", "")
 	return strings.ReplaceAll(value, "\n", "")
@@ -0,0 +1,148 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"whoknows_variations/server_go/internal/mail"
+)
+
+func TestNewMatches(t *testing.T) {
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := old.Add(24 * time.Hour)
+	results := []map[string]any{
+		{"title": "Unchanged", "url": "/a", "last_updated": old.Format(time.RFC3339)},
+		{"title": "Updated", "url": "/b", "last_updated": newer.Format(time.RFC3339)},
+		{"title": "New", "url": "/c", "last_updated": nil},
+		{"title": "No date", "url": "/d", "last_updated": nil},
+	}
+	seen := map[string]*time.Time{
+		"Unchanged": &old,
+		"Updated":   &old,
+		"No date":   nil,
+	}
+
+	got := newMatches(results, seen)
+	if len(got) != 2 || got[0].Title != "Updated" || got[1].Title != "New" {
+		t.Fatalf("expected [Updated New], got %+v", got)
+	}
+	if got[0].LastUpdated == nil || !got[0].LastUpdated.Equal(newer) {
+		t.Errorf("expected the new last_updated, got %v", got[0].LastUpdated)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	if got := SearchPath("go & rust", ""); got != "/?q=go+%26+rust" {
+		t.Errorf("got %q", got)
+	}
+	if got := SearchPath("go", "da"); got != "/?language=da&q=go" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func testNotification(webhookURL string) Notification {
+	return Notification{
+		Username:   "alice",
+		Email:      "alice@example.com",
+		WebhookURL: webhookURL,
+		Query:      "go\nlang",
+		SearchURL:  "https://huw.dk/?q=go",
+		ManageURL:  "https://huw.dk/saved-searches",
+		Pages:      []Page{{Title: "Go Programming", URL: "https://go.dev"}},
+	}
+}
+
+func TestMailNotifier(t *testing.T) {
+	m := &mail.MemoryMailer{}
+	if err := (&MailNotifier{Mailer: m}).Notify(context.Background(), testNotification("")); err != nil {
+		t.Fatal(err)
+	}
+	sent := m.Sent()
+	if len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Fatalf("expected one message to alice, got %+v", sent)
+	}
+	if strings.ContainsAny(sent[0].Subject, "\r\n") {
+		t.Errorf("subject contains a line break: %q", sent[0].Subject)
+	}
+	if !strings.Contains(sent[0].Body, "Go Programming") || !strings.Contains(sent[0].Body, "https://huw.dk/?q=go") {
+		t.Errorf("body is missing the page or search link:\n%s", sent[0].Body)
+	}
+}
+
+func TestWebhookNotifier_PostsJSON(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected Content-Type %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhookNotifier(true).Notify(context.Background(), testNotification(srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Event != webhookEvent || len(got.Pages) != 1 || got.Pages[0].Title != "Go Programming" {
+		t.Errorf("unexpected payload %+v", got)
+	}
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhookNotifier(true).Notify(context.Background(), testNotification(srv.URL)); err == nil {
+		t.Fatal("expected an error for a 500 answer")
+	}
+}
+
+func TestWebhookNotifier_RefusesPrivateAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	err := NewWebhookNotifier(false).Notify(context.Background(), testNotification(srv.URL))
+	if !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("expected errPrivateAddress, got %v", err)
+	}
+	if called {
+		t.Error("expected the loopback webhook not to be called")
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946", "1.1.1.1"} {
+		if !isPublic(net.ParseIP(addr)) {
+			t.Errorf("expected %s to be public", addr)
+		}
+	}
+	for _, addr := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "::1", "fe80::1",
+		"0.0.0.0", "0.1.2.3",
+		"100.64.0.1", "100.127.255.254",
+		"192.0.0.8",
+		"198.18.0.1", "198.19.255.254",
+		"240.0.0.1", "255.255.255.255",
+		"fc00::1", "fd12:3456:789a::1",
+		"64:ff9b::a00:1", "64:ff9b::7f00:1", "64:ff9b:1::1",
+		"::ffff:100.64.0.1", "::ffff:10.0.0.1",
+	} {
+		if isPublic(net.ParseIP(addr)) {
+			t.Errorf("expected %s to be refused", addr)
+		}
+	}
+}
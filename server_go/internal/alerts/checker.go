@@ -0,0 +1,202 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+// claimBatch is how many saved searches a server claims at a time.
+const claimBatch = 100
+
+// Checker re-runs saved searches through the normal search and reports
+// pages that are new or were updated since the last run. The first run of
+// a saved search only records what already matches.
+type Checker struct {
+	DB *pgxpool.Pool
+	// Notifiers deliver alerts by the saved search's notify setting
+	// (db.NotifyEmail, db.NotifyWebhook). Settings without a notifier only
+	// get the in-app notification.
+	Notifiers map[string]Notifier
+	// BaseURL is the public origin used in links, e.g. "https://huw.dk".
+	BaseURL string
+	// Every is how often each saved search is re-run.
+	Every time.Duration
+}
+
+// Run checks for due saved searches every tick until ctx is done. Like the
+// session sweep it's safe to run in both containers.
+func (c *Checker) Run(ctx context.Context, tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		if n, err := c.RunOnce(ctx); err != nil {
+			log.Printf("saved search check failed: %v", err)
+		} else if n > 0 {
+			log.Printf("sent %d saved search alerts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce checks every saved search that is due and returns how many
+// alerts it raised. A failing saved search is logged and retried on its
+// next turn.
+func (c *Checker) RunOnce(ctx context.Context) (int, error) {
+	alerts := 0
+	for {
+		due, err := db.ClaimDueSavedSearches(ctx, c.DB, time.Now().Add(-c.Every), claimBatch)
+		if err != nil {
+			return alerts, err
+		}
+		for _, s := range due {
+			raised, err := c.check(ctx, s)
+			if err != nil {
+				log.Printf("check saved search %d failed: %v", s.ID, err)
+				continue
+			}
+			if raised {
+				alerts++
+			}
+		}
+		if len(due) < claimBatch {
+			return alerts, nil
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context, s db.SavedSearchRow) (bool, error) {
+	params := db.SearchParams{Query: s.Query}
+	if s.Language != "" {
+		params.Language = &s.Language
+	}
+	results, err := db.Search(ctx, c.DB, params)
+	if err != nil {
+		return false, err
+	}
+	seen, err := db.SeenPages(ctx, c.DB, s.ID)
+	if err != nil {
+		return false, err
+	}
+
+	pages := newMatches(results, seen)
+	if len(pages) == 0 {
+		return false, nil
+	}
+	raised := s.LastCheckedAt != nil
+	if raised {
+		if err := c.notify(ctx, s, pages); err != nil {
+			return false, err
+		}
+	}
+
+	marked := make([]db.SeenPage, len(pages))
+	for i, p := range pages {
+		marked[i] = db.SeenPage{Title: p.Title, LastUpdated: p.LastUpdated}
+	}
+	return raised, db.MarkPagesSeen(ctx, c.DB, s.ID, marked)
+}
+
+// notify records the in-app notification and hands the alert to the saved
+// search's notifier. A failed delivery is only logged: the alert is still
+// in the app, and retrying would repeat it there.
+func (c *Checker) notify(ctx context.Context, s db.SavedSearchRow, pages []Page) error {
+	u, err := db.GetUserByID(ctx, c.DB, s.UserID)
+	if err != nil {
+		return err
+	}
+
+	searchPath := SearchPath(s.Query, s.Language)
+	title := fmt.Sprintf("%d new results for %q", len(pages), s.Query)
+	if len(pages) == 1 {
+		title = fmt.Sprintf("1 new result for %q", s.Query)
+	}
+	titles := make([]string, len(pages))
+	for i, p := range pages {
+		titles[i] = p.Title
+	}
+	id := s.ID
+	if _, err := db.CreateNotification(ctx, c.DB, db.NotificationRow{
+		UserID:        s.UserID,
+		SavedSearchID: &id,
+		Title:         title,
+		Body:          strings.Join(titles, "\n"),
+		URL:           searchPath,
+	}); err != nil {
+		return err
+	}
+
+	notifier := c.Notifiers[s.Notify]
+	if notifier == nil {
+		return nil
+	}
+	if s.Notify == db.NotifyEmail && u.EmailVerifiedAt == nil {
+		// Don't send alerts to an address the user hasn't proven is theirs.
+		return nil
+	}
+	err = notifier.Notify(ctx, Notification{
+		SavedSearchID: s.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		WebhookURL:    s.WebhookURL,
+		Query:         s.Query,
+		Language:      s.Language,
+		SearchURL:     c.BaseURL + searchPath,
+		ManageURL:     c.BaseURL + "/saved-searches",
+		Pages:         pages,
+	})
+	if err != nil {
+		log.Printf("deliver %s alert for saved search %d failed: %v", s.Notify, s.ID, err)
+	}
+	return nil
+}
+
+// SearchPath is the search page link for a query and language filter.
+func SearchPath(query, language string) string {
+	v := url.Values{"q": {query}}
+	if language != "" {
+		v.Set("language", language)
+	}
+	return "/?" + v.Encode()
+}
+
+// newMatches returns the search results that aren't in seen, or whose
+// last_updated is newer than the version seen.
+func newMatches(results []map[string]any, seen map[string]*time.Time) []Page {
+	var out []Page
+	for _, r := range results {
+		title, _ := r["title"].(string)
+		if title == "" {
+			continue
+		}
+		link, _ := r["url"].(string)
+		var updated *time.Time
+		if v, ok := r["last_updated"].(string); ok {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				updated = &t
+			}
+		}
+
+		prev, known := seen[title]
+		switch {
+		case !known:
+		case updated != nil && (prev == nil || updated.After(*prev)):
+		default:
+			continue
+		}
+		out = append(out, Page{Title: title, URL: link, LastUpdated: updated})
+	}
+	return out
+}
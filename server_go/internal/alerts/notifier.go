@@ -0,0 +1,207 @@
+// Package alerts re-runs saved searches on a schedule and tells their
+// owners about new and updated matches, in the app and through a Notifier
+// such as email or a webhook.
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"whoknows_variations/server_go/internal/mail"
+)
+
+// Page is a search result a saved search hasn't reported before.
+type Page struct {
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	LastUpdated *time.Time `json:"last_updated"`
+}
+
+// Notification is one alert about a saved search's new matches.
+type Notification struct {
+	SavedSearchID int64
+	Username      string
+	Email         string
+	WebhookURL    string
+	Query         string
+	Language      string
+	// SearchURL and ManageURL are absolute links to the search results and
+	// to the user's saved searches.
+	SearchURL string
+	ManageURL string
+	Pages     []Page
+}
+
+// Notifier delivers a Notification outside the app.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// MailNotifier emails the alert to the user.
+type MailNotifier struct {
+	Mailer mail.Mailer
+}
+
+func (m *MailNotifier) Notify(ctx context.Context, n Notification) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\n", n.Username)
+	fmt.Fprintf(&b, "These pages are new or updated for your saved search %q:\n\n", n.Query)
+	for _, p := range n.Pages {
+		fmt.Fprintf(&b, "- %s\n  %s\n", p.Title, p.URL)
+	}
+	fmt.Fprintf(&b, "\nSee all results: %s\n", n.SearchURL)
+	fmt.Fprintf(&b, "Manage your saved searches: %s\n", n.ManageURL)
+
+	return m.Mailer.Send(ctx, mail.Message{
+		To:      n.Email,
+		Subject: "New results for " + strings.Join(strings.Fields(n.Query), " "),
+		Body:    b.String(),
+	})
+}
+
+// webhookPayload is the JSON body posted to webhooks.
+type webhookPayload struct {
+	Event     string    `json:"event"`
+	Query     string    `json:"query"`
+	Language  string    `json:"language"`
+	SearchURL string    `json:"search_url"`
+	Pages     []Page    `json:"pages"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+const webhookEvent = "saved_search.new_matches"
+
+// WebhookNotifier posts the alert as JSON to the saved search's webhook
+// URL. Any 2xx answer counts as delivered.
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// NewWebhookNotifier returns a WebhookNotifier whose client doesn't follow
+// redirects and, unless allowPrivate is set, refuses to connect to
+// loopback, private, link-local and other non-public addresses, so a user's
+// webhook URL can't reach services inside our network.
+func NewWebhookNotifier(allowPrivate bool) *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+	return &WebhookNotifier{Client: &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+}
+
+// deniedNetworks are ranges webhooks may not reach on top of what the
+// net.IP methods in isPublic catch: "this network", carrier-grade NAT,
+// IETF protocol assignments, benchmarking, reserved space, unique local
+// IPv6 and the NAT64 prefixes, which can translate to private IPv4
+// addresses.
+var deniedNetworks = func() []*net.IPNet {
+	var out []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10",
+		"192.0.0.0/24",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"fc00::/7",
+		"64:ff9b::/96",
+		"64:ff9b:1::/48",
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, n)
+	}
+	return out
+}()
+
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range deniedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func (wh *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:     webhookEvent,
+		Query:     n.Query,
+		Language:  n.Language,
+		SearchURL: n.SearchURL,
+		Pages:     n.Pages,
+		SentAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "WhoKnows-Alerts/1.0")
+
+	resp, err := wh.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// MemoryNotifier keeps notifications in memory. Meant for tests.
+type MemoryNotifier struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (m *MemoryNotifier) Notify(_ context.Context, n Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, n)
+	return nil
+}
+
+// Sent returns a copy of the notifications delivered so far.
+func (m *MemoryNotifier) Sent() []Notification {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Notification(nil), m.sent...)
+}
@@ -2,18 +2,120 @@ package auth
 
 import (
 	"crypto/md5" // #nosec G501 -- Required for legacy database compatibility; hashes must match existing stored MD5 values.
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 )
 
-// HashPassword produces an MD5 hex digest identical to Python's
-// hashlib.md5(password.encode('utf-8')).hexdigest(), keeping
-// backwards-compatibility with the legacy database.
+// Argon2idPrefix marks hashes in the PHC string format produced by
+// HashPassword, e.g. "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>".
+// Anything without it is treated as a legacy MD5 hex digest.
+const Argon2idPrefix = "$argon2id$"
+
+// Argon2id parameters, following the OWASP minimum recommendation. Memory is
+// kept low because blue and green share a 1GB droplet.
+const (
+	argon2Memory  = 19 * 1024 // KiB
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var b64 = base64.RawStdEncoding
+
+// HashPassword hashes a password with argon2id and a random salt.
 func HashPassword(password string) string {
+	salt := make([]byte, argon2SaltLen)
+	_, _ = rand.Read(salt)
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		Argon2idPrefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		b64.EncodeToString(salt), b64.EncodeToString(key))
+}
+
+// HashLegacyMD5 produces an MD5 hex digest identical to Python's
+// hashlib.md5(password.encode('utf-8')).hexdigest(), matching the hashes
+// imported from the legacy database.
+func HashLegacyMD5(password string) string {
 	// #nosec G401 -- Required for legacy database compatibility; changing the algorithm would invalidate existing credentials.
 	h := md5.Sum([]byte(password))
 	return hex.EncodeToString(h[:])
 }
 
+// VerifyPassword checks a password against either an argon2id hash or a
+// legacy MD5 digest.
 func VerifyPassword(storedHash, password string) bool {
-	return storedHash == HashPassword(password)
+	if !IsArgon2id(storedHash) {
+		legacy := HashLegacyMD5(password)
+		return subtle.ConstantTimeCompare([]byte(storedHash), []byte(legacy)) == 1
+	}
+
+	p, err := parseArgon2id(storedHash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key))) // #nosec G115 -- Key length comes from our own 32-byte hashes.
+	return subtle.ConstantTimeCompare(key, p.key) == 1
+}
+
+func IsArgon2id(storedHash string) bool {
+	return strings.HasPrefix(storedHash, Argon2idPrefix)
+}
+
+// NeedsRehash reports whether a stored hash should be replaced with a fresh
+// HashPassword result after a successful login: legacy MD5 digests and
+// argon2id hashes made with different parameters both qualify.
+func NeedsRehash(storedHash string) bool {
+	if !IsArgon2id(storedHash) {
+		return true
+	}
+	p, err := parseArgon2id(storedHash)
+	if err != nil {
+		return true
+	}
+	return p.memory != argon2Memory || p.time != argon2Time || p.threads != argon2Threads || len(p.key) != argon2KeyLen
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2id(storedHash string) (*argon2Params, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(storedHash, "$")
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("argon2id: malformed hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, err
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("argon2id: unsupported version %d", version)
+	}
+
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if p.key, err = b64.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
@@ -1,22 +1,48 @@
 package auth
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
-func TestHashPassword_MatchesLegacyPython(t *testing.T) {
+func TestHashLegacyMD5_MatchesLegacyPython(t *testing.T) {
 	// "password" -> MD5 from Python's hashlib.md5(b"password").hexdigest()
 	// This is also the admin user hash in 001_init.sql.
-	got := HashPassword("password")
+	got := HashLegacyMD5("password")
 	want := "5f4dcc3b5aa765d61d8327deb882cf99"
 	if got != want {
-		t.Errorf("HashPassword(%q) = %q, want %q", "password", got, want)
+		t.Errorf("HashLegacyMD5(%q) = %q, want %q", "password", got, want)
 	}
 }
 
-func TestHashPassword_EmptyString(t *testing.T) {
-	got := HashPassword("")
+func TestHashLegacyMD5_EmptyString(t *testing.T) {
+	got := HashLegacyMD5("")
 	want := "d41d8cd98f00b204e9800998ecf8427e"
 	if got != want {
-		t.Errorf("HashPassword(%q) = %q, want %q", "", got, want)
+		t.Errorf("HashLegacyMD5(%q) = %q, want %q", "", got, want)
+	}
+}
+
+func TestVerifyPassword_LegacyVectors(t *testing.T) {
+	if !VerifyPassword("5f4dcc3b5aa765d61d8327deb882cf99", "password") {
+		t.Error("VerifyPassword should accept the legacy MD5 hash of \"password\"")
+	}
+	if !VerifyPassword("d41d8cd98f00b204e9800998ecf8427e", "") {
+		t.Error("VerifyPassword should accept the legacy MD5 hash of the empty string")
+	}
+	if VerifyPassword("5f4dcc3b5aa765d61d8327deb882cf99", "Password") {
+		t.Error("VerifyPassword should reject a wrong password against a legacy hash")
+	}
+}
+
+func TestHashPassword_IsSaltedArgon2id(t *testing.T) {
+	a := HashPassword("mySecret123")
+	b := HashPassword("mySecret123")
+	if !strings.HasPrefix(a, Argon2idPrefix) {
+		t.Fatalf("expected %q prefix, got %q", Argon2idPrefix, a)
+	}
+	if a == b {
+		t.Error("expected different hashes for the same password (random salt)")
 	}
 }
 
@@ -33,3 +59,22 @@ func TestVerifyPassword_Wrong(t *testing.T) {
 		t.Error("VerifyPassword should return false for wrong password")
 	}
 }
+
+func TestVerifyPassword_MalformedArgon2id(t *testing.T) {
+	if VerifyPassword("$argon2id$v=19$garbage", "password") {
+		t.Error("VerifyPassword should return false for a malformed hash")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	if !NeedsRehash(HashLegacyMD5("password")) {
+		t.Error("legacy MD5 hashes should need a rehash")
+	}
+	if NeedsRehash(HashPassword("password")) {
+		t.Error("fresh argon2id hashes should not need a rehash")
+	}
+	weaker := "$argon2id$v=19$m=4096,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaGhhc2hoYXNoaGFzaGhhc2hoYXNoaGFzaGhhc2g"
+	if !NeedsRehash(weaker) {
+		t.Error("argon2id hashes with old parameters should need a rehash")
+	}
+}
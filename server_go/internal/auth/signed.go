@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSignedTokenInvalid = errors.New("signed token invalid")
+	ErrSignedTokenExpired = errors.New("signed token expired")
+)
+
+// Sign returns a URL-safe token carrying payload and an expiry, authenticated
+// with HMAC-SHA256 under key. The payload is readable by anyone holding the
+// token; it is only protected against tampering.
+func Sign(key []byte, payload string, expires time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac(key, body))
+}
+
+// VerifySigned checks a token made by Sign with any of keys and returns its
+// payload. A tampered token yields ErrSignedTokenInvalid; an authentic but
+// stale one ErrSignedTokenExpired.
+func VerifySigned(keys [][]byte, token string, now time.Time) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", ErrSignedTokenInvalid
+	}
+	body := token[:i]
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		return "", ErrSignedTokenInvalid
+	}
+
+	valid := false
+	for _, key := range keys {
+		if hmac.Equal(sig, mac(key, body)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", ErrSignedTokenInvalid
+	}
+
+	payloadPart, expPart, ok := strings.Cut(body, ".")
+	if !ok {
+		return "", ErrSignedTokenInvalid
+	}
+	exp, err := strconv.ParseInt(expPart, 10, 64)
+	if err != nil {
+		return "", ErrSignedTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return "", ErrSignedTokenInvalid
+	}
+	if now.Unix() > exp {
+		return "", ErrSignedTokenExpired
+	}
+	return string(payload), nil
+}
+
+func mac(key []byte, body string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(body))
+	return h.Sum(nil)
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSign_RoundTrip(t *testing.T) {
+	key := []byte("key")
+	now := time.Now()
+	token := Sign(key, "42|alice@example.com", now.Add(time.Hour))
+
+	got, err := VerifySigned([][]byte{key}, token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "42|alice@example.com" {
+		t.Errorf("expected payload back, got %q", got)
+	}
+}
+
+func TestVerifySigned_Expired(t *testing.T) {
+	key := []byte("key")
+	now := time.Now()
+	token := Sign(key, "payload", now.Add(-time.Second))
+
+	if _, err := VerifySigned([][]byte{key}, token, now); !errors.Is(err, ErrSignedTokenExpired) {
+		t.Errorf("expected ErrSignedTokenExpired, got %v", err)
+	}
+}
+
+func TestVerifySigned_Tampered(t *testing.T) {
+	key := []byte("key")
+	now := time.Now()
+	token := Sign(key, "payload", now.Add(time.Hour))
+	other := Sign(key, "other", now.Add(time.Hour))
+
+	// Swap the payload of one token into the other's signature.
+	tampered := other[:len(other)-43] + token[len(token)-43:]
+	if _, err := VerifySigned([][]byte{key}, tampered, now); !errors.Is(err, ErrSignedTokenInvalid) {
+		t.Errorf("expected ErrSignedTokenInvalid for tampered token, got %v", err)
+	}
+	if _, err := VerifySigned([][]byte{[]byte("wrong")}, token, now); !errors.Is(err, ErrSignedTokenInvalid) {
+		t.Errorf("expected ErrSignedTokenInvalid for wrong key, got %v", err)
+	}
+	if _, err := VerifySigned([][]byte{key}, "garbage", now); !errors.Is(err, ErrSignedTokenInvalid) {
+		t.Errorf("expected ErrSignedTokenInvalid for garbage, got %v", err)
+	}
+}
+
+func TestVerifySigned_AnyKey(t *testing.T) {
+	old := []byte("old")
+	token := Sign(old, "payload", time.Now().Add(time.Hour))
+
+	if _, err := VerifySigned([][]byte{[]byte("new"), old}, token, time.Now()); err != nil {
+		t.Errorf("expected token signed with a previous key to verify, got %v", err)
+	}
+}
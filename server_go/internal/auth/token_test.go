@@ -0,0 +1,21 @@
+package auth
+
+import "testing"
+
+func TestNewToken_HashMatches(t *testing.T) {
+	token, hash := NewToken()
+	if HashToken(token) != hash {
+		t.Error("HashToken(token) should equal the returned hash")
+	}
+	if token == hash {
+		t.Error("token and hash should differ")
+	}
+}
+
+func TestNewToken_Unique(t *testing.T) {
+	a, _ := NewToken()
+	b, _ := NewToken()
+	if a == b {
+		t.Error("expected two tokens to differ")
+	}
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// APITokenRow is a personal access token. The token itself is never stored,
+// only its hash.
+type APITokenRow struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+const apiTokenColumns = "id, user_id, name, scopes, created_at, last_used_at"
+
+func scanAPIToken(row pgx.Row) (*APITokenRow, error) {
+	t := &APITokenRow{}
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Scopes, &t.CreatedAt, &t.LastUsedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+func CreateAPIToken(ctx context.Context, conn *pgxpool.Pool, userID int64, name, tokenHash string, scopes []string) (*APITokenRow, error) {
+	if scopes == nil {
+		// A nil slice would be sent as NULL.
+		scopes = []string{}
+	}
+	return scanAPIToken(conn.QueryRow(ctx,
+		"INSERT INTO api_tokens (user_id, name, token_hash, scopes) VALUES ($1, $2, $3, $4) RETURNING "+apiTokenColumns,
+		userID, name, tokenHash, scopes,
+	))
+}
+
+func GetAPITokenByHash(ctx context.Context, conn *pgxpool.Pool, tokenHash string) (*APITokenRow, error) {
+	return scanAPIToken(conn.QueryRow(ctx,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE token_hash = $1",
+		tokenHash,
+	))
+}
+
+// ListUserAPITokens returns a user's tokens, newest first.
+func ListUserAPITokens(ctx context.Context, conn *pgxpool.Pool, userID int64) ([]APITokenRow, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]APITokenRow, 0)
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// TouchAPIToken records that a token was used. Writes are skipped while the
+// stored time is less than a minute old so busy scripts don't cause a write
+// per request; touched reports whether this call wrote.
+func TouchAPIToken(ctx context.Context, conn *pgxpool.Pool, id int64) (touched bool, err error) {
+	tag, err := conn.Exec(ctx, `
+		UPDATE api_tokens SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteUserAPIToken revokes one of a user's tokens. Tokens belonging to
+// other users are reported as not found.
+func DeleteUserAPIToken(ctx context.Context, conn *pgxpool.Pool, userID, id int64) error {
+	tag, err := conn.Exec(ctx, "DELETE FROM api_tokens WHERE user_id = $1 AND id = $2", userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+func init() { export.Register("api_tokens", exportAPITokens) }
+
+type apiTokenExport struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func exportAPITokens(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	rows, err := ListUserAPITokens(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]apiTokenExport, len(rows))
+	for i, r := range rows {
+		out[i] = apiTokenExport{Name: r.Name, Scopes: r.Scopes, CreatedAt: r.CreatedAt, LastUsedAt: r.LastUsedAt}
+	}
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCreateAPIToken_And_GetByHash(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	created, err := CreateAPIToken(ctx, pool, uid, "ci", "hash1", []string{"search:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetAPITokenByHash(ctx, pool, "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != created.ID || got.UserID != uid || got.Name != "ci" {
+		t.Errorf("unexpected token %+v", got)
+	}
+	if len(got.Scopes) != 1 || got.Scopes[0] != "search:read" {
+		t.Errorf("expected scopes [search:read], got %v", got.Scopes)
+	}
+	if got.LastUsedAt != nil {
+		t.Errorf("expected no last use yet, got %v", got.LastUsedAt)
+	}
+
+	if _, err := GetAPITokenByHash(ctx, pool, "nope"); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("expected ErrAPITokenNotFound, got %v", err)
+	}
+}
+
+func TestTouchAPIToken(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	created, err := CreateAPIToken(ctx, pool, uid, "ci", "hash1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if touched, err := TouchAPIToken(ctx, pool, created.ID); err != nil || !touched {
+		t.Fatalf("expected the first touch to write, got %v, %v", touched, err)
+	}
+	if touched, err := TouchAPIToken(ctx, pool, created.ID); err != nil || touched {
+		t.Fatalf("expected the second touch to be skipped, got %v, %v", touched, err)
+	}
+
+	got, err := GetAPITokenByHash(ctx, pool, "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LastUsedAt == nil {
+		t.Error("expected last_used_at to be set")
+	}
+}
+
+func TestDeleteUserAPIToken_OtherUser(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	alice := mustCreateUser(t, pool, "alice")
+	bob := mustCreateUser(t, pool, "bob")
+
+	created, err := CreateAPIToken(ctx, pool, alice, "ci", "hash1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteUserAPIToken(ctx, pool, bob, created.ID); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("expected ErrAPITokenNotFound for another user's token, got %v", err)
+	}
+	if err := DeleteUserAPIToken(ctx, pool, alice, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := ListUserAPITokens(ctx, pool, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("expected no tokens left, got %d", len(tokens))
+	}
+}
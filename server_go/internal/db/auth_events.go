@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// Auth event types.
+const (
+	EventLogin            = "login"
+	EventLoginFailed      = "login_failed"
+	EventLogout           = "logout"
+	EventRegister         = "register"
+	EventPasswordChange   = "password_change"
+	EventPasswordReset    = "password_reset"
+	EventEmailChange      = "email_change"
+	EventAccountDelete    = "account_delete"
+	EventTokenCreate      = "token_create"
+	EventTokenRevoke      = "token_revoke"
+	EventTokenUse         = "token_use"
+	EventTokenInvalid     = "token_invalid"
+	EventTwoFactorEnable  = "2fa_enable"
+	EventTwoFactorDisable = "2fa_disable"
+	EventSessionsRevoke   = "sessions_revoke"
+	EventRoleChange       = "role_change"
+	EventDataExport       = "data_export"
+	EventLoginUnlock      = "login_unlock"
+)
+
+type AuthEventRow struct {
+	ID         int64
+	OccurredAt time.Time
+	Type       string
+	// UserID is nil for events without a known user, such as a failed
+	// login with an unknown username, and after the user was deleted.
+	UserID    *int64
+	Username  string
+	IP        string
+	UserAgent string
+	RequestID string
+	Detail    string
+}
+
+const authEventColumns = "id, occurred_at, type, user_id, username, ip, user_agent, request_id, detail"
+
+func scanAuthEvent(row pgx.Row) (*AuthEventRow, error) {
+	e := &AuthEventRow{}
+	if err := row.Scan(&e.ID, &e.OccurredAt, &e.Type, &e.UserID, &e.Username, &e.IP, &e.UserAgent, &e.RequestID, &e.Detail); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// RecordAuthEvent stores e; its ID and OccurredAt are set by the database.
+func RecordAuthEvent(ctx context.Context, conn *pgxpool.Pool, e AuthEventRow) error {
+	_, err := conn.Exec(ctx, `
+		INSERT INTO auth_events (type, user_id, username, ip, user_agent, request_id, detail)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, e.Type, e.UserID, e.Username, e.IP, e.UserAgent, e.RequestID, e.Detail)
+	return err
+}
+
+// AuthEventFilter narrows ListAuthEvents. Zero fields don't filter.
+type AuthEventFilter struct {
+	UserID *int64
+	// Username matches events recorded under that name, in any letter
+	// case, and all events of the user who has it now.
+	Username string
+	Type     string
+	Since    time.Time
+	Until    time.Time
+	// BeforeID pages backwards: only events older than this id are
+	// returned.
+	BeforeID int64
+	Limit    int
+}
+
+// ListAuthEvents returns matching events, newest first.
+func ListAuthEvents(ctx context.Context, conn *pgxpool.Pool, f AuthEventFilter) ([]AuthEventRow, error) {
+	var since, until *time.Time
+	if !f.Since.IsZero() {
+		since = &f.Since
+	}
+	if !f.Until.IsZero() {
+		until = &f.Until
+	}
+	var limit *int
+	if f.Limit > 0 {
+		limit = &f.Limit
+	}
+
+	rows, err := conn.Query(ctx, `
+		SELECT `+authEventColumns+`
+		FROM auth_events
+		WHERE ($1::bigint IS NULL OR user_id = $1)
+			AND ($2 = '' OR lower(username) = lower($2)
+				OR user_id IN (SELECT id FROM users WHERE lower(username) = lower($2)))
+			AND ($3 = '' OR type = $3)
+			AND ($4::timestamptz IS NULL OR occurred_at >= $4)
+			AND ($5::timestamptz IS NULL OR occurred_at < $5)
+			AND ($6::bigint = 0 OR id < $6)
+		ORDER BY id DESC
+		LIMIT $7
+	`, f.UserID, strings.TrimSpace(f.Username), f.Type, since, until, f.BeforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]AuthEventRow, 0)
+	for rows.Next() {
+		e, err := scanAuthEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *e)
+	}
+	return out, rows.Err()
+}
+
+// DeleteAuthEventsBefore removes events older than cutoff and returns how
+// many were removed.
+func DeleteAuthEventsBefore(ctx context.Context, conn *pgxpool.Pool, cutoff time.Time) (int64, error) {
+	tag, err := conn.Exec(ctx, "DELETE FROM auth_events WHERE occurred_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func init() { export.Register("auth_events", exportAuthEvents) }
+
+type authEventExport struct {
+	OccurredAt time.Time `json:"occurred_at"`
+	Type       string    `json:"type"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Detail     string    `json:"detail"`
+}
+
+func exportAuthEvents(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	rows, err := ListAuthEvents(ctx, conn, AuthEventFilter{UserID: &userID})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]authEventExport, len(rows))
+	for i, r := range rows {
+		out[i] = authEventExport{OccurredAt: r.OccurredAt, Type: r.Type, IP: r.IP, UserAgent: r.UserAgent, Detail: r.Detail}
+	}
+	return out, nil
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecordAndListAuthEvents(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	for _, e := range []AuthEventRow{
+		{Type: EventLoginFailed, Username: "ALICE", IP: "203.0.113.7", Detail: "invalid credentials"},
+		{Type: EventLogin, UserID: &uid, Username: "alice", IP: "203.0.113.7", UserAgent: "curl/8", RequestID: "req-1"},
+		{Type: EventPasswordReset, UserID: &uid},
+		{Type: EventLoginFailed, Username: "mallory"},
+	} {
+		if err := RecordAuthEvent(ctx, pool, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := ListAuthEvents(ctx, pool, AuthEventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[0].Username != "mallory" {
+		t.Fatalf("expected 4 events newest first, got %+v", all)
+	}
+
+	alice, err := ListAuthEvents(ctx, pool, AuthEventFilter{Username: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alice) != 3 {
+		t.Errorf("expected alice's 3 events, including the one recorded by id only, got %d", len(alice))
+	}
+
+	failed, err := ListAuthEvents(ctx, pool, AuthEventFilter{Type: EventLoginFailed, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Username != "mallory" {
+		t.Errorf("expected the newest failed login, got %+v", failed)
+	}
+
+	older, err := ListAuthEvents(ctx, pool, AuthEventFilter{BeforeID: all[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(older) != 2 {
+		t.Errorf("expected 2 events before id %d, got %d", all[1].ID, len(older))
+	}
+
+	future, err := ListAuthEvents(ctx, pool, AuthEventFilter{Since: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(future) != 0 {
+		t.Errorf("expected no events in the future, got %d", len(future))
+	}
+}
+
+func TestDeleteAuthEventsBefore(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	if err := RecordAuthEvent(ctx, pool, AuthEventRow{Type: EventLogout}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, "UPDATE auth_events SET occurred_at = now() - interval '100 days'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordAuthEvent(ctx, pool, AuthEventRow{Type: EventLogin}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := DeleteAuthEventsBefore(ctx, pool, time.Now().Add(-90*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 pruned event, got %d", n)
+	}
+}
+
+func TestDeletedUserKeepsAuthEvents(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := RecordAuthEvent(ctx, pool, AuthEventRow{Type: EventLogin, UserID: &uid, Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteUser(ctx, pool, uid); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := ListAuthEvents(ctx, pool, AuthEventFilter{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].UserID != nil {
+		t.Errorf("expected the event to remain without a user id, got %+v", events)
+	}
+}
+
+func TestListAuthEvents_UsernamesDifferingByCase(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	upper := mustCreateUser(t, pool, "Alice")
+	lower := mustCreateUser(t, pool, "alice")
+
+	for _, uid := range []int64{upper, lower} {
+		if err := RecordAuthEvent(ctx, pool, AuthEventRow{Type: EventPasswordReset, UserID: &uid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := ListAuthEvents(ctx, pool, AuthEventFilter{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected the events of both users, got %d", len(events))
+	}
+}
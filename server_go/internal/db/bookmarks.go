@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// BookmarkRow is a page a user starred. URL is the page's address when it
+// was bookmarked; PageExists is false once the page is gone.
+type BookmarkRow struct {
+	UserID     int64
+	PageTitle  string
+	URL        string
+	CreatedAt  time.Time
+	PageExists bool
+}
+
+var ErrBookmarkNotFound = errors.New("bookmark not found")
+
+// AddBookmark stars a page for the user. Bookmarking a page twice is not an
+// error; a page that doesn't exist is ErrPageNotFound.
+func AddBookmark(ctx context.Context, conn *pgxpool.Pool, userID int64, pageTitle string) error {
+	tag, err := conn.Exec(ctx, `
+		INSERT INTO bookmarks (user_id, page_title, url)
+		SELECT $1, title, url FROM pages WHERE title = $2
+		ON CONFLICT (user_id, page_title) DO NOTHING
+	`, userID, pageTitle)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pages WHERE title = $1)", pageTitle).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrPageNotFound
+		}
+	}
+	return nil
+}
+
+// RemoveBookmark unstars a page. It works for pages that no longer exist.
+func RemoveBookmark(ctx context.Context, conn *pgxpool.Pool, userID int64, pageTitle string) error {
+	tag, err := conn.Exec(ctx, "DELETE FROM bookmarks WHERE user_id = $1 AND page_title = $2", userID, pageTitle)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBookmarkNotFound
+	}
+	return nil
+}
+
+// ListBookmarks returns the user's bookmarks, newest first, with the
+// current URL of pages that still exist.
+func ListBookmarks(ctx context.Context, conn *pgxpool.Pool, userID int64) ([]BookmarkRow, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT b.user_id, b.page_title, COALESCE(p.url, b.url), b.created_at, p.title IS NOT NULL
+		FROM bookmarks b
+		LEFT JOIN pages p ON p.title = b.page_title
+		WHERE b.user_id = $1
+		ORDER BY b.created_at DESC, b.page_title
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]BookmarkRow, 0)
+	for rows.Next() {
+		var b BookmarkRow
+		if err := rows.Scan(&b.UserID, &b.PageTitle, &b.URL, &b.CreatedAt, &b.PageExists); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// BookmarkedTitles returns which of titles the user has bookmarked.
+func BookmarkedTitles(ctx context.Context, conn *pgxpool.Pool, userID int64, titles []string) (map[string]bool, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT page_title FROM bookmarks WHERE user_id = $1 AND page_title = ANY($2)",
+		userID, titles,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]bool{}
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			return nil, err
+		}
+		out[title] = true
+	}
+	return out, rows.Err()
+}
+
+func init() { export.Register("bookmarks", exportBookmarks) }
+
+type bookmarkExport struct {
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func exportBookmarks(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	rows, err := ListBookmarks(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]bookmarkExport, len(rows))
+	for i, b := range rows {
+		out[i] = bookmarkExport{Title: b.PageTitle, URL: b.URL, CreatedAt: b.CreatedAt}
+	}
+	return out, nil
+}
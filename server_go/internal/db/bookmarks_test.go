@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAddBookmark_ListAndRemove(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	seedPages(t, pool)
+	uid := mustCreateUser(t, pool, "alice")
+
+	for i := 0; i < 2; i++ {
+		if err := AddBookmark(ctx, pool, uid, "Go Programming"); err != nil {
+			t.Fatalf("add #%d: %v", i+1, err)
+		}
+	}
+	if err := AddBookmark(ctx, pool, uid, "Missing Page"); !errors.Is(err, ErrPageNotFound) {
+		t.Errorf("expected ErrPageNotFound, got %v", err)
+	}
+
+	rows, err := ListBookmarks(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].PageTitle != "Go Programming" || rows[0].URL != "/go" || !rows[0].PageExists {
+		t.Fatalf("unexpected bookmarks %+v", rows)
+	}
+
+	marked, err := BookmarkedTitles(ctx, pool, uid, []string{"Go Programming", "Python Programming"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !marked["Go Programming"] || marked["Python Programming"] {
+		t.Errorf("unexpected bookmarked titles %v", marked)
+	}
+
+	if err := RemoveBookmark(ctx, pool, uid, "Go Programming"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveBookmark(ctx, pool, uid, "Go Programming"); !errors.Is(err, ErrBookmarkNotFound) {
+		t.Errorf("expected ErrBookmarkNotFound, got %v", err)
+	}
+}
+
+func TestListBookmarks_DeletedPage(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	seedPages(t, pool)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := AddBookmark(ctx, pool, uid, "Go Programming"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, "DELETE FROM pages WHERE title = 'Go Programming'"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := ListBookmarks(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].PageExists || rows[0].URL != "/go" {
+		t.Fatalf("expected the bookmark to stay with its old URL, got %+v", rows)
+	}
+	if err := RemoveBookmark(ctx, pool, uid, "Go Programming"); err != nil {
+		t.Errorf("expected a bookmark of a deleted page to be removable, got %v", err)
+	}
+}
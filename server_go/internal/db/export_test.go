@@ -0,0 +1,54 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+func TestExportLeavesOutSecrets(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := UpdatePasswordHash(ctx, pool, uid, "secret-password-hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSession(ctx, pool, SessionRow{ID: "secret-session-id", UserID: &uid, Data: []byte{}, UserAgent: "curl/8", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateAPIToken(ctx, pool, uid, "ci", "secret-token-hash", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkIdentity(ctx, pool, uid, "https://idp.example.com", "sub-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := export.Default.Collect(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range []string{"profile", "sessions", "api_tokens", "identities", "search_history"} {
+		if _, ok := a.Sections[section]; !ok {
+			t.Errorf("expected a %s section", section)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := a.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-password-hash", "secret-session-id", "secret-token-hash"} {
+		if bytes.Contains(buf.Bytes(), []byte(secret)) {
+			t.Errorf("export contains %q", secret)
+		}
+	}
+	for _, want := range []string{"alice@example.com", "curl/8", "sub-1"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("export is missing %q", want)
+		}
+	}
+}
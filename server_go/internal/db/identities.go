@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// IdentityRow is an external account linked to a user.
+type IdentityRow struct {
+	Issuer    string
+	Subject   string
+	CreatedAt time.Time
+}
+
+// GetUserByIdentity returns the user linked to subject at issuer.
+func GetUserByIdentity(ctx context.Context, conn *pgxpool.Pool, issuer, subject string) (*UserRow, error) {
+	return scanUser(conn.QueryRow(ctx, `
+		SELECT `+prefixColumns("u.", userColumns)+`
+		FROM user_identities i JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2
+	`, issuer, subject))
+}
+
+// LinkIdentity links subject at issuer to an existing user. Linking the
+// same identity twice is a no-op.
+func LinkIdentity(ctx context.Context, conn *pgxpool.Pool, userID int64, issuer, subject string) error {
+	_, err := conn.Exec(ctx, `
+		INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)
+		ON CONFLICT (issuer, subject) DO NOTHING
+	`, issuer, subject, userID)
+	return err
+}
+
+// CreateSSOUser provisions a user for an identity the provider vouched for.
+// The email counts as verified and there is no password.
+func CreateSSOUser(ctx context.Context, conn *pgxpool.Pool, username, email, issuer, subject string) (*UserRow, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	u, err := scanUser(tx.QueryRow(ctx, `
+		INSERT INTO users (username, email, password, email_verified_at)
+		VALUES ($1, $2, '', now())
+		RETURNING `+userColumns,
+		username, email,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)",
+		issuer, subject, u.ID,
+	); err != nil {
+		return nil, err
+	}
+	return u, tx.Commit(ctx)
+}
+
+// ListUserIdentities returns the provider accounts linked to a user, oldest
+// first.
+func ListUserIdentities(ctx context.Context, conn *pgxpool.Pool, userID int64) ([]IdentityRow, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT issuer, subject, created_at FROM user_identities WHERE user_id = $1 ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]IdentityRow, 0)
+	for rows.Next() {
+		var i IdentityRow
+		if err := rows.Scan(&i.Issuer, &i.Subject, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+func init() { export.Register("identities", exportIdentities) }
+
+type identityExport struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func exportIdentities(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	rows, err := ListUserIdentities(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]identityExport, len(rows))
+	for i, r := range rows {
+		out[i] = identityExport{Issuer: r.Issuer, Subject: r.Subject, CreatedAt: r.CreatedAt}
+	}
+	return out, nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCreateSSOUser_And_GetByIdentity(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	created, err := CreateSSOUser(ctx, pool, "alice", "alice@corp.example", "https://idp.example", "sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.PasswordHash != "" {
+		t.Errorf("expected no password for an SSO user, got %q", created.PasswordHash)
+	}
+	if created.EmailVerifiedAt == nil {
+		t.Error("expected the provider-vouched email to be verified")
+	}
+
+	u, err := GetUserByIdentity(ctx, pool, "https://idp.example", "sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != created.ID {
+		t.Errorf("expected user %d, got %d", created.ID, u.ID)
+	}
+
+	if _, err := GetUserByIdentity(ctx, pool, "https://other.example", "sub-1"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound for another issuer, got %v", err)
+	}
+
+	n, err := CountLegacyPasswordHashes(ctx, pool, "$argon2id$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected SSO users not to count as legacy hashes, got %d", n)
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	for range 2 {
+		if err := LinkIdentity(ctx, pool, uid, "https://idp.example", "sub-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err := GetUserByIdentity(ctx, pool, "https://idp.example", "sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != uid {
+		t.Errorf("expected user %d, got %d", uid, u.ID)
+	}
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultLanguage is the legacy fallback used when a search doesn't specify
+// a language.
+const DefaultLanguage = "en"
+
+type LanguageRow struct {
+	Code             string
+	Name             string
+	TextSearchConfig string
+	Enabled          bool
+}
+
+var ErrLanguageNotFound = errors.New("language not found")
+
+// GetEnabledLanguage looks up a language by code, treating disabled
+// languages the same as unknown ones.
+func GetEnabledLanguage(ctx context.Context, conn *pgxpool.Pool, code string) (*LanguageRow, error) {
+	row := conn.QueryRow(ctx,
+		"SELECT code, name, text_search_config::text, enabled FROM languages WHERE code = $1 AND enabled",
+		code,
+	)
+
+	l := &LanguageRow{}
+	if err := row.Scan(&l.Code, &l.Name, &l.TextSearchConfig, &l.Enabled); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrLanguageNotFound
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+func ListEnabledLanguages(ctx context.Context, conn *pgxpool.Pool) ([]LanguageRow, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT code, name, text_search_config::text, enabled FROM languages WHERE enabled ORDER BY code",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]LanguageRow, 0)
+	for rows.Next() {
+		var l LanguageRow
+		if err := rows.Scan(&l.Code, &l.Name, &l.TextSearchConfig, &l.Enabled); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
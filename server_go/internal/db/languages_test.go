@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGetEnabledLanguage_Seeded(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	l, err := GetEnabledLanguage(ctx, pool, "da")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.TextSearchConfig != "danish" {
+		t.Errorf("expected text search config 'danish', got %q", l.TextSearchConfig)
+	}
+}
+
+func TestGetEnabledLanguage_Unknown(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	_, err := GetEnabledLanguage(ctx, pool, "xx")
+	if !errors.Is(err, ErrLanguageNotFound) {
+		t.Errorf("expected ErrLanguageNotFound, got %v", err)
+	}
+}
+
+func TestGetEnabledLanguage_Disabled(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	if _, err := pool.Exec(ctx,
+		`INSERT INTO languages (code, name, enabled) VALUES ('de', 'Deutsch', FALSE)
+		 ON CONFLICT (code) DO UPDATE SET enabled = FALSE`,
+	); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = pool.Exec(ctx, "DELETE FROM languages WHERE code = 'de'") })
+
+	_, err := GetEnabledLanguage(ctx, pool, "de")
+	if !errors.Is(err, ErrLanguageNotFound) {
+		t.Errorf("expected ErrLanguageNotFound for disabled language, got %v", err)
+	}
+}
+
+func TestListEnabledLanguages(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	langs, err := ListEnabledLanguages(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(langs) != 2 || langs[0].Code != "da" || langs[1].Code != "en" {
+		t.Fatalf("expected [da en], got %+v", langs)
+	}
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	ThrottleScopeIP      = "ip"
+	ThrottleScopeAccount = "account"
+)
+
+// LoginLockedUntil returns when the lock on (scope, key) ends, or the zero
+// time if it isn't locked.
+func LoginLockedUntil(ctx context.Context, conn *pgxpool.Pool, scope, key string) (time.Time, error) {
+	var until *time.Time
+	err := conn.QueryRow(ctx,
+		"SELECT locked_until FROM login_throttles WHERE scope = $1 AND key = $2 AND locked_until > now()",
+		scope, key,
+	).Scan(&until)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if until == nil {
+		return time.Time{}, nil
+	}
+	return *until, nil
+}
+
+// RecordLoginFailure bumps the failure count for (scope, key) and returns
+// the new count. Failures older than window are forgotten first, so the
+// count only covers recent attempts.
+func RecordLoginFailure(ctx context.Context, conn *pgxpool.Pool, scope, key string, window time.Duration) (int, error) {
+	var failures int
+	err := conn.QueryRow(ctx, `
+		INSERT INTO login_throttles (scope, key, failures) VALUES ($1, $2, 1)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failed_at < now() - make_interval(secs => $3) THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failed_at = now()
+		RETURNING failures
+	`, scope, key, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+func LockLogin(ctx context.Context, conn *pgxpool.Pool, scope, key string, until time.Time) error {
+	_, err := conn.Exec(ctx,
+		"UPDATE login_throttles SET locked_until = $3 WHERE scope = $1 AND key = $2",
+		scope, key, until,
+	)
+	return err
+}
+
+// ClearLoginFailures forgets failures and lifts any lock on (scope, key). It
+// backs both a successful login and an admin unlock. It reports whether
+// there was anything to clear.
+func ClearLoginFailures(ctx context.Context, conn *pgxpool.Pool, scope, key string) (bool, error) {
+	tag, err := conn.Exec(ctx, "DELETE FROM login_throttles WHERE scope = $1 AND key = $2", scope, key)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteStaleLoginThrottles removes the rows whose last failure is older
+// than window and that aren't locked, which RecordLoginFailure would
+// restart from 1 anyway. It returns how many were removed.
+func DeleteStaleLoginThrottles(ctx context.Context, conn *pgxpool.Pool, window time.Duration) (int64, error) {
+	tag, err := conn.Exec(ctx, `
+		DELETE FROM login_throttles
+		WHERE last_failed_at < now() - make_interval(secs => $1)
+			AND (locked_until IS NULL OR locked_until <= now())
+	`, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
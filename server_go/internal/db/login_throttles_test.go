@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecordLoginFailure_Counts(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	for want := 1; want <= 3; want++ {
+		got, err := RecordLoginFailure(ctx, pool, ThrottleScopeAccount, "alice", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("expected failure count %d, got %d", want, got)
+		}
+	}
+
+	// A zero window forgets earlier failures.
+	got, err := RecordLoginFailure(ctx, pool, ThrottleScopeAccount, "alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1 {
+		t.Errorf("expected count to restart at 1 outside the window, got %d", got)
+	}
+}
+
+func TestLockLogin_And_Clear(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	if _, err := RecordLoginFailure(ctx, pool, ThrottleScopeIP, "10.0.0.1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Minute).Truncate(time.Microsecond)
+	if err := LockLogin(ctx, pool, ThrottleScopeIP, "10.0.0.1", until); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoginLockedUntil(ctx, pool, ThrottleScopeIP, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(until) {
+		t.Errorf("expected lock until %v, got %v", until, got)
+	}
+
+	cleared, err := ClearLoginFailures(ctx, pool, ThrottleScopeIP, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cleared {
+		t.Error("expected ClearLoginFailures to report a cleared row")
+	}
+	got, err = LoginLockedUntil(ctx, pool, ThrottleScopeIP, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsZero() {
+		t.Errorf("expected no lock after clearing, got %v", got)
+	}
+}
+
+func TestLoginLockedUntil_ReportsErrors(t *testing.T) {
+	pool := newTestPool(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := LoginLockedUntil(ctx, pool, ThrottleScopeIP, "10.0.0.1"); err == nil {
+		t.Error("expected an error for a cancelled context, so lockouts don't silently turn off")
+	}
+}
+
+func TestDeleteStaleLoginThrottles(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	for _, key := range []string{"stale", "locked", "recent"} {
+		if _, err := RecordLoginFailure(ctx, pool, ThrottleScopeAccount, key, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := pool.Exec(ctx, "UPDATE login_throttles SET last_failed_at = now() - interval '2 days' WHERE key IN ('stale', 'locked')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LockLogin(ctx, pool, ThrottleScopeAccount, "locked", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := DeleteStaleLoginThrottles(ctx, pool, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected only the stale, unlocked row to go, got %d", n)
+	}
+}
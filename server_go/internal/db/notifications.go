@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// NotificationRow is an in-app notification. SavedSearchID is nil once the
+// saved search that raised it was deleted.
+type NotificationRow struct {
+	ID            int64
+	UserID        int64
+	SavedSearchID *int64
+	Title         string
+	Body          string
+	URL           string
+	CreatedAt     time.Time
+	ReadAt        *time.Time
+}
+
+const notificationColumns = "id, user_id, saved_search_id, title, body, url, created_at, read_at"
+
+func scanNotification(row pgx.Row) (*NotificationRow, error) {
+	n := &NotificationRow{}
+	if err := row.Scan(&n.ID, &n.UserID, &n.SavedSearchID, &n.Title, &n.Body, &n.URL, &n.CreatedAt, &n.ReadAt); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func CreateNotification(ctx context.Context, conn *pgxpool.Pool, n NotificationRow) (*NotificationRow, error) {
+	return scanNotification(conn.QueryRow(ctx, `
+		INSERT INTO notifications (user_id, saved_search_id, title, body, url)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+notificationColumns,
+		n.UserID, n.SavedSearchID, n.Title, n.Body, n.URL,
+	))
+}
+
+// ListNotifications returns up to limit of a user's notifications, newest
+// first.
+func ListNotifications(ctx context.Context, conn *pgxpool.Pool, userID int64, limit int) ([]NotificationRow, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT "+notificationColumns+" FROM notifications WHERE user_id = $1 ORDER BY id DESC LIMIT $2",
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]NotificationRow, 0)
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *n)
+	}
+	return out, rows.Err()
+}
+
+func CountUnreadNotifications(ctx context.Context, conn *pgxpool.Pool, userID int64) (int64, error) {
+	var n int64
+	err := conn.QueryRow(ctx,
+		"SELECT count(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL",
+		userID,
+	).Scan(&n)
+	return n, err
+}
+
+// MarkNotificationsRead marks all of a user's notifications as read and
+// returns how many were unread.
+func MarkNotificationsRead(ctx context.Context, conn *pgxpool.Pool, userID int64) (int64, error) {
+	tag, err := conn.Exec(ctx,
+		"UPDATE notifications SET read_at = now() WHERE user_id = $1 AND read_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func init() { export.Register("notifications", exportNotifications) }
+
+type notificationExport struct {
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+func exportNotifications(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT "+notificationColumns+" FROM notifications WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]notificationExport, 0)
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, notificationExport{Title: n.Title, Body: n.Body, URL: n.URL, CreatedAt: n.CreatedAt, ReadAt: n.ReadAt})
+	}
+	return out, rows.Err()
+}
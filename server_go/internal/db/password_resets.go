@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrResetTokenInvalid covers unknown, expired and already used tokens alike.
+var ErrResetTokenInvalid = errors.New("password reset token invalid")
+
+func CreatePasswordResetToken(ctx context.Context, conn *pgxpool.Pool, userID int64, tokenHash string, expiresAt time.Time) error {
+	_, err := conn.Exec(ctx,
+		"INSERT INTO password_reset_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		tokenHash, userID, expiresAt,
+	)
+	return err
+}
+
+// PasswordResetTokenValid reports whether a token can still be used, without
+// consuming it. It backs the reset form so a dead link fails early.
+func PasswordResetTokenValid(ctx context.Context, conn *pgxpool.Pool, tokenHash string) (bool, error) {
+	var ok bool
+	err := conn.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM password_reset_tokens
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		)
+	`, tokenHash).Scan(&ok)
+	return ok, err
+}
+
+// ResetPassword consumes a reset token and sets the user's new password hash
+// in one transaction. Any other outstanding tokens for the user are used up
+// as well. It returns the id of the user whose password was changed.
+func ResetPassword(ctx context.Context, conn *pgxpool.Pool, tokenHash, passwordHash string) (int64, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var userID int64
+	err = tx.QueryRow(ctx, `
+		UPDATE password_reset_tokens SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id
+	`, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE password_reset_tokens SET used_at = now() WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE users SET password = $2 WHERE id = $1", userID, passwordHash); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit(ctx)
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResetPassword_SingleUse(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := CreatePasswordResetToken(ctx, pool, uid, "tok1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreatePasswordResetToken(ctx, pool, uid, "tok2", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ResetPassword(ctx, pool, "tok1", "newhash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != uid {
+		t.Errorf("expected user id %d, got %d", uid, got)
+	}
+
+	u, err := GetUserByID(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.PasswordHash != "newhash" {
+		t.Errorf("expected password hash 'newhash', got %q", u.PasswordHash)
+	}
+
+	if _, err := ResetPassword(ctx, pool, "tok1", "again"); !errors.Is(err, ErrResetTokenInvalid) {
+		t.Errorf("expected reused token to be rejected, got %v", err)
+	}
+	if _, err := ResetPassword(ctx, pool, "tok2", "again"); !errors.Is(err, ErrResetTokenInvalid) {
+		t.Errorf("expected sibling token to be used up, got %v", err)
+	}
+}
+
+func TestResetPassword_Expired(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := CreatePasswordResetToken(ctx, pool, uid, "old", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := PasswordResetTokenValid(ctx, pool, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("expected expired token to be invalid")
+	}
+	if _, err := ResetPassword(ctx, pool, "old", "newhash"); !errors.Is(err, ErrResetTokenInvalid) {
+		t.Errorf("expected ErrResetTokenInvalid, got %v", err)
+	}
+}
+
+func TestGetUserByEmail_CaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	mustCreateUser(t, pool, "alice")
+
+	u, err := GetUserByEmail(ctx, pool, "ALICE@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alice" {
+		t.Errorf("expected username 'alice', got %q", u.Username)
+	}
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// PreferencesRow holds a user's search and display preferences. An empty
+// SearchLanguage means DefaultLanguage.
+type PreferencesRow struct {
+	UserID         int64
+	SearchLanguage string
+	PageSize       int
+	ShowSnippets   bool
+	UILanguage     string
+	UpdatedAt      time.Time
+}
+
+var ErrPreferencesNotFound = errors.New("preferences not found")
+
+const preferencesColumns = "user_id, search_language, page_size, show_snippets, ui_language, updated_at"
+
+func scanPreferences(row pgx.Row) (*PreferencesRow, error) {
+	p := &PreferencesRow{}
+	if err := row.Scan(&p.UserID, &p.SearchLanguage, &p.PageSize, &p.ShowSnippets, &p.UILanguage, &p.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPreferencesNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetPreferences returns a user's saved preferences, or
+// ErrPreferencesNotFound if they never saved any.
+func GetPreferences(ctx context.Context, conn *pgxpool.Pool, userID int64) (*PreferencesRow, error) {
+	return scanPreferences(conn.QueryRow(ctx,
+		"SELECT "+preferencesColumns+" FROM user_preferences WHERE user_id = $1",
+		userID,
+	))
+}
+
+// SavePreferences inserts or replaces a user's preferences.
+func SavePreferences(ctx context.Context, conn *pgxpool.Pool, p PreferencesRow) error {
+	_, err := conn.Exec(ctx, `
+		INSERT INTO user_preferences (user_id, search_language, page_size, show_snippets, ui_language)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			search_language = EXCLUDED.search_language,
+			page_size = EXCLUDED.page_size,
+			show_snippets = EXCLUDED.show_snippets,
+			ui_language = EXCLUDED.ui_language,
+			updated_at = now()
+	`, p.UserID, p.SearchLanguage, p.PageSize, p.ShowSnippets, p.UILanguage)
+	return err
+}
+
+func init() { export.Register("preferences", exportPreferences) }
+
+type preferencesExport struct {
+	SearchLanguage string    `json:"search_language"`
+	PageSize       int       `json:"page_size"`
+	ShowSnippets   bool      `json:"show_snippets"`
+	UILanguage     string    `json:"ui_language"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// exportPreferences returns nil for users who never saved preferences.
+func exportPreferences(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	p, err := GetPreferences(ctx, conn, userID)
+	if errors.Is(err, ErrPreferencesNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return preferencesExport{
+		SearchLanguage: p.SearchLanguage,
+		PageSize:       p.PageSize,
+		ShowSnippets:   p.ShowSnippets,
+		UILanguage:     p.UILanguage,
+		UpdatedAt:      p.UpdatedAt,
+	}, nil
+}
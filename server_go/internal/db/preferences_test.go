@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPreferences_SaveAndGet(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if _, err := GetPreferences(ctx, pool, uid); !errors.Is(err, ErrPreferencesNotFound) {
+		t.Fatalf("expected ErrPreferencesNotFound before saving, got %v", err)
+	}
+
+	p := PreferencesRow{UserID: uid, SearchLanguage: "da", PageSize: 10, ShowSnippets: true, UILanguage: "da"}
+	if err := SavePreferences(ctx, pool, p); err != nil {
+		t.Fatal(err)
+	}
+	p.PageSize = 50
+	if err := SavePreferences(ctx, pool, p); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetPreferences(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SearchLanguage != "da" || got.PageSize != 50 || !got.ShowSnippets || got.UILanguage != "da" {
+		t.Errorf("unexpected preferences %+v", got)
+	}
+}
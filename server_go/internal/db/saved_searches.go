@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// How a saved search tells its owner about new matches. Every match also
+// shows up in the in-app notifications.
+const (
+	NotifyNone    = "none"
+	NotifyEmail   = "email"
+	NotifyWebhook = "webhook"
+)
+
+// SavedSearchRow is a query and language filter a user wants to be alerted
+// about. LastCheckedAt is nil until the first scheduled run.
+type SavedSearchRow struct {
+	ID            int64
+	UserID        int64
+	Query         string
+	Language      string
+	Notify        string
+	WebhookURL    string
+	CreatedAt     time.Time
+	LastCheckedAt *time.Time
+}
+
+var (
+	ErrSavedSearchNotFound = errors.New("saved search not found")
+	ErrSavedSearchExists   = errors.New("saved search already exists")
+)
+
+const savedSearchColumns = "id, user_id, query, language, notify, webhook_url, created_at, last_checked_at"
+
+func scanSavedSearch(row pgx.Row) (*SavedSearchRow, error) {
+	s := &SavedSearchRow{}
+	if err := row.Scan(&s.ID, &s.UserID, &s.Query, &s.Language, &s.Notify, &s.WebhookURL, &s.CreatedAt, &s.LastCheckedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSavedSearchNotFound
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func scanSavedSearches(rows pgx.Rows) ([]SavedSearchRow, error) {
+	defer rows.Close()
+
+	out := make([]SavedSearchRow, 0)
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *s)
+	}
+	return out, rows.Err()
+}
+
+// CreateSavedSearch saves s for s.UserID. Saving the same query and
+// language twice is ErrSavedSearchExists.
+func CreateSavedSearch(ctx context.Context, conn *pgxpool.Pool, s SavedSearchRow) (*SavedSearchRow, error) {
+	row, err := scanSavedSearch(conn.QueryRow(ctx, `
+		INSERT INTO saved_searches (user_id, query, language, notify, webhook_url)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, query, language) DO NOTHING
+		RETURNING `+savedSearchColumns,
+		s.UserID, s.Query, s.Language, s.Notify, s.WebhookURL,
+	))
+	if errors.Is(err, ErrSavedSearchNotFound) {
+		return nil, ErrSavedSearchExists
+	}
+	return row, err
+}
+
+// ListSavedSearches returns a user's saved searches, newest first.
+func ListSavedSearches(ctx context.Context, conn *pgxpool.Pool, userID int64) ([]SavedSearchRow, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT "+savedSearchColumns+" FROM saved_searches WHERE user_id = $1 ORDER BY id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanSavedSearches(rows)
+}
+
+func CountSavedSearches(ctx context.Context, conn *pgxpool.Pool, userID int64) (int64, error) {
+	var n int64
+	err := conn.QueryRow(ctx, "SELECT count(*) FROM saved_searches WHERE user_id = $1", userID).Scan(&n)
+	return n, err
+}
+
+// DeleteSavedSearch removes one of a user's saved searches. Saved searches
+// belonging to other users are reported as not found.
+func DeleteSavedSearch(ctx context.Context, conn *pgxpool.Pool, userID, id int64) error {
+	tag, err := conn.Exec(ctx, "DELETE FROM saved_searches WHERE user_id = $1 AND id = $2", userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSavedSearchNotFound
+	}
+	return nil
+}
+
+// ClaimDueSavedSearches marks up to limit saved searches that weren't
+// checked since checkedBefore as checked now and returns them, with
+// LastCheckedAt still holding the previous check. Rows locked by another
+// server are skipped, so two servers never run the same search at once.
+func ClaimDueSavedSearches(ctx context.Context, conn *pgxpool.Pool, checkedBefore time.Time, limit int) ([]SavedSearchRow, error) {
+	rows, err := conn.Query(ctx, `
+		WITH due AS (
+			SELECT id, last_checked_at FROM saved_searches
+			WHERE last_checked_at IS NULL OR last_checked_at < $1
+			ORDER BY last_checked_at NULLS FIRST
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE saved_searches s SET last_checked_at = now()
+		FROM due WHERE s.id = due.id
+		RETURNING s.id, s.user_id, s.query, s.language, s.notify, s.webhook_url, s.created_at, due.last_checked_at
+	`, checkedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanSavedSearches(rows)
+}
+
+// SeenPage is a page a saved search matched. LastUpdated is nil for pages
+// without a modification time.
+type SeenPage struct {
+	Title       string
+	LastUpdated *time.Time
+}
+
+// SeenPages returns the pages a saved search has matched so far, by title.
+func SeenPages(ctx context.Context, conn *pgxpool.Pool, savedSearchID int64) (map[string]*time.Time, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT page_title, last_updated FROM saved_search_seen WHERE saved_search_id = $1",
+		savedSearchID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]*time.Time{}
+	for rows.Next() {
+		var title string
+		var updated *time.Time
+		if err := rows.Scan(&title, &updated); err != nil {
+			return nil, err
+		}
+		out[title] = updated
+	}
+	return out, rows.Err()
+}
+
+// MarkPagesSeen records the version of each page a saved search has now
+// told its owner about.
+func MarkPagesSeen(ctx context.Context, conn *pgxpool.Pool, savedSearchID int64, pages []SeenPage) error {
+	if len(pages) == 0 {
+		return nil
+	}
+	titles := make([]string, len(pages))
+	updated := make([]*time.Time, len(pages))
+	for i, p := range pages {
+		titles[i], updated[i] = p.Title, p.LastUpdated
+	}
+	_, err := conn.Exec(ctx, `
+		INSERT INTO saved_search_seen (saved_search_id, page_title, last_updated)
+		SELECT $1, t.title, t.last_updated FROM unnest($2::text[], $3::timestamptz[]) AS t (title, last_updated)
+		ON CONFLICT (saved_search_id, page_title) DO UPDATE SET last_updated = EXCLUDED.last_updated
+	`, savedSearchID, titles, updated)
+	return err
+}
+
+func init() { export.Register("saved_searches", exportSavedSearches) }
+
+type savedSearchExport struct {
+	Query         string     `json:"query"`
+	Language      string     `json:"language"`
+	Notify        string     `json:"notify"`
+	WebhookURL    string     `json:"webhook_url,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+}
+
+func exportSavedSearches(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	rows, err := ListSavedSearches(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]savedSearchExport, len(rows))
+	for i, s := range rows {
+		out[i] = savedSearchExport{
+			Query:         s.Query,
+			Language:      s.Language,
+			Notify:        s.Notify,
+			WebhookURL:    s.WebhookURL,
+			CreatedAt:     s.CreatedAt,
+			LastCheckedAt: s.LastCheckedAt,
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateSavedSearch_Duplicate(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	s := SavedSearchRow{UserID: uid, Query: "go", Language: "en", Notify: NotifyEmail}
+	if _, err := CreateSavedSearch(ctx, pool, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateSavedSearch(ctx, pool, s); !errors.Is(err, ErrSavedSearchExists) {
+		t.Errorf("expected ErrSavedSearchExists, got %v", err)
+	}
+
+	n, err := CountSavedSearches(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 saved search, got %d", n)
+	}
+}
+
+func TestDeleteSavedSearch_OtherUser(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	alice := mustCreateUser(t, pool, "alice")
+	bob := mustCreateUser(t, pool, "bob")
+
+	s, err := CreateSavedSearch(ctx, pool, SavedSearchRow{UserID: alice, Query: "go", Notify: NotifyNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteSavedSearch(ctx, pool, bob, s.ID); !errors.Is(err, ErrSavedSearchNotFound) {
+		t.Errorf("expected ErrSavedSearchNotFound for another user's saved search, got %v", err)
+	}
+	if err := DeleteSavedSearch(ctx, pool, alice, s.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimDueSavedSearches(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	s, err := CreateSavedSearch(ctx, pool, SavedSearchRow{UserID: uid, Query: "go", Notify: NotifyNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := ClaimDueSavedSearches(ctx, pool, time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].ID != s.ID || due[0].LastCheckedAt != nil {
+		t.Fatalf("expected the new saved search with no previous check, got %+v", due)
+	}
+
+	due, err = ClaimDueSavedSearches(ctx, pool, time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("expected nothing due right after a check, got %+v", due)
+	}
+
+	due, err = ClaimDueSavedSearches(ctx, pool, time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].LastCheckedAt == nil {
+		t.Fatalf("expected the saved search with its previous check, got %+v", due)
+	}
+}
+
+func TestMarkPagesSeen(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	s, err := CreateSavedSearch(ctx, pool, SavedSearchRow{UserID: uid, Query: "go", Notify: NotifyNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := MarkPagesSeen(ctx, pool, s.ID, []SeenPage{{Title: "Go"}, {Title: "Rust", LastUpdated: &updated}}); err != nil {
+		t.Fatal(err)
+	}
+	later := updated.Add(time.Hour)
+	if err := MarkPagesSeen(ctx, pool, s.ID, []SeenPage{{Title: "Rust", LastUpdated: &later}}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen, err := SeenPages(ctx, pool, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen["Go"] != nil || seen["Rust"] == nil || !seen["Rust"].Equal(later) {
+		t.Fatalf("unexpected seen pages %v", seen)
+	}
+}
+
+func TestNotifications_ListAndMarkRead(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	s, err := CreateSavedSearch(ctx, pool, SavedSearchRow{UserID: uid, Query: "go", Notify: NotifyNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateNotification(ctx, pool, NotificationRow{UserID: uid, SavedSearchID: &s.ID, Title: "1 new result", URL: "/?q=go"}); err != nil {
+		t.Fatal(err)
+	}
+
+	unread, err := CountUnreadNotifications(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unread != 1 {
+		t.Errorf("expected 1 unread notification, got %d", unread)
+	}
+	if n, err := MarkNotificationsRead(ctx, pool, uid); err != nil || n != 1 {
+		t.Fatalf("expected 1 notification marked read, got %d, %v", n, err)
+	}
+
+	if err := DeleteSavedSearch(ctx, pool, uid, s.ID); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := ListNotifications(ctx, pool, uid, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].SavedSearchID != nil || rows[0].ReadAt == nil {
+		t.Fatalf("expected the read notification to outlive its saved search, got %+v", rows)
+	}
+}
@@ -8,22 +8,52 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DefaultPageSize is how many results a search returns unless Limit says
+// otherwise.
+const DefaultPageSize = 30
+
+// SearchParams describes a page search. Zero values mean "no filter", except
+// Language, which falls back to DefaultLanguage, and Limit, which falls back
+// to DefaultPageSize.
+type SearchParams struct {
+	Query    string
+	Language *string
+	Tag      string
+	Limit    int
+}
+
 func SearchPages(ctx context.Context, conn *pgxpool.Pool, q string, language *string) ([]map[string]any, error) {
-	q = strings.TrimSpace(q)
+	return Search(ctx, conn, SearchParams{Query: q, Language: language})
+}
+
+func Search(ctx context.Context, conn *pgxpool.Pool, p SearchParams) ([]map[string]any, error) {
+	q := strings.TrimSpace(p.Query)
 	like := "%" + q + "%"
 
-	// Legacy default: "en"
-	lang := "en"
-	if language != nil && strings.TrimSpace(*language) != "" {
-		lang = strings.TrimSpace(*language)
+	lang := DefaultLanguage
+	if p.Language != nil && strings.TrimSpace(*p.Language) != "" {
+		lang = strings.TrimSpace(*p.Language)
+	}
+	limit := DefaultPageSize
+	if p.Limit > 0 {
+		limit = p.Limit
 	}
 
 	rows, err := conn.Query(ctx, `
-		SELECT title, url, language, last_updated, content
+		SELECT title, url, language, last_updated, content,
+			COALESCE((
+				SELECT json_agg(json_build_object('slug', t.slug, 'name', t.name) ORDER BY t.name)
+				FROM page_tags pt JOIN tags t ON t.id = pt.tag_id
+				WHERE pt.page_title = pages.title
+			), '[]'::json)
 		FROM pages
 		WHERE language = $1 AND title ILIKE $2
-		LIMIT 30
-	`, lang, like)
+			AND ($3 = '' OR EXISTS (
+				SELECT 1 FROM page_tags pt JOIN tags t ON t.id = pt.tag_id
+				WHERE pt.page_title = pages.title AND t.slug = $3
+			))
+		LIMIT $4
+	`, lang, like, strings.TrimSpace(p.Tag), limit)
 	if err != nil {
 		return nil, err
 	}
@@ -34,8 +64,9 @@ func SearchPages(ctx context.Context, conn *pgxpool.Pool, q string, language *st
 		var title, url, language string
 		var lastUpdated *time.Time
 		var content string
+		var tags []map[string]any
 
-		if err := rows.Scan(&title, &url, &language, &lastUpdated, &content); err != nil {
+		if err := rows.Scan(&title, &url, &language, &lastUpdated, &content, &tags); err != nil {
 			return nil, err
 		}
 
@@ -44,6 +75,7 @@ func SearchPages(ctx context.Context, conn *pgxpool.Pool, q string, language *st
 			"url":      url,
 			"language": language,
 			"content":  content,
+			"tags":     tags,
 		}
 		if lastUpdated != nil {
 			row["last_updated"] = lastUpdated.Format(time.RFC3339)
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// SearchHistoryRow is one search made by a logged-in user.
+type SearchHistoryRow struct {
+	ID          int64
+	UserID      int64
+	Query       string
+	Language    string
+	ResultCount int
+	SearchedAt  time.Time
+}
+
+var ErrSearchHistoryNotFound = errors.New("search history entry not found")
+
+const searchHistoryColumns = "id, user_id, query, language, result_count, searched_at"
+
+func scanSearchHistory(row pgx.Row) (*SearchHistoryRow, error) {
+	h := &SearchHistoryRow{}
+	if err := row.Scan(&h.ID, &h.UserID, &h.Query, &h.Language, &h.ResultCount, &h.SearchedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSearchHistoryNotFound
+		}
+		return nil, err
+	}
+	return h, nil
+}
+
+// RecordSearch adds a search to the user's history unless they turned it
+// off. It reports whether the search was recorded.
+func RecordSearch(ctx context.Context, conn *pgxpool.Pool, userID int64, query, language string, resultCount int) (bool, error) {
+	tag, err := conn.Exec(ctx, `
+		INSERT INTO search_history (user_id, query, language, result_count)
+		SELECT id, $2, $3, $4 FROM users WHERE id = $1 AND search_history_enabled
+	`, userID, query, language, resultCount)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListSearchHistory returns up to limit of the user's searches, newest
+// first. A non-zero beforeID pages on from the entry with that id.
+func ListSearchHistory(ctx context.Context, conn *pgxpool.Pool, userID, beforeID int64, limit int) ([]SearchHistoryRow, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT `+searchHistoryColumns+` FROM search_history
+		WHERE user_id = $1 AND ($2::bigint = 0 OR id < $2::bigint)
+		ORDER BY id DESC
+		LIMIT $3
+	`, userID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]SearchHistoryRow, 0)
+	for rows.Next() {
+		h, err := scanSearchHistory(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *h)
+	}
+	return out, rows.Err()
+}
+
+// RecentQueries returns the user's last limit distinct queries, most
+// recently used first.
+func RecentQueries(ctx context.Context, conn *pgxpool.Pool, userID int64, limit int) ([]string, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT query FROM search_history
+		WHERE user_id = $1
+		GROUP BY query
+		ORDER BY max(id) DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]string, 0)
+	for rows.Next() {
+		var q string
+		if err := rows.Scan(&q); err != nil {
+			return nil, err
+		}
+		out = append(out, q)
+	}
+	return out, rows.Err()
+}
+
+// DeleteSearchHistoryEntry removes one of a user's searches. Entries
+// belonging to other users are reported as not found.
+func DeleteSearchHistoryEntry(ctx context.Context, conn *pgxpool.Pool, userID, id int64) error {
+	tag, err := conn.Exec(ctx, "DELETE FROM search_history WHERE user_id = $1 AND id = $2", userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSearchHistoryNotFound
+	}
+	return nil
+}
+
+// ClearSearchHistory removes all of a user's searches and returns how many
+// there were.
+func ClearSearchHistory(ctx context.Context, conn *pgxpool.Pool, userID int64) (int64, error) {
+	tag, err := conn.Exec(ctx, "DELETE FROM search_history WHERE user_id = $1", userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SetSearchHistoryEnabled turns recording of the user's searches on or off.
+// Turning it off keeps what is already stored.
+func SetSearchHistoryEnabled(ctx context.Context, conn *pgxpool.Pool, userID int64, enabled bool) error {
+	tag, err := conn.Exec(ctx, "UPDATE users SET search_history_enabled = $2 WHERE id = $1", userID, enabled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func init() { export.Register("search_history", exportSearchHistory) }
+
+type searchHistoryExport struct {
+	Query       string    `json:"query"`
+	Language    string    `json:"language"`
+	ResultCount int       `json:"result_count"`
+	SearchedAt  time.Time `json:"searched_at"`
+}
+
+func exportSearchHistory(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT "+searchHistoryColumns+" FROM search_history WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]searchHistoryExport, 0)
+	for rows.Next() {
+		h, err := scanSearchHistory(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, searchHistoryExport{Query: h.Query, Language: h.Language, ResultCount: h.ResultCount, SearchedAt: h.SearchedAt})
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRecordSearch_ListNewestFirst(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	for _, q := range []string{"go", "rust", "go"} {
+		ok, err := RecordSearch(ctx, pool, uid, q, "en", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("expected %q to be recorded", q)
+		}
+	}
+
+	rows, err := ListSearchHistory(ctx, pool, uid, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Query != "go" || rows[1].Query != "rust" {
+		t.Fatalf("unexpected history %+v", rows)
+	}
+	if rows[0].Language != "en" || rows[0].ResultCount != 3 {
+		t.Errorf("unexpected entry %+v", rows[0])
+	}
+
+	older, err := ListSearchHistory(ctx, pool, uid, rows[0].ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(older) != 2 {
+		t.Errorf("expected 2 entries before %d, got %d", rows[0].ID, len(older))
+	}
+
+	recent, err := RecentQueries(ctx, pool, uid, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || recent[0] != "go" || recent[1] != "rust" {
+		t.Errorf("expected [go rust], got %v", recent)
+	}
+}
+
+func TestRecordSearch_OptedOut(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := SetSearchHistoryEnabled(ctx, pool, uid, false); err != nil {
+		t.Fatal(err)
+	}
+	u, err := GetUserByID(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.SearchHistoryEnabled {
+		t.Fatal("expected search history to be off")
+	}
+
+	ok, err := RecordSearch(ctx, pool, uid, "go", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("expected the search not to be recorded")
+	}
+}
+
+func TestDeleteSearchHistoryEntry_OtherUser(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	alice := mustCreateUser(t, pool, "alice")
+	bob := mustCreateUser(t, pool, "bob")
+
+	if _, err := RecordSearch(ctx, pool, alice, "go", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := ListSearchHistory(ctx, pool, alice, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteSearchHistoryEntry(ctx, pool, bob, rows[0].ID); !errors.Is(err, ErrSearchHistoryNotFound) {
+		t.Errorf("expected ErrSearchHistoryNotFound for another user's entry, got %v", err)
+	}
+	if err := DeleteSearchHistoryEntry(ctx, pool, alice, rows[0].ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClearSearchHistory_And_DeleteUserCascades(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	for _, q := range []string{"go", "rust"} {
+		if _, err := RecordSearch(ctx, pool, uid, q, "", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := ClearSearchHistory(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 entries cleared, got %d", n)
+	}
+
+	if _, err := RecordSearch(ctx, pool, uid, "go", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteUser(ctx, pool, uid); err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM search_history").Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Errorf("expected history to be deleted with the user, got %d rows", left)
+	}
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SearchLogRow is one search made on the site.
+type SearchLogRow struct {
+	ID         int64
+	SearchedAt time.Time
+	// Query is empty when only QueryHash, a keyed hash of the query, is
+	// logged.
+	Query       string
+	QueryHash   string
+	Language    string
+	ResultCount int
+}
+
+// RecordSearchLog stores e. A zero SearchedAt means now; importers set it
+// to keep the original time.
+func RecordSearchLog(ctx context.Context, conn *pgxpool.Pool, e SearchLogRow) error {
+	var at *time.Time
+	if !e.SearchedAt.IsZero() {
+		at = &e.SearchedAt
+	}
+	_, err := conn.Exec(ctx, `
+		INSERT INTO search_log (searched_at, query, query_hash, language, result_count)
+		VALUES (COALESCE($1::timestamptz, now()), $2, $3, $4, $5)
+	`, at, e.Query, e.QueryHash, e.Language, e.ResultCount)
+	return err
+}
+
+// RecordSearchLogs stores a batch of entries in one round trip. Unlike
+// RecordSearchLog, every entry must have its SearchedAt set.
+func RecordSearchLogs(ctx context.Context, conn *pgxpool.Pool, entries []SearchLogRow) error {
+	_, err := conn.CopyFrom(ctx,
+		pgx.Identifier{"search_log"},
+		[]string{"searched_at", "query", "query_hash", "language", "result_count"},
+		pgx.CopyFromSlice(len(entries), func(i int) ([]any, error) {
+			e := entries[i]
+			return []any{e.SearchedAt, e.Query, e.QueryHash, e.Language, int32(e.ResultCount)}, nil // #nosec G115 -- Result counts are capped by the search LIMIT.
+		}),
+	)
+	return err
+}
+
+// DeleteSearchLogBefore removes searches made before cutoff and returns
+// how many were removed.
+func DeleteSearchLogBefore(ctx context.Context, conn *pgxpool.Pool, cutoff time.Time) (int64, error) {
+	tag, err := conn.Exec(ctx, "DELETE FROM search_log WHERE searched_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// QueryCount is how often a query was searched for. Queries are compared
+// case-insensitively and without surrounding spaces; Query is the
+// lowercased form, or "#" and the hash for searches logged only as a hash.
+type QueryCount struct {
+	Query      string
+	Count      int64
+	AvgResults float64
+}
+
+// DayCount is the number of searches on one UTC day.
+type DayCount struct {
+	Day         time.Time
+	Count       int64
+	ZeroResults int64
+}
+
+// LanguageCount is the number of searches in one language; Language is
+// empty for searches without a language filter.
+type LanguageCount struct {
+	Language string
+	Count    int64
+}
+
+// SearchAnalytics sums up the search log between since and until.
+type SearchAnalytics struct {
+	Total       int64
+	ZeroResults int64
+	AvgResults  float64
+	TopQueries  []QueryCount
+	// TopZeroResultQueries are the most common queries that found
+	// nothing: pages worth writing.
+	TopZeroResultQueries []QueryCount
+	// PerDay has an entry for every day in the window, oldest first.
+	PerDay    []DayCount
+	Languages []LanguageCount
+}
+
+// GetSearchAnalytics sums up the searches made in [since, until). The top
+// query lists hold at most limit entries.
+func GetSearchAnalytics(ctx context.Context, conn *pgxpool.Pool, since, until time.Time, limit int) (*SearchAnalytics, error) {
+	a := &SearchAnalytics{}
+	err := conn.QueryRow(ctx, `
+		SELECT count(*), count(*) FILTER (WHERE result_count = 0), COALESCE(avg(result_count), 0)::float8
+		FROM search_log
+		WHERE searched_at >= $1 AND searched_at < $2
+	`, since, until).Scan(&a.Total, &a.ZeroResults, &a.AvgResults)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.TopQueries, err = topQueries(ctx, conn, since, until, false, limit); err != nil {
+		return nil, err
+	}
+	if a.TopZeroResultQueries, err = topQueries(ctx, conn, since, until, true, limit); err != nil {
+		return nil, err
+	}
+	if a.PerDay, err = searchesPerDay(ctx, conn, since, until); err != nil {
+		return nil, err
+	}
+	if a.Languages, err = searchLanguages(ctx, conn, since, until); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func topQueries(ctx context.Context, conn *pgxpool.Pool, since, until time.Time, zeroOnly bool, limit int) ([]QueryCount, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT COALESCE(NULLIF(lower(btrim(query)), ''), '#' || query_hash) AS q, count(*) AS n, avg(result_count)::float8
+		FROM search_log
+		WHERE searched_at >= $1 AND searched_at < $2
+			AND (NOT $3::boolean OR result_count = 0)
+		GROUP BY q
+		ORDER BY n DESC, q
+		LIMIT $4
+	`, since, until, zeroOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]QueryCount, 0)
+	for rows.Next() {
+		var c QueryCount
+		if err := rows.Scan(&c.Query, &c.Count, &c.AvgResults); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func searchesPerDay(ctx context.Context, conn *pgxpool.Pool, since, until time.Time) ([]DayCount, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT days.day, count(l.id), count(l.id) FILTER (WHERE l.result_count = 0)
+		FROM generate_series(
+			date_trunc('day', $1::timestamptz AT TIME ZONE 'UTC'),
+			$2::timestamptz AT TIME ZONE 'UTC' - interval '1 microsecond',
+			interval '1 day'
+		) AS days (day)
+		LEFT JOIN search_log l
+			ON l.searched_at >= $1 AND l.searched_at < $2
+			AND date_trunc('day', l.searched_at AT TIME ZONE 'UTC') = days.day
+		GROUP BY days.day
+		ORDER BY days.day
+	`, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]DayCount, 0)
+	for rows.Next() {
+		var d DayCount
+		if err := rows.Scan(&d.Day, &d.Count, &d.ZeroResults); err != nil {
+			return nil, err
+		}
+		d.Day = time.Date(d.Day.Year(), d.Day.Month(), d.Day.Day(), 0, 0, 0, 0, time.UTC)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func searchLanguages(ctx context.Context, conn *pgxpool.Pool, since, until time.Time) ([]LanguageCount, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT language, count(*) AS n
+		FROM search_log
+		WHERE searched_at >= $1 AND searched_at < $2
+		GROUP BY language
+		ORDER BY n DESC, language
+	`, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]LanguageCount, 0)
+	for rows.Next() {
+		var c LanguageCount
+		if err := rows.Scan(&c.Language, &c.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetSearchAnalytics(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	day3 := day1.Add(48 * time.Hour)
+	for _, e := range []SearchLogRow{
+		{SearchedAt: day1, Query: "Go", Language: "en", ResultCount: 4},
+		{SearchedAt: day1, Query: " go ", Language: "en", ResultCount: 2},
+		{SearchedAt: day1, Query: "fortran", ResultCount: 0},
+		{SearchedAt: day3, Query: "fortran", Language: "da", ResultCount: 0},
+		{SearchedAt: day3, Query: "cobol", Language: "en", ResultCount: 0},
+		// Outside the window.
+		{SearchedAt: day1.Add(-24 * time.Hour), Query: "go", Language: "en", ResultCount: 1},
+	} {
+		if err := RecordSearchLog(ctx, pool, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	a, err := GetSearchAnalytics(ctx, pool, since, since.AddDate(0, 0, 3), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Total != 5 || a.ZeroResults != 3 {
+		t.Errorf("expected 5 searches, 3 without results, got %d and %d", a.Total, a.ZeroResults)
+	}
+	if a.AvgResults != 1.2 {
+		t.Errorf("expected 1.2 results on average, got %v", a.AvgResults)
+	}
+	if len(a.TopQueries) != 3 || a.TopQueries[0].Query != "fortran" || a.TopQueries[0].Count != 2 ||
+		a.TopQueries[1].Query != "go" || a.TopQueries[1].AvgResults != 3 {
+		t.Errorf("unexpected top queries %+v", a.TopQueries)
+	}
+	if len(a.TopZeroResultQueries) != 2 || a.TopZeroResultQueries[0].Query != "fortran" || a.TopZeroResultQueries[1].Query != "cobol" {
+		t.Errorf("unexpected zero-result queries %+v", a.TopZeroResultQueries)
+	}
+	if len(a.PerDay) != 3 || a.PerDay[0].Count != 3 || a.PerDay[1].Count != 0 || a.PerDay[2].Count != 2 || a.PerDay[2].ZeroResults != 2 {
+		t.Errorf("unexpected searches per day %+v", a.PerDay)
+	}
+	if !a.PerDay[1].Day.Equal(since.AddDate(0, 0, 1)) {
+		t.Errorf("expected the second day to be %v, got %v", since.AddDate(0, 0, 1), a.PerDay[1].Day)
+	}
+	if len(a.Languages) != 3 || a.Languages[0].Language != "en" || a.Languages[0].Count != 3 {
+		t.Errorf("unexpected languages %+v", a.Languages)
+	}
+}
+
+func TestRecordSearchLog_DefaultsToNow(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	if err := RecordSearchLog(ctx, pool, SearchLogRow{Query: "go", ResultCount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := GetSearchAnalytics(ctx, pool, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Total != 1 {
+		t.Errorf("expected the search to be logged now, got %d searches", a.Total)
+	}
+}
+
+func TestRecordSearchLogs(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	err := RecordSearchLogs(ctx, pool, []SearchLogRow{
+		{SearchedAt: at, Query: "go", Language: "en", ResultCount: 2},
+		{SearchedAt: at.Add(time.Minute), Query: "rust", ResultCount: 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := GetSearchAnalytics(ctx, pool, at, at.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Total != 2 || a.ZeroResults != 1 {
+		t.Errorf("expected 2 searches, 1 without results, got %d and %d", a.Total, a.ZeroResults)
+	}
+}
+
+func TestSearchAnalytics_CountsHashedQueries(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, e := range []SearchLogRow{
+		{SearchedAt: at, QueryHash: "abc123"},
+		{SearchedAt: at, QueryHash: "abc123"},
+		{SearchedAt: at, Query: "go", ResultCount: 1},
+	} {
+		if err := RecordSearchLog(ctx, pool, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, err := GetSearchAnalytics(ctx, pool, at, at.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.TopQueries) != 2 || a.TopQueries[0].Query != "#abc123" || a.TopQueries[0].Count != 2 {
+		t.Errorf("unexpected top queries %+v", a.TopQueries)
+	}
+}
+
+func TestDeleteSearchLogBefore(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	now := time.Now()
+	for _, at := range []time.Time{now.Add(-100 * 24 * time.Hour), now} {
+		if err := RecordSearchLog(ctx, pool, SearchLogRow{SearchedAt: at, Query: "go"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := DeleteSearchLogBefore(ctx, pool, now.Add(-90*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 purged search, got %d", n)
+	}
+}
@@ -122,3 +122,17 @@ func TestSearchPages_PartialMatch(t *testing.T) {
 		t.Fatalf("expected 2 results for partial match, got %d", len(results))
 	}
 }
+
+func TestSearch_Limit(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	seedPages(t, pool)
+
+	results, err := Search(ctx, pool, SearchParams{Query: "Programming", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result with Limit 1, got %d", len(results))
+	}
+}
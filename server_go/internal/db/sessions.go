@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
+)
+
+// SessionRow is a server-side session. ID is the hash of the token held in
+// the cookie, never the token itself.
+type SessionRow struct {
+	ID         string
+	UserID     *int64
+	Data       []byte
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+
+const sessionColumns = "id, user_id, data, user_agent, created_at, last_seen_at, expires_at"
+
+func scanSession(row pgx.Row) (*SessionRow, error) {
+	s := &SessionRow{}
+	if err := row.Scan(&s.ID, &s.UserID, &s.Data, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetSession returns an unexpired session by id.
+func GetSession(ctx context.Context, conn *pgxpool.Pool, id string) (*SessionRow, error) {
+	return scanSession(conn.QueryRow(ctx,
+		"SELECT "+sessionColumns+" FROM sessions WHERE id = $1 AND expires_at > now()",
+		id,
+	))
+}
+
+// SaveSession inserts or updates a session. created_at is kept on update.
+func SaveSession(ctx context.Context, conn *pgxpool.Pool, s SessionRow) error {
+	_, err := conn.Exec(ctx, `
+		INSERT INTO sessions (id, user_id, data, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			data = EXCLUDED.data,
+			user_agent = EXCLUDED.user_agent,
+			last_seen_at = now(),
+			expires_at = EXCLUDED.expires_at
+	`, s.ID, s.UserID, s.Data, s.UserAgent, s.ExpiresAt)
+	return err
+}
+
+func TouchSession(ctx context.Context, conn *pgxpool.Pool, id string) error {
+	_, err := conn.Exec(ctx, "UPDATE sessions SET last_seen_at = now() WHERE id = $1", id)
+	return err
+}
+
+func DeleteSession(ctx context.Context, conn *pgxpool.Pool, id string) error {
+	_, err := conn.Exec(ctx, "DELETE FROM sessions WHERE id = $1", id)
+	return err
+}
+
+// ListUserSessions returns a user's unexpired sessions, most recently used
+// first.
+func ListUserSessions(ctx context.Context, conn *pgxpool.Pool, userID int64) ([]SessionRow, error) {
+	rows, err := conn.Query(ctx,
+		"SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 AND expires_at > now() ORDER BY last_seen_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]SessionRow, 0)
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *s)
+	}
+	return out, rows.Err()
+}
+
+// DeleteUserSession revokes one of a user's sessions. Sessions belonging to
+// other users are reported as not found.
+func DeleteUserSession(ctx context.Context, conn *pgxpool.Pool, userID int64, id string) error {
+	tag, err := conn.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1 AND id = $2", userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// DeleteUserSessions revokes every session of a user and returns how many
+// were removed.
+func DeleteUserSessions(ctx context.Context, conn *pgxpool.Pool, userID int64) (int64, error) {
+	tag, err := conn.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1", userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func DeleteExpiredSessions(ctx context.Context, conn *pgxpool.Pool) (int64, error) {
+	tag, err := conn.Exec(ctx, "DELETE FROM sessions WHERE expires_at <= now()")
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func init() { export.Register("sessions", exportSessions) }
+
+type sessionExport struct {
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// exportSessions leaves out the session ids and data, which are
+// credentials and internal state rather than information about the user.
+func exportSessions(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	rows, err := ListUserSessions(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]sessionExport, len(rows))
+	for i, r := range rows {
+		out[i] = sessionExport{UserAgent: r.UserAgent, CreatedAt: r.CreatedAt, LastSeenAt: r.LastSeenAt, ExpiresAt: r.ExpiresAt}
+	}
+	return out, nil
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSaveSession_And_Get(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	err := SaveSession(ctx, pool, SessionRow{
+		ID:        "s1",
+		UserID:    &uid,
+		Data:      []byte("data"),
+		UserAgent: "curl/8",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := GetSession(ctx, pool, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.UserID == nil || *s.UserID != uid {
+		t.Errorf("expected user id %d, got %v", uid, s.UserID)
+	}
+	if s.UserAgent != "curl/8" {
+		t.Errorf("expected user agent 'curl/8', got %q", s.UserAgent)
+	}
+}
+
+func TestGetSession_Expired(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	if err := SaveSession(ctx, pool, SessionRow{ID: "old", Data: []byte{}, ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetSession(ctx, pool, "old"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound for expired session, got %v", err)
+	}
+
+	n, err := DeleteExpiredSessions(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 expired session swept, got %d", n)
+	}
+}
+
+func TestDeleteUserSession_OtherUser(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	alice := mustCreateUser(t, pool, "alice")
+	bob := mustCreateUser(t, pool, "bob")
+
+	if err := SaveSession(ctx, pool, SessionRow{ID: "a1", UserID: &alice, Data: []byte{}, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteUserSession(ctx, pool, bob, "a1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound when revoking another user's session, got %v", err)
+	}
+	if err := DeleteUserSession(ctx, pool, alice, "a1"); err != nil {
+		t.Errorf("expected owner to revoke session, got %v", err)
+	}
+}
+
+func TestDeleteUserSessions(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	for _, id := range []string{"a1", "a2"} {
+		if err := SaveSession(ctx, pool, SessionRow{ID: id, UserID: &uid, Data: []byte{}, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := DeleteUserSessions(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 sessions revoked, got %d", n)
+	}
+	rows, err := ListUserSessions(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("expected no sessions left, got %d", len(rows))
+	}
+}
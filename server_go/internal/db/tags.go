@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TagRow struct {
+	ID        int64
+	Slug      string
+	Name      string
+	PageCount int64
+}
+
+var (
+	ErrTagNotFound  = errors.New("tag not found")
+	ErrPageNotFound = errors.New("page not found")
+)
+
+// Slugify turns a display name like "Go & Rust" into "go-rust".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func ListTags(ctx context.Context, conn *pgxpool.Pool) ([]TagRow, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT t.id, t.slug, t.name, COUNT(pt.page_title)
+		FROM tags t
+		LEFT JOIN page_tags pt ON pt.tag_id = t.id
+		GROUP BY t.id
+		ORDER BY t.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]TagRow, 0)
+	for rows.Next() {
+		var t TagRow
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &t.PageCount); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func GetTagBySlug(ctx context.Context, conn *pgxpool.Pool, slug string) (*TagRow, error) {
+	row := conn.QueryRow(ctx, "SELECT id, slug, name FROM tags WHERE slug = $1", slug)
+
+	t := &TagRow{}
+	if err := row.Scan(&t.ID, &t.Slug, &t.Name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// EnsureTag returns the tag for name's slug, creating it if needed. An
+// existing tag keeps its original display name.
+func EnsureTag(ctx context.Context, conn *pgxpool.Pool, name string) (*TagRow, error) {
+	name = strings.TrimSpace(name)
+	row := conn.QueryRow(ctx, `
+		INSERT INTO tags (slug, name) VALUES ($1, $2)
+		ON CONFLICT (slug) DO UPDATE SET slug = EXCLUDED.slug
+		RETURNING id, slug, name
+	`, Slugify(name), name)
+
+	t := &TagRow{}
+	if err := row.Scan(&t.ID, &t.Slug, &t.Name); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func DeleteTag(ctx context.Context, conn *pgxpool.Pool, slug string) error {
+	tag, err := conn.Exec(ctx, "DELETE FROM tags WHERE slug = $1", slug)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTagNotFound
+	}
+	return nil
+}
+
+func AddPageTag(ctx context.Context, conn *pgxpool.Pool, pageTitle string, tagID int64) error {
+	tag, err := conn.Exec(ctx, `
+		INSERT INTO page_tags (page_title, tag_id)
+		SELECT title, $2 FROM pages WHERE title = $1
+		ON CONFLICT DO NOTHING
+	`, pageTitle, tagID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		// Either the page is missing or the tag was already attached.
+		var exists bool
+		if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pages WHERE title = $1)", pageTitle).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrPageNotFound
+		}
+	}
+	return nil
+}
+
+func RemovePageTag(ctx context.Context, conn *pgxpool.Pool, pageTitle string, tagID int64) error {
+	_, err := conn.Exec(ctx,
+		"DELETE FROM page_tags WHERE page_title = $1 AND tag_id = $2",
+		pageTitle, tagID,
+	)
+	return err
+}
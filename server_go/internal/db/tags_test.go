@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Go":                "go",
+		"  Go & Rust  ":     "go-rust",
+		"Søgning/Indeks":    "søgning-indeks",
+		"---":               "",
+		"Web 2.0 Platforms": "web-2-0-platforms",
+	}
+	for in, want := range cases {
+		if got := Slugify(in); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEnsureTag_Idempotent(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	first, err := EnsureTag(ctx, pool, "Programming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := EnsureTag(ctx, pool, "programming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("expected same tag id, got %d and %d", first.ID, second.ID)
+	}
+	if second.Name != "Programming" {
+		t.Errorf("expected original name 'Programming' to be kept, got %q", second.Name)
+	}
+}
+
+func TestAddPageTag_UnknownPage(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	tag, err := EnsureTag(ctx, pool, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddPageTag(ctx, pool, "Missing Page", tag.ID); !errors.Is(err, ErrPageNotFound) {
+		t.Errorf("expected ErrPageNotFound, got %v", err)
+	}
+}
+
+func TestSearch_FiltersByTag(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	seedPages(t, pool)
+
+	tag, err := EnsureTag(ctx, pool, "Compiled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddPageTag(ctx, pool, "Go Programming", tag.ID); err != nil {
+		t.Fatal(err)
+	}
+	// Attaching twice is a no-op.
+	if err := AddPageTag(ctx, pool, "Go Programming", tag.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Search(ctx, pool, SearchParams{Query: "Programming", Tag: "compiled"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0]["title"] != "Go Programming" {
+		t.Fatalf("expected only 'Go Programming', got %v", results)
+	}
+	tags, _ := results[0]["tags"].([]map[string]any)
+	if len(tags) != 1 || tags[0]["slug"] != "compiled" {
+		t.Errorf("expected tags [compiled], got %v", results[0]["tags"])
+	}
+}
+
+func TestDeleteTag_NotFound(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	if err := DeleteTag(ctx, pool, "nope"); !errors.Is(err, ErrTagNotFound) {
+		t.Errorf("expected ErrTagNotFound, got %v", err)
+	}
+}
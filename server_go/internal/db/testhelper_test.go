@@ -44,7 +44,7 @@ func newTestPool(t *testing.T) *pgxpool.Pool {
 	}
 	t.Cleanup(pool.Close)
 
-	if _, err := pool.Exec(ctx, "TRUNCATE users, pages RESTART IDENTITY CASCADE"); err != nil {
+	if _, err := pool.Exec(ctx, "TRUNCATE users, pages, tags, sessions, password_reset_tokens, login_throttles, api_tokens, user_identities, recovery_codes, auth_events, search_history, bookmarks, saved_searches, notifications, user_preferences, search_log RESTART IDENTITY CASCADE"); err != nil {
 		t.Fatalf("truncate: %v", err)
 	}
 
@@ -57,3 +57,17 @@ func migrationsDir() string {
 	_, thisFile, _, _ := runtime.Caller(0)
 	return filepath.Join(filepath.Dir(thisFile), "..", "..", "migrations")
 }
+
+// mustCreateUser inserts a user and returns its id.
+func mustCreateUser(t *testing.T, pool *pgxpool.Pool, username string) int64 {
+	t.Helper()
+	ctx := context.Background()
+	if err := CreateUser(ctx, pool, username, username+"@example.com", "hash"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := GetUserByUsername(ctx, pool, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.ID
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StartTOTPEnrollment stores a new, not yet enabled secret. It does nothing
+// for users who already have two-factor login on.
+func StartTOTPEnrollment(ctx context.Context, conn *pgxpool.Pool, userID int64, secret string) error {
+	_, err := conn.Exec(ctx,
+		"UPDATE users SET totp_secret = $2 WHERE id = $1 AND totp_enabled_at IS NULL",
+		userID, secret,
+	)
+	return err
+}
+
+// EnableTOTP turns two-factor login on once the user proved their app works
+// with a code from step, and stores their recovery codes.
+func EnableTOTP(ctx context.Context, conn *pgxpool.Pool, userID, step int64, recoveryCodeHashes []string) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users SET totp_enabled_at = now(), totp_last_step = $2
+		WHERE id = $1 AND totp_secret <> '' AND totp_enabled_at IS NULL
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DisableTOTP turns two-factor login off and forgets the secret and
+// recovery codes.
+func DisableTOTP(ctx context.Context, conn *pgxpool.Pool, userID int64) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE users SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1",
+		userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// AcceptTOTPStep records step as used. It reports false when a code from
+// that step or a later one was already accepted, i.e. on replay.
+func AcceptTOTPStep(ctx context.Context, conn *pgxpool.Pool, userID, step int64) (bool, error) {
+	tag, err := conn.Exec(ctx,
+		"UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2",
+		userID, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode spends a recovery code. It reports false when the code
+// doesn't exist or was already used.
+func UseRecoveryCode(ctx context.Context, conn *pgxpool.Pool, userID int64, codeHash string) (bool, error) {
+	tag, err := conn.Exec(ctx,
+		"UPDATE recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func CountUnusedRecoveryCodes(ctx context.Context, conn *pgxpool.Pool, userID int64) (int64, error) {
+	var n int64
+	err := conn.QueryRow(ctx,
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	).Scan(&n)
+	return n, err
+}
+
+// ReplaceRecoveryCodes swaps all of a user's recovery codes for new ones.
+func ReplaceRecoveryCodes(ctx context.Context, conn *pgxpool.Pool, userID int64, codeHashes []string) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])
+	`, userID, codeHashes)
+	return err
+}
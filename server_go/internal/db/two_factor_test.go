@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTOTPEnrollmentLifecycle(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := StartTOTPEnrollment(ctx, pool, uid, "SECRET"); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableTOTP(ctx, pool, uid, 100, []string{"h1", "h2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := GetUserByID(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.TOTPSecret != "SECRET" || u.TOTPEnabledAt == nil {
+		t.Fatalf("expected two-factor login to be on, got secret %q enabled %v", u.TOTPSecret, u.TOTPEnabledAt)
+	}
+
+	// Re-enrolling must not swap the secret of an enabled user.
+	if err := StartTOTPEnrollment(ctx, pool, uid, "OTHER"); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := GetUserByID(ctx, pool, uid); u.TOTPSecret != "SECRET" {
+		t.Errorf("expected secret to stay SECRET, got %q", u.TOTPSecret)
+	}
+
+	if err := DisableTOTP(ctx, pool, uid); err != nil {
+		t.Fatal(err)
+	}
+	u, err = GetUserByID(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.TOTPSecret != "" || u.TOTPEnabledAt != nil {
+		t.Error("expected two-factor login to be off")
+	}
+	if n, _ := CountUnusedRecoveryCodes(ctx, pool, uid); n != 0 {
+		t.Errorf("expected recovery codes to be gone, got %d", n)
+	}
+}
+
+func TestAcceptTOTPStep_RejectsReplay(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := StartTOTPEnrollment(ctx, pool, uid, "SECRET"); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableTOTP(ctx, pool, uid, 100, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		step int64
+		want bool
+	}{{100, false}, {101, true}, {101, false}, {99, false}, {102, true}} {
+		ok, err := AcceptTOTPStep(ctx, pool, uid, c.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.want {
+			t.Errorf("AcceptTOTPStep(%d) = %v, want %v", c.step, ok, c.want)
+		}
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := ReplaceRecoveryCodes(ctx, pool, uid, []string{"h1", "h2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := UseRecoveryCode(ctx, pool, uid, "h1"); err != nil || !ok {
+		t.Fatalf("expected first use to succeed, got %v, %v", ok, err)
+	}
+	if ok, _ := UseRecoveryCode(ctx, pool, uid, "h1"); ok {
+		t.Error("expected a used recovery code to be refused")
+	}
+	if ok, _ := UseRecoveryCode(ctx, pool, uid, "nope"); ok {
+		t.Error("expected an unknown recovery code to be refused")
+	}
+	if n, _ := CountUnusedRecoveryCodes(ctx, pool, uid); n != 1 {
+		t.Errorf("expected 1 unused code, got %d", n)
+	}
+}
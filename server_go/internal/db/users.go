@@ -3,28 +3,64 @@ package db
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/export"
 )
 
 type UserRow struct {
-	ID           int64
-	Username     string
-	Email        string
-	PasswordHash string
+	ID              int64
+	Username        string
+	Email           string
+	PasswordHash    string
+	EmailVerifiedAt *time.Time
+	Role            string
+	// TOTPSecret is set from the start of two-factor enrollment; it is only
+	// in force once TOTPEnabledAt is set.
+	TOTPSecret    string
+	TOTPEnabledAt *time.Time
+	// SearchHistoryEnabled is false when the user opted out of search
+	// history.
+	SearchHistoryEnabled bool
 }
 
-var ErrUserNotFound = errors.New("user not found")
+// Roles, from least to most privileged.
+const (
+	RoleUser   = "user"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
 
-func GetUserByUsername(ctx context.Context, conn *pgxpool.Pool, username string) (*UserRow, error) {
-	row := conn.QueryRow(ctx,
-		"SELECT id, username, email, password FROM users WHERE username = $1",
-		username,
-	)
+// Roles lists every role in ascending order of privilege.
+var Roles = []string{RoleUser, RoleEditor, RoleAdmin}
+
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	ErrInvalidRole          = errors.New("invalid role")
+	ErrEmailTaken           = errors.New("email already in use")
+	ErrLastAdmin            = errors.New("last admin")
+)
+
+const userColumns = "id, username, email, password, email_verified_at, role, totp_secret, totp_enabled_at, search_history_enabled"
+
+// prefixColumns qualifies a column list such as userColumns with a table
+// alias for use in joins.
+func prefixColumns(prefix, columns string) string {
+	cols := strings.Split(columns, ", ")
+	for i, c := range cols {
+		cols[i] = prefix + c
+	}
+	return strings.Join(cols, ", ")
+}
 
+func scanUser(row pgx.Row) (*UserRow, error) {
 	u := &UserRow{}
-	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash); err != nil {
+	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.EmailVerifiedAt, &u.Role, &u.TOTPSecret, &u.TOTPEnabledAt, &u.SearchHistoryEnabled); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
@@ -33,26 +69,190 @@ func GetUserByUsername(ctx context.Context, conn *pgxpool.Pool, username string)
 	return u, nil
 }
 
+func GetUserByUsername(ctx context.Context, conn *pgxpool.Pool, username string) (*UserRow, error) {
+	return scanUser(conn.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE username = $1",
+		username,
+	))
+}
+
 func GetUserByID(ctx context.Context, conn *pgxpool.Pool, id int64) (*UserRow, error) {
-	row := conn.QueryRow(ctx,
-		"SELECT id, username, email, password FROM users WHERE id = $1",
+	return scanUser(conn.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = $1",
 		id,
-	)
+	))
+}
 
-	u := &UserRow{}
-	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrUserNotFound
-		}
-		return nil, err
-	}
-	return u, nil
+func GetUserByEmail(ctx context.Context, conn *pgxpool.Pool, email string) (*UserRow, error) {
+	return scanUser(conn.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE lower(email) = lower($1)",
+		email,
+	))
 }
 
+// CreateUser inserts a user. It fails with ErrEmailTaken when another
+// account uses the address in any letter case.
 func CreateUser(ctx context.Context, conn *pgxpool.Pool, username, email, passwordHash string) error {
-	_, err := conn.Exec(ctx,
-		"INSERT INTO users (username, email, password) VALUES ($1, $2, $3)",
+	tag, err := conn.Exec(ctx, `
+		INSERT INTO users (username, email, password)
+		SELECT $1::text, $2::text, $3::text
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE lower(email) = lower($2))`,
 		username, email, passwordHash,
 	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+func UpdatePasswordHash(ctx context.Context, conn *pgxpool.Pool, id int64, passwordHash string) error {
+	_, err := conn.Exec(ctx,
+		"UPDATE users SET password = $2 WHERE id = $1",
+		id, passwordHash,
+	)
 	return err
 }
+
+// ChangeEmail gives the user a new, unverified address. It fails with
+// ErrEmailTaken when another account uses the address in any letter case.
+func ChangeEmail(ctx context.Context, conn *pgxpool.Pool, id int64, email string) error {
+	tag, err := conn.Exec(ctx, `
+		UPDATE users SET email = $2, email_verified_at = NULL
+		WHERE id = $1
+		  AND NOT EXISTS (SELECT 1 FROM users WHERE lower(email) = lower($2) AND id <> $1)`,
+		id, email,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+	if _, err := GetUserByID(ctx, conn, id); err != nil {
+		return err
+	}
+	return ErrEmailTaken
+}
+
+// DeleteUser removes the user. Their sessions, API tokens, linked
+// identities, reset tokens and recovery codes go with them through the
+// foreign keys. The only remaining admin can't be deleted (ErrLastAdmin).
+func DeleteUser(ctx context.Context, conn *pgxpool.Pool, id int64) error {
+	tag, err := conn.Exec(ctx, `
+		DELETE FROM users
+		WHERE id = $1
+		  AND (role <> $2 OR (SELECT COUNT(*) FROM users WHERE role = $2) > 1)`,
+		id, RoleAdmin,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+	if _, err := GetUserByID(ctx, conn, id); err != nil {
+		return err
+	}
+	return ErrLastAdmin
+}
+
+// CountLegacyPasswordHashes counts users whose stored hash doesn't start
+// with currentPrefix, i.e. who still have to log in once to be rehashed.
+// Single sign-on users without a password don't count.
+func CountLegacyPasswordHashes(ctx context.Context, conn *pgxpool.Pool, currentPrefix string) (int64, error) {
+	var n int64
+	err := conn.QueryRow(ctx,
+		"SELECT COUNT(*) FROM users WHERE password <> '' AND NOT starts_with(password, $1)",
+		currentPrefix,
+	).Scan(&n)
+	return n, err
+}
+
+// MarkEmailVerified records that the user confirmed email. It fails with
+// ErrUserNotFound when the user no longer has that address (it was changed
+// after the link was sent) and ErrEmailAlreadyVerified when the link was
+// already used.
+func MarkEmailVerified(ctx context.Context, conn *pgxpool.Pool, id int64, email string) error {
+	tag, err := conn.Exec(ctx,
+		"UPDATE users SET email_verified_at = now() WHERE id = $1 AND email = $2 AND email_verified_at IS NULL",
+		id, email,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	u, err := GetUserByID(ctx, conn, id)
+	if err != nil {
+		return err
+	}
+	if u.Email != email {
+		return ErrUserNotFound
+	}
+	return ErrEmailAlreadyVerified
+}
+
+// RoleRank orders roles by privilege; unknown roles rank below RoleUser.
+func RoleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+func SetUserRole(ctx context.Context, conn *pgxpool.Pool, id int64, role string) error {
+	if RoleRank(role) < 0 {
+		return ErrInvalidRole
+	}
+	tag, err := conn.Exec(ctx, "UPDATE users SET role = $2 WHERE id = $1", id, role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func init() { export.Register("profile", exportProfile) }
+
+type profileExport struct {
+	ID                   int64      `json:"id"`
+	Username             string     `json:"username"`
+	Email                string     `json:"email"`
+	EmailVerifiedAt      *time.Time `json:"email_verified_at"`
+	Role                 string     `json:"role"`
+	HasPassword          bool       `json:"has_password"`
+	TwoFactorEnabledAt   *time.Time `json:"two_factor_enabled_at"`
+	UnusedRecoveryCodes  int64      `json:"unused_recovery_codes"`
+	SearchHistoryEnabled bool       `json:"search_history_enabled"`
+}
+
+func exportProfile(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error) {
+	u, err := GetUserByID(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := CountUnusedRecoveryCodes(ctx, conn, userID)
+	if err != nil {
+		return nil, err
+	}
+	return profileExport{
+		ID:                   u.ID,
+		Username:             u.Username,
+		Email:                u.Email,
+		EmailVerifiedAt:      u.EmailVerifiedAt,
+		Role:                 u.Role,
+		HasPassword:          u.PasswordHash != "",
+		TwoFactorEnabledAt:   u.TOTPEnabledAt,
+		UnusedRecoveryCodes:  codes,
+		SearchHistoryEnabled: u.SearchHistoryEnabled,
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 )
 
 func TestCreateUser_And_GetByUsername(t *testing.T) {
@@ -82,3 +83,191 @@ func TestCreateUser_DuplicateUsername(t *testing.T) {
 		t.Error("expected error for duplicate username, got nil")
 	}
 }
+
+func TestCreateUser_EmailTakenInAnyCase(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	if err := CreateUser(ctx, pool, "charlie", "charlie@example.com", "hash1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range []string{"charlie@example.com", "Charlie@Example.com"} {
+		if err := CreateUser(ctx, pool, "chuck", email, "hash2"); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("%s: expected ErrEmailTaken, got %v", email, err)
+		}
+	}
+	if _, err := GetUserByUsername(ctx, pool, "chuck"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected no user to be created, got %v", err)
+	}
+}
+
+func TestUpdatePasswordHash_And_CountLegacy(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+
+	if err := CreateUser(ctx, pool, "dora", "dora@example.com", "5f4dcc3b5aa765d61d8327deb882cf99"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateUser(ctx, pool, "eve", "eve@example.com", "$argon2id$v=19$m=19456,t=2,p=1$salt$key"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := CountLegacyPasswordHashes(ctx, pool, "$argon2id$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 legacy hash, got %d", n)
+	}
+
+	u, err := GetUserByUsername(ctx, pool, "dora")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdatePasswordHash(ctx, pool, u.ID, "$argon2id$v=19$m=19456,t=2,p=1$salt2$key2"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = CountLegacyPasswordHashes(ctx, pool, "$argon2id$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected 0 legacy hashes after rehash, got %d", n)
+	}
+}
+
+func TestMarkEmailVerified(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	u, err := GetUserByID(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.EmailVerifiedAt != nil {
+		t.Fatal("expected new user to be unverified")
+	}
+
+	if err := MarkEmailVerified(ctx, pool, uid, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkEmailVerified(ctx, pool, uid, "alice@example.com"); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Errorf("expected ErrEmailAlreadyVerified on reuse, got %v", err)
+	}
+	if err := MarkEmailVerified(ctx, pool, uid, "old@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound for a stale address, got %v", err)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	u, err := GetUserByID(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Role != RoleUser {
+		t.Fatalf("expected new user to have role %q, got %q", RoleUser, u.Role)
+	}
+
+	if err := SetUserRole(ctx, pool, uid, RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	u, err = GetUserByID(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Role != RoleAdmin {
+		t.Errorf("expected role %q, got %q", RoleAdmin, u.Role)
+	}
+
+	if err := SetUserRole(ctx, pool, uid, "root"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("expected ErrInvalidRole, got %v", err)
+	}
+	if err := SetUserRole(ctx, pool, uid+1, RoleEditor); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+	mustCreateUser(t, pool, "bob")
+
+	if err := MarkEmailVerified(ctx, pool, uid, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ChangeEmail(ctx, pool, uid, "alice@new.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := GetUserByID(ctx, pool, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "alice@new.example.com" {
+		t.Errorf("expected new email, got %q", u.Email)
+	}
+	if u.EmailVerifiedAt != nil {
+		t.Error("expected the new address to be unverified")
+	}
+
+	if err := ChangeEmail(ctx, pool, uid, "BOB@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken, got %v", err)
+	}
+	if err := ChangeEmail(ctx, pool, uid+100, "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestDeleteUser_Cascades(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	uid := mustCreateUser(t, pool, "alice")
+
+	if err := SaveSession(ctx, pool, SessionRow{ID: "s1", UserID: &uid, Data: []byte{}, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateAPIToken(ctx, pool, uid, "ci", "hash1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteUser(ctx, pool, uid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetUserByID(ctx, pool, uid); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound after delete, got %v", err)
+	}
+	if _, err := GetSession(ctx, pool, "s1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected the session to be deleted, got %v", err)
+	}
+	if _, err := GetAPITokenByHash(ctx, pool, "hash1"); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("expected the API token to be deleted, got %v", err)
+	}
+	if err := DeleteUser(ctx, pool, uid); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound on second delete, got %v", err)
+	}
+}
+
+func TestDeleteUser_LastAdmin(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	alice := mustCreateUser(t, pool, "alice")
+	bob := mustCreateUser(t, pool, "bob")
+
+	for _, id := range []int64{alice, bob} {
+		if err := SetUserRole(ctx, pool, id, RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DeleteUser(ctx, pool, alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteUser(ctx, pool, bob); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("expected ErrLastAdmin, got %v", err)
+	}
+}
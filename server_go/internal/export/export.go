@@ -0,0 +1,149 @@
+// Package export collects everything WhoKnows stores about a user into one
+// archive, for users downloading their own data and for admins answering
+// subject access requests.
+//
+// Each subsystem that stores personal data registers an Exporter for its
+// section, usually from an init function next to its queries, so a new
+// feature can't be left out of the export by forgetting to edit a central
+// list.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FormatVersion is bumped when sections change in a way that breaks
+// readers of older archives.
+const FormatVersion = 1
+
+// Exporter returns one section of a user's data, ready to be encoded as
+// JSON. It must leave out secrets such as password and token hashes.
+type Exporter func(ctx context.Context, conn *pgxpool.Pool, userID int64) (any, error)
+
+// Registry maps section names to their exporters.
+type Registry struct {
+	mu        sync.RWMutex
+	exporters map[string]Exporter
+}
+
+// Default is the registry the subsystems register into.
+var Default = &Registry{}
+
+// Register adds the exporter for section to the default registry.
+func Register(section string, fn Exporter) { Default.Register(section, fn) }
+
+// Register adds the exporter for section. Registering a section twice is a
+// programming error and panics.
+func (r *Registry) Register(section string, fn Exporter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if section == "" || fn == nil {
+		panic("export: Register needs a section name and an exporter")
+	}
+	if _, dup := r.exporters[section]; dup {
+		panic("export: section " + section + " registered twice")
+	}
+	if r.exporters == nil {
+		r.exporters = map[string]Exporter{}
+	}
+	r.exporters[section] = fn
+}
+
+// Sections returns the registered section names in sorted order.
+func (r *Registry) Sections() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.exporters))
+	for name := range r.exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Archive is a user's complete export.
+type Archive struct {
+	FormatVersion int            `json:"format_version"`
+	UserID        int64          `json:"user_id"`
+	GeneratedAt   time.Time      `json:"generated_at"`
+	Sections      map[string]any `json:"sections"`
+}
+
+// Collect runs every exporter for userID. One failing section fails the
+// whole export rather than handing out an incomplete one.
+func (r *Registry) Collect(ctx context.Context, conn *pgxpool.Pool, userID int64) (*Archive, error) {
+	a := &Archive{
+		FormatVersion: FormatVersion,
+		UserID:        userID,
+		GeneratedAt:   time.Now().UTC(),
+		Sections:      map[string]any{},
+	}
+	for _, name := range r.Sections() {
+		r.mu.RLock()
+		fn := r.exporters[name]
+		r.mu.RUnlock()
+
+		data, err := fn(ctx, conn, userID)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", name, err)
+		}
+		a.Sections[name] = data
+	}
+	return a, nil
+}
+
+// WriteJSON writes the archive as a single JSON document.
+func (a *Archive) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+// WriteZip writes the archive as a ZIP file with a manifest.json and one
+// <section>.json file per section.
+func (a *Archive) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	names := make([]string, 0, len(a.Sections))
+	for name := range a.Sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manifest := struct {
+		FormatVersion int       `json:"format_version"`
+		UserID        int64     `json:"user_id"`
+		GeneratedAt   time.Time `json:"generated_at"`
+		Sections      []string  `json:"sections"`
+	}{a.FormatVersion, a.UserID, a.GeneratedAt, names}
+	if err := writeZipJSON(zw, "manifest.json", a.GeneratedAt, manifest); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := writeZipJSON(zw, name+".json", a.GeneratedAt, a.Sections[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipJSON(zw *zip.Writer, name string, modified time.Time, v any) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,113 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func constant(v any) Exporter {
+	return func(context.Context, *pgxpool.Pool, int64) (any, error) { return v, nil }
+}
+
+func TestRegistryCollect(t *testing.T) {
+	r := &Registry{}
+	r.Register("profile", func(_ context.Context, _ *pgxpool.Pool, userID int64) (any, error) {
+		return map[string]int64{"id": userID}, nil
+	})
+	r.Register("bookmarks", constant([]string{"a"}))
+
+	if got, want := r.Sections(), []string{"bookmarks", "profile"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Sections() = %v, want %v", got, want)
+	}
+
+	a, err := r.Collect(context.Background(), nil, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.UserID != 7 || a.FormatVersion != FormatVersion {
+		t.Errorf("unexpected archive header: %+v", a)
+	}
+
+	var buf bytes.Buffer
+	if err := a.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Sections map[string]json.RawMessage `json:"sections"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var bookmarks []string
+	if err := json.Unmarshal(decoded.Sections["bookmarks"], &bookmarks); err != nil || !reflect.DeepEqual(bookmarks, []string{"a"}) {
+		t.Errorf("unexpected bookmarks section %s (%v)", decoded.Sections["bookmarks"], err)
+	}
+}
+
+func TestRegistryCollectFailsOnSectionError(t *testing.T) {
+	r := &Registry{}
+	boom := errors.New("boom")
+	r.Register("profile", constant("ok"))
+	r.Register("history", func(context.Context, *pgxpool.Pool, int64) (any, error) { return nil, boom })
+
+	if _, err := r.Collect(context.Background(), nil, 1); !errors.Is(err, boom) {
+		t.Errorf("expected the section error, got %v", err)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	r := &Registry{}
+	r.Register("profile", constant(nil))
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	r.Register("profile", constant(nil))
+}
+
+func TestWriteZip(t *testing.T) {
+	r := &Registry{}
+	r.Register("profile", constant(map[string]string{"username": "alice"}))
+	r.Register("sessions", constant([]string{}))
+
+	a, err := r.Collect(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := a.WriteZip(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if want := []string{"manifest.json", "profile.json", "sessions.json"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("zip files = %v, want %v", names, want)
+	}
+
+	f, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(f)
+	var profile map[string]string
+	if err := json.Unmarshal(body, &profile); err != nil || profile["username"] != "alice" {
+		t.Errorf("unexpected profile.json %s (%v)", body, err)
+	}
+}
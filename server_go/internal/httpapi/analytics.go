@@ -0,0 +1,203 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/searchlog"
+)
+
+const (
+	defaultAnalyticsDays  = 30
+	maxAnalyticsDays      = 366
+	defaultAnalyticsLimit = 20
+	maxAnalyticsLimit     = 100
+)
+
+type QueryStat struct {
+	Query      string  `json:"query"`
+	Count      int64   `json:"count"`
+	AvgResults float64 `json:"avg_results"`
+}
+
+type DayStat struct {
+	// Day is a YYYY-MM-DD date in UTC.
+	Day         string `json:"day"`
+	Count       int64  `json:"count"`
+	ZeroResults int64  `json:"zero_results"`
+}
+
+type LanguageStat struct {
+	// Language is empty for searches without a language filter.
+	Language string `json:"language"`
+	Count    int64  `json:"count"`
+}
+
+// SearchAnalytics sums up the searches made from Since up to, but not
+// including, Until.
+type SearchAnalytics struct {
+	Since                time.Time      `json:"since"`
+	Until                time.Time      `json:"until"`
+	Total                int64          `json:"total"`
+	ZeroResults          int64          `json:"zero_results"`
+	AvgResults           float64        `json:"avg_results"`
+	TopQueries           []QueryStat    `json:"top_queries"`
+	TopZeroResultQueries []QueryStat    `json:"top_zero_result_queries"`
+	PerDay               []DayStat      `json:"per_day"`
+	Languages            []LanguageStat `json:"languages"`
+}
+
+// logSearch hands a search to the search log, which writes it to the
+// configured sinks in the background. Searches from browsers that send
+// Do Not Track or Global Privacy Control aren't logged.
+func (s *Server) logSearch(r *http.Request, q string, language *string, resultCount int) {
+	if s.SearchLog == nil || doNotTrack(r) {
+		return
+	}
+	e := searchlog.Entry{Query: q, ResultCount: resultCount}
+	if language != nil {
+		e.Language = *language
+	}
+	s.SearchLog.Log(e)
+}
+
+// doNotTrack reports whether the request asks not to be tracked, with
+// DNT: 1 or Sec-GPC: 1.
+func doNotTrack(r *http.Request) bool {
+	return strings.TrimSpace(r.Header.Get("DNT")) == "1" || strings.TrimSpace(r.Header.Get("Sec-GPC")) == "1"
+}
+
+// analyticsWindow reads the since and until (RFC 3339 or YYYY-MM-DD) and
+// limit query parameters. The window defaults to the last 30 days and
+// can be at most a year. A non-empty message is a validation error.
+func analyticsWindow(r *http.Request, now time.Time) (since, until time.Time, limit int, msg string) {
+	q := r.URL.Query()
+	until = now
+	if v := q.Get("until"); v != "" {
+		t, err := parseEventTime(v)
+		if err != nil {
+			return since, until, 0, "until must be an RFC 3339 time or a YYYY-MM-DD date"
+		}
+		until = t
+	}
+	since = until.UTC().Truncate(24*time.Hour).AddDate(0, 0, -(defaultAnalyticsDays - 1))
+	if v := q.Get("since"); v != "" {
+		t, err := parseEventTime(v)
+		if err != nil {
+			return since, until, 0, "since must be an RFC 3339 time or a YYYY-MM-DD date"
+		}
+		since = t
+	}
+	if !since.Before(until) {
+		return since, until, 0, "since must be before until"
+	}
+	if until.Sub(since) > maxAnalyticsDays*24*time.Hour {
+		return since, until, 0, "The time window can be at most " + strconv.Itoa(maxAnalyticsDays) + " days"
+	}
+
+	limit = defaultAnalyticsLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return since, until, 0, "limit must be a positive number"
+		}
+		limit = min(n, maxAnalyticsLimit)
+	}
+	return since, until, limit, ""
+}
+
+func (s *Server) searchAnalytics(ctx context.Context, since, until time.Time, limit int) (*SearchAnalytics, error) {
+	a, err := db.GetSearchAnalytics(ctx, s.DB, since, until, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	queryStats := func(in []db.QueryCount) []QueryStat {
+		out := make([]QueryStat, len(in))
+		for i, c := range in {
+			out[i] = QueryStat{Query: c.Query, Count: c.Count, AvgResults: c.AvgResults}
+		}
+		return out
+	}
+	out := &SearchAnalytics{
+		Since:                since,
+		Until:                until,
+		Total:                a.Total,
+		ZeroResults:          a.ZeroResults,
+		AvgResults:           a.AvgResults,
+		TopQueries:           queryStats(a.TopQueries),
+		TopZeroResultQueries: queryStats(a.TopZeroResultQueries),
+		PerDay:               make([]DayStat, len(a.PerDay)),
+		Languages:            make([]LanguageStat, len(a.Languages)),
+	}
+	for i, d := range a.PerDay {
+		out.PerDay[i] = DayStat{Day: d.Day.Format(time.DateOnly), Count: d.Count, ZeroResults: d.ZeroResults}
+	}
+	for i, l := range a.Languages {
+		out.Languages[i] = LanguageStat{Language: l.Language, Count: l.Count}
+	}
+	return out, nil
+}
+
+// ServeAnalyticsPage shows admins what people search for, and what they
+// search for without finding anything.
+func (s *Server) ServeAnalyticsPage(w http.ResponseWriter, r *http.Request) {
+	data := ViewData{
+		User:      currentUser(r),
+		Flashes:   s.getFlashes(w, r),
+		CSRFToken: s.csrfToken(w, r),
+	}
+	since, until, limit, msg := analyticsWindow(r, time.Now())
+	if msg != "" {
+		data.Error = msg
+		renderTemplateStatus(w, http.StatusBadRequest, "analytics.html", data)
+		return
+	}
+
+	a, err := s.searchAnalytics(r.Context(), since, until, limit)
+	if err != nil {
+		log.Printf("search analytics failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	data.Analytics = a
+	renderTemplate(w, "analytics.html", data)
+}
+
+// GetSearchAnalytics godoc
+// @Summary Search Analytics
+// @Description Sums up the search log: totals, top queries, searches per day and languages.
+// @Tags admin
+// @Produce json
+// @Param since query string false "RFC 3339 time or YYYY-MM-DD date; 30 days ago by default"
+// @Param until query string false "RFC 3339 time or YYYY-MM-DD date; now by default"
+// @Param limit query int false "Length of the top query lists, at most 100"
+// @Success 200 {object} SearchAnalytics
+// @Failure 400 {object} ErrorResponse "Invalid parameter"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Router /api/admin/analytics [get]
+//
+// GetSearchAnalytics returns the search analytics as JSON. Query
+// parameters: since and until (RFC 3339 or YYYY-MM-DD; the last 30 days by
+// default) and limit, the length of the top query lists.
+func (s *Server) GetSearchAnalytics(w http.ResponseWriter, r *http.Request) {
+	since, until, limit, msg := analyticsWindow(r, time.Now())
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	a, err := s.searchAnalytics(r.Context(), since, until, limit)
+	if err != nil {
+		log.Printf("search analytics failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
@@ -0,0 +1,113 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"whoknows_variations/server_go/internal/searchlog"
+)
+
+func TestAnalyticsWithoutLogin(t *testing.T) {
+	r := NewRouter(testServer())
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/analytics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/admin/analytics: expected status 401, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/analytics", nil))
+	if rec.Code == http.StatusOK {
+		t.Error("GET /admin/analytics: expected anonymous visitors to be turned away")
+	}
+}
+
+func TestAnalyticsWindowDefaultsToLast30Days(t *testing.T) {
+	now := time.Date(2026, 3, 31, 15, 4, 5, 0, time.UTC)
+	since, until, limit, msg := analyticsWindow(httptest.NewRequest(http.MethodGet, "/api/admin/analytics", nil), now)
+	if msg != "" {
+		t.Fatalf("unexpected validation error %q", msg)
+	}
+	if !until.Equal(now) || !since.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 2026-03-02 until now, got %v until %v", since, until)
+	}
+	if limit != defaultAnalyticsLimit {
+		t.Errorf("expected limit %d, got %d", defaultAnalyticsLimit, limit)
+	}
+
+	_, _, limit, _ = analyticsWindow(httptest.NewRequest(http.MethodGet, "/api/admin/analytics?since=2026-01-01&until=2026-02-01&limit=5000", nil), now)
+	if limit != maxAnalyticsLimit {
+		t.Errorf("expected the limit to be capped at %d, got %d", maxAnalyticsLimit, limit)
+	}
+}
+
+func TestAnalyticsWindowRejectsBadParams(t *testing.T) {
+	now := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	for _, query := range []string{
+		"since=yesterday",
+		"until=2026-13-01",
+		"since=2026-03-10&until=2026-03-01",
+		"since=2026-03-01&until=2026-03-01",
+		"since=2020-01-01",
+		"limit=0",
+		"limit=abc",
+	} {
+		_, _, _, msg := analyticsWindow(httptest.NewRequest(http.MethodGet, "/api/admin/analytics?"+query, nil), now)
+		if msg == "" {
+			t.Errorf("%s: expected a validation error", query)
+		}
+	}
+}
+
+func TestDoNotTrack(t *testing.T) {
+	cases := []struct {
+		header, value string
+		want          bool
+	}{
+		{"", "", false},
+		{"DNT", "1", true},
+		{"DNT", "0", false},
+		{"Sec-GPC", "1", true},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/?q=go", nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		if got := doNotTrack(req); got != c.want {
+			t.Errorf("%s: %q: expected %v, got %v", c.header, c.value, c.want, got)
+		}
+	}
+}
+
+func TestLogSearchHonorsDoNotTrack(t *testing.T) {
+	sink := &recordingSink{}
+	s := testServer()
+	s.SearchLog = searchlog.New(searchlog.Options{}, sink)
+
+	req := httptest.NewRequest(http.MethodGet, "/?q=go", nil)
+	s.logSearch(req, "go", nil, 1)
+	req.Header.Set("Sec-GPC", "1")
+	s.logSearch(req, "private", nil, 1)
+	if err := s.SearchLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.entries) != 1 || sink.entries[0].Query != "go" {
+		t.Errorf("expected only the first search to be logged, got %+v", sink.entries)
+	}
+}
+
+type recordingSink struct {
+	entries []searchlog.Entry
+}
+
+func (s *recordingSink) Write(entries []searchlog.Entry) error {
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
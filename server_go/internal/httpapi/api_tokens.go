@@ -0,0 +1,301 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/metrics"
+)
+
+// apiTokenPrefix marks personal API tokens so they are easy to recognise,
+// e.g. by secret scanners.
+const apiTokenPrefix = "wk_"
+
+const (
+	ScopeSearchRead = "search:read"
+	ScopePagesWrite = "pages:write"
+)
+
+// apiTokenScopes lists every scope a token can be given.
+var apiTokenScopes = []string{ScopeSearchRead, ScopePagesWrite}
+
+const maxAPITokenNameLength = 100
+
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type APITokensResponse struct {
+	Data []APIToken `json:"data"`
+}
+
+// CreatedAPITokenResponse is the only response that ever contains the token
+// itself.
+type CreatedAPITokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+func apiTokenFromRow(row db.APITokenRow) APIToken {
+	return APIToken{
+		ID:         row.ID,
+		Name:       row.Name,
+		Scopes:     row.Scopes,
+		CreatedAt:  row.CreatedAt,
+		LastUsedAt: row.LastUsedAt,
+	}
+}
+
+// HasScope reports whether the request may use scope. Session logins have
+// every scope.
+func (u *User) HasScope(scope string) bool {
+	return u.TokenID == 0 || slices.Contains(u.Scopes, scope)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < len("Bearer ") || !strings.EqualFold(h[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[len("Bearer "):]), true
+}
+
+// invalidTokenAuditInterval is how often an unknown token from one client
+// IP is written to the audit log. Every one is counted in the metrics.
+const invalidTokenAuditInterval = time.Minute
+
+// userFromAPIToken resolves a bearer token to its user. Unknown tokens of
+// ours are audited at most once a minute per client IP, and token use at
+// most once a minute per token in step with last_used_at. Strings without
+// our prefix aren't worth a row.
+func (s *Server) userFromAPIToken(r *http.Request, token string) (*User, error) {
+	ctx := r.Context()
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, db.ErrAPITokenNotFound
+	}
+	t, err := db.GetAPITokenByHash(ctx, s.DB, auth.HashToken(token))
+	if errors.Is(err, db.ErrAPITokenNotFound) {
+		metrics.ObserveInvalidAPIToken()
+		if s.invalidTokenAudits.allow(s.clientIP(r), time.Now(), invalidTokenAuditInterval) {
+			s.audit(r, db.EventTokenInvalid, 0, "", "unknown or revoked token")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	row, err := db.GetUserByID(ctx, s.DB, t.UserID)
+	if err != nil {
+		return nil, err
+	}
+	touched, err := db.TouchAPIToken(ctx, s.DB, t.ID)
+	if err != nil {
+		log.Printf("touch api token failed: %v", err)
+	}
+	if touched {
+		s.audit(r, db.EventTokenUse, row.ID, row.Username, t.Name)
+	}
+
+	u := userFromRow(row)
+	u.TokenID = t.ID
+	u.Scopes = t.Scopes
+	return u, nil
+}
+
+// RequireScope returns chi middleware that turns away requests made with a
+// personal API token lacking scope. Anonymous and session requests pass
+// through untouched; combine with RequireLogin where a user is needed.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if u := currentUser(r); u != nil && !u.HasScope(scope) {
+				writeError(w, http.StatusForbidden, "API token lacks the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession is chi middleware that keeps personal API tokens out of
+// account management, so a leaked token can't mint new tokens or end the
+// owner's sessions.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u := currentUser(r); u != nil && u.TokenID != 0 {
+			writeError(w, http.StatusForbidden, "Not available to API tokens")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) userAPITokens(r *http.Request) ([]APIToken, error) {
+	rows, err := db.ListUserAPITokens(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]APIToken, len(rows))
+	for i, row := range rows {
+		out[i] = apiTokenFromRow(row)
+	}
+	return out, nil
+}
+
+func (s *Server) renderAPITokensPage(w http.ResponseWriter, r *http.Request, newToken string) {
+	tokens, err := s.userAPITokens(r)
+	if err != nil {
+		log.Printf("list api tokens failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "api_tokens.html", ViewData{
+		User:        currentUser(r),
+		Flashes:     s.getFlashes(w, r),
+		APITokens:   tokens,
+		NewAPIToken: newToken,
+		CSRFToken:   s.csrfToken(w, r),
+	})
+}
+
+func (s *Server) ServeAPITokensPage(w http.ResponseWriter, r *http.Request) {
+	if u := currentUser(r); u == nil || u.TokenID != 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	s.renderAPITokensPage(w, r, "")
+}
+
+// ListAPITokens godoc
+// @Summary List API Tokens
+// @Description Lists the logged-in user's personal API tokens. The tokens themselves are never returned again after creation.
+// @Tags tokens
+// @Produce json
+// @Success 200 {object} APITokensResponse
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Not available to API tokens"
+// @Router /api/me/tokens [get]
+//
+// ListAPITokens returns the logged-in user's personal API tokens.
+func (s *Server) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := s.userAPITokens(r)
+	if err != nil {
+		log.Printf("list api tokens failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, APITokensResponse{Data: tokens})
+}
+
+// CreateAPIToken godoc
+// @Summary Create API Token
+// @Description Creates a personal API token, sent as "Authorization: Bearer <token>". The token is only ever in this response.
+// @Tags tokens
+// @Accept x-www-form-urlencoded,json
+// @Produce json
+// @Param name formData string true "Token name, 1 to 100 characters"
+// @Param scope formData []string true "search:read and/or pages:write; repeat the field, or send a JSON array, for several" collectionFormat(multi)
+// @Success 201 {object} CreatedAPITokenResponse
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not available to API tokens"
+// @Failure 422 {object} ErrorResponse "Invalid name or scope"
+// @Router /api/me/tokens [post]
+//
+// CreateAPIToken creates a token from the `name` form field and any number
+// of `scope` fields. The token is in the response and nowhere else: JSON
+// clients get it in the body, browsers on the re-rendered tokens page.
+func (s *Server) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "name") {
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	scopes := r.Form["scope"]
+	invalid := ""
+	switch {
+	case name == "" || len(name) > maxAPITokenNameLength:
+		invalid = "Token name must be between 1 and 100 characters"
+	case len(scopes) == 0:
+		invalid = "Choose at least one scope"
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(apiTokenScopes, scope) {
+			invalid = "Unknown scope: " + scope
+		}
+	}
+	if invalid != "" {
+		if wantsJSON(r) {
+			writeError(w, http.StatusUnprocessableEntity, invalid)
+			return
+		}
+		s.flashAndRedirect(w, r, invalid, "/settings/tokens")
+		return
+	}
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	raw, _ := auth.NewToken()
+	token := apiTokenPrefix + raw
+	hash := auth.HashToken(token)
+
+	row, err := db.CreateAPIToken(r.Context(), s.DB, currentUser(r).ID, name, hash, scopes)
+	if err != nil {
+		log.Printf("create api token failed: %v", err)
+		if wantsJSON(r) {
+			writeError(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/tokens")
+		return
+	}
+	s.audit(r, db.EventTokenCreate, currentUser(r).ID, currentUser(r).Username, name)
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, CreatedAPITokenResponse{APIToken: apiTokenFromRow(*row), Token: token})
+		return
+	}
+	s.renderAPITokensPage(w, r, token)
+}
+
+// RevokeAPIToken godoc
+// @Summary Revoke API Token
+// @Description Revokes one of the logged-in user's tokens and redirects to /settings/tokens with a flash message.
+// @Tags tokens
+// @Param id path int true "Token id"
+// @Success 303 {string} string "Redirect to /settings/tokens"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not available to API tokens"
+// @Router /api/me/tokens/{id}/revoke [post]
+//
+// RevokeAPIToken deletes one of the user's tokens.
+func (s *Server) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err == nil {
+		err = db.DeleteUserAPIToken(r.Context(), s.DB, currentUser(r).ID, id)
+	} else {
+		err = db.ErrAPITokenNotFound
+	}
+	if errors.Is(err, db.ErrAPITokenNotFound) {
+		s.flashAndRedirect(w, r, "That token no longer exists", "/settings/tokens")
+		return
+	}
+	if err != nil {
+		log.Printf("revoke api token failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/tokens")
+		return
+	}
+	s.audit(r, db.EventTokenRevoke, currentUser(r).ID, currentUser(r).Username, "token "+strconv.FormatInt(id, 10))
+	s.flashAndRedirect(w, r, "The token was revoked", "/settings/tokens")
+}
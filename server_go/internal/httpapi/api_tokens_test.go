@@ -0,0 +1,128 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	cases := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"Bearer wk_abc", "wk_abc", true},
+		{"bearer wk_abc", "wk_abc", true},
+		{"Basic dXNlcjpwYXNz", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		got, ok := bearerToken(req)
+		if got != c.want || ok != c.ok {
+			t.Errorf("bearerToken(%q) = %q, %v; want %q, %v", c.header, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	cases := []struct {
+		name string
+		user *User
+		want int
+	}{
+		{"anonymous", nil, http.StatusNoContent},
+		{"session", &User{ID: 1}, http.StatusNoContent},
+		{"token with scope", &User{ID: 1, TokenID: 7, Scopes: []string{ScopeSearchRead}}, http.StatusNoContent},
+		{"token without scope", &User{ID: 1, TokenID: 7, Scopes: []string{ScopePagesWrite}}, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/search?q=go", nil)
+		if c.user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, c.user))
+		}
+		rec := httptest.NewRecorder()
+
+		RequireScope(ScopeSearchRead)(ok).ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.want, rec.Code)
+		}
+	}
+}
+
+func TestRequireSessionRejectsAPITokens(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodPost, "/api/me/tokens", nil)
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, &User{ID: 1, TokenID: 7}))
+	rec := httptest.NewRecorder()
+
+	RequireSession(ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+}
+
+func TestAPIInvalidBearerTokenReturns401(t *testing.T) {
+	r := NewRouter(testServer())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search?q=go", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("expected a WWW-Authenticate header")
+	}
+}
+
+func TestCreateAPITokenReadsJSONScopeArray(t *testing.T) {
+	body := `{"name":"ci","scope":["search:read","admin"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/me/tokens", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, &User{ID: 1}))
+	rec := httptest.NewRecorder()
+
+	testServer().CreateAPIToken(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rec.Code)
+	}
+	var got ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if got.Message != "Unknown scope: admin" {
+		t.Errorf("expected every scope in the array to be checked, got %q", got.Message)
+	}
+}
+
+func TestParseJSONFormArrays(t *testing.T) {
+	body := `{"scope":["search:read","pages:write"],"name":"ci","count":3,"tags":[1,2]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/me/tokens", strings.NewReader(body))
+	if err := parseJSONForm(httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("parseJSONForm: %v", err)
+	}
+	if got := req.Form["scope"]; len(got) != 2 || got[0] != "search:read" || got[1] != "pages:write" {
+		t.Errorf("expected both scopes, got %q", got)
+	}
+	if got := req.FormValue("name"); got != "ci" {
+		t.Errorf("expected name ci, got %q", got)
+	}
+	for _, k := range []string{"count", "tags"} {
+		if _, ok := req.PostForm[k]; ok {
+			t.Errorf("expected non-string member %q to be dropped", k)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+const (
+	defaultAuthEventLimit = 100
+	maxAuthEventLimit     = 1000
+	maxAuditUserAgentLen  = 512
+	// maxAuditLimiterKeys caps how many keys an auditLimiter remembers.
+	maxAuditLimiterKeys = 10000
+)
+
+type AuthEvent struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Type       string    `json:"type"`
+	UserID     *int64    `json:"user_id"`
+	Username   string    `json:"username"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	RequestID  string    `json:"request_id"`
+	Detail     string    `json:"detail"`
+}
+
+type AuthEventsResponse struct {
+	Data []AuthEvent `json:"data"`
+}
+
+// audit records an auth event for the request. userID 0 means no known
+// user. A failure to record is logged and doesn't fail the request.
+func (s *Server) audit(r *http.Request, eventType string, userID int64, username, detail string) {
+	e := db.AuthEventRow{
+		Type:      eventType,
+		Username:  username,
+		IP:        s.clientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: middleware.GetReqID(r.Context()),
+		Detail:    detail,
+	}
+	if len(e.UserAgent) > maxAuditUserAgentLen {
+		// Don't leave a partial UTF-8 sequence, which Postgres would reject.
+		e.UserAgent = strings.ToValidUTF8(e.UserAgent[:maxAuditUserAgentLen], "")
+	}
+	if userID != 0 {
+		e.UserID = &userID
+	}
+	if err := db.RecordAuthEvent(r.Context(), s.DB, e); err != nil {
+		log.Printf("record %s auth event failed: %v", eventType, err)
+	}
+}
+
+// auditLimiter lets at most one event per key through each interval, for
+// events anyone can trigger without logging in, so they can't flood the
+// audit log. The zero value is ready to use.
+type auditLimiter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// allow reports whether an event for key may be recorded at now.
+func (l *auditLimiter) allow(key string, now time.Time, interval time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t, ok := l.last[key]; ok && now.Sub(t) < interval {
+		return false
+	}
+	if l.last == nil {
+		l.last = make(map[string]time.Time)
+	}
+	if len(l.last) >= maxAuditLimiterKeys {
+		for k, t := range l.last {
+			if now.Sub(t) >= interval {
+				delete(l.last, k)
+			}
+		}
+		// Still full: many distinct clients at once. Drop rather than grow.
+		if len(l.last) >= maxAuditLimiterKeys {
+			return false
+		}
+	}
+	l.last[key] = now
+	return true
+}
+
+// parseEventTime accepts an RFC 3339 timestamp or a plain date, which means
+// midnight UTC.
+func parseEventTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// ListAuthEvents godoc
+// @Summary List Auth Events
+// @Description Queries the audit log, newest first.
+// @Tags admin
+// @Produce json
+// @Param username query string false "Username, matched case-insensitively"
+// @Param type query string false "Event type, e.g. login_failure"
+// @Param since query string false "RFC 3339 time or YYYY-MM-DD date"
+// @Param until query string false "RFC 3339 time or YYYY-MM-DD date"
+// @Param before query int false "Event id to page back from"
+// @Param limit query int false "At most 1000; 100 by default"
+// @Success 200 {object} AuthEventsResponse
+// @Failure 400 {object} ErrorResponse "Invalid parameter"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Not an admin"
+// @Router /api/admin/auth-events [get]
+//
+// ListAuthEvents lets admins query the audit log. All query parameters are
+// optional: username, type, since and until (RFC 3339 or YYYY-MM-DD),
+// before (an event id, for paging) and limit.
+func (s *Server) ListAuthEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := db.AuthEventFilter{
+		Username: strings.TrimSpace(q.Get("username")),
+		Type:     strings.TrimSpace(q.Get("type")),
+		Limit:    defaultAuthEventLimit,
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseEventTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, p.name+" must be an RFC 3339 time or a YYYY-MM-DD date")
+			return
+		}
+		*p.dst = t
+	}
+	if v := q.Get("before"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			writeError(w, http.StatusBadRequest, "before must be an event id")
+			return
+		}
+		f.BeforeID = id
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		f.Limit = min(n, maxAuthEventLimit)
+	}
+
+	rows, err := db.ListAuthEvents(r.Context(), s.DB, f)
+	if err != nil {
+		log.Printf("list auth events failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	out := make([]AuthEvent, len(rows))
+	for i, e := range rows {
+		out[i] = AuthEvent{
+			ID:         e.ID,
+			OccurredAt: e.OccurredAt,
+			Type:       e.Type,
+			UserID:     e.UserID,
+			Username:   e.Username,
+			IP:         e.IP,
+			UserAgent:  e.UserAgent,
+			RequestID:  e.RequestID,
+			Detail:     e.Detail,
+		}
+	}
+	writeJSON(w, http.StatusOK, AuthEventsResponse{Data: out})
+}
@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseEventTime(t *testing.T) {
+	got, err := parseEventTime("2026-03-01")
+	if err != nil || !got.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseEventTime(date) = %v, %v", got, err)
+	}
+	got, err = parseEventTime("2026-03-01T12:30:00+01:00")
+	if err != nil || !got.Equal(time.Date(2026, 3, 1, 11, 30, 0, 0, time.UTC)) {
+		t.Errorf("parseEventTime(RFC 3339) = %v, %v", got, err)
+	}
+	if _, err := parseEventTime("yesterday"); err == nil {
+		t.Error("expected an error for an unparseable time")
+	}
+}
+
+func TestAuditLimiter(t *testing.T) {
+	var l auditLimiter
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if !l.allow("203.0.113.7", now, time.Minute) {
+		t.Fatal("expected the first event to be allowed")
+	}
+	if l.allow("203.0.113.7", now.Add(30*time.Second), time.Minute) {
+		t.Error("expected a second event within the interval to be dropped")
+	}
+	if !l.allow("198.51.100.1", now.Add(30*time.Second), time.Minute) {
+		t.Error("expected another key to be allowed")
+	}
+	if !l.allow("203.0.113.7", now.Add(time.Minute), time.Minute) {
+		t.Error("expected an event after the interval to be allowed")
+	}
+}
+
+func TestAuditLimiterForgetsStaleKeysWhenFull(t *testing.T) {
+	var l auditLimiter
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range maxAuditLimiterKeys {
+		l.allow(strconv.Itoa(i), now, time.Minute)
+	}
+	if l.allow("new", now, time.Minute) {
+		t.Error("expected a new key to be dropped while every key is fresh")
+	}
+	if !l.allow("new", now.Add(time.Minute), time.Minute) {
+		t.Error("expected stale keys to make room")
+	}
+	if len(l.last) != 1 {
+		t.Errorf("expected only the new key to be remembered, got %d", len(l.last))
+	}
+}
+
+// Bad parameters are rejected before the database is queried.
+func TestListAuthEventsRejectsBadParameters(t *testing.T) {
+	s := testServer()
+	for _, query := range []string{"since=yesterday", "until=2026-13-01", "before=abc", "limit=0", "limit=-5"} {
+		rec := httptest.NewRecorder()
+		s.ListAuthEvents(rec, httptest.NewRequest(http.MethodGet, "/api/admin/auth-events?"+query, nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestAuthEventsWithoutLoginReturns401(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewRouter(testServer()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/auth-events", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+type Bookmark struct {
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	// Available is false once the page was removed from the index.
+	Available bool `json:"available"`
+}
+
+type BookmarksResponse struct {
+	Data []Bookmark `json:"data"`
+}
+
+// BookmarkStatus answers API clients that add or remove a bookmark.
+type BookmarkStatus struct {
+	Title      string `json:"title"`
+	Bookmarked bool   `json:"bookmarked"`
+}
+
+// returnPath is the `next` form field when it is a path on this site, so a
+// form can send the user back where they came from, and fallback otherwise.
+func returnPath(r *http.Request, fallback string) string {
+	next := r.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return fallback
+	}
+	return next
+}
+
+func (s *Server) bookmarks(r *http.Request) ([]Bookmark, error) {
+	rows, err := db.ListBookmarks(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Bookmark, len(rows))
+	for i, b := range rows {
+		out[i] = Bookmark{Title: b.PageTitle, URL: b.URL, CreatedAt: b.CreatedAt, Available: b.PageExists}
+	}
+	return out, nil
+}
+
+// markBookmarked sets "bookmarked" on the search results the logged-in user
+// has starred, for the star toggle on the search page.
+func (s *Server) markBookmarked(r *http.Request, results []map[string]any) {
+	u := currentUser(r)
+	if u == nil || u.TokenID != 0 || len(results) == 0 {
+		return
+	}
+	titles := make([]string, 0, len(results))
+	for _, res := range results {
+		if title, ok := res["title"].(string); ok {
+			titles = append(titles, title)
+		}
+	}
+	marked, err := db.BookmarkedTitles(r.Context(), s.DB, u.ID, titles)
+	if err != nil {
+		log.Printf("bookmark lookup failed: %v", err)
+		return
+	}
+	for _, res := range results {
+		if title, ok := res["title"].(string); ok && marked[title] {
+			res["bookmarked"] = true
+		}
+	}
+}
+
+func (s *Server) ServeBookmarksPage(w http.ResponseWriter, r *http.Request) {
+	if u := currentUser(r); u == nil || u.TokenID != 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	bookmarks, err := s.bookmarks(r)
+	if err != nil {
+		log.Printf("list bookmarks failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "bookmarks.html", ViewData{
+		User:      currentUser(r),
+		Flashes:   s.getFlashes(w, r),
+		Bookmarks: bookmarks,
+		CSRFToken: s.csrfToken(w, r),
+	})
+}
+
+// ListBookmarks returns the logged-in user's bookmarks, newest first.
+func (s *Server) ListBookmarks(w http.ResponseWriter, r *http.Request) {
+	bookmarks, err := s.bookmarks(r)
+	if err != nil {
+		log.Printf("list bookmarks failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, BookmarksResponse{Data: bookmarks})
+}
+
+// AddBookmark stars the page in the `title` form field. Browsers are sent
+// back to `next`; API clients get a BookmarkStatus.
+func (s *Server) AddBookmark(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "title") {
+		return
+	}
+	title := r.FormValue("title")
+	to := returnPath(r, "/bookmarks")
+
+	err := db.AddBookmark(r.Context(), s.DB, currentUser(r).ID, title)
+	switch {
+	case errors.Is(err, db.ErrPageNotFound):
+		if wantsJSON(r) {
+			writeError(w, http.StatusNotFound, "Page not found")
+			return
+		}
+		s.flashAndRedirect(w, r, "That page no longer exists", to)
+		return
+	case err != nil:
+		log.Printf("add bookmark failed: %v", err)
+		if wantsJSON(r) {
+			writeError(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+		s.flashAndRedirect(w, r, "Internal error, please try again", to)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, BookmarkStatus{Title: title, Bookmarked: true})
+		return
+	}
+	s.flashAndRedirect(w, r, "Bookmarked "+title, to)
+}
+
+// RemoveBookmark unstars the page in the `title` form field, which also
+// works for pages that have since been removed.
+func (s *Server) RemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "title") {
+		return
+	}
+	title := r.FormValue("title")
+	to := returnPath(r, "/bookmarks")
+
+	err := db.RemoveBookmark(r.Context(), s.DB, currentUser(r).ID, title)
+	if err != nil && !errors.Is(err, db.ErrBookmarkNotFound) {
+		log.Printf("remove bookmark failed: %v", err)
+		if wantsJSON(r) {
+			writeError(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+		s.flashAndRedirect(w, r, "Internal error, please try again", to)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, BookmarkStatus{Title: title, Bookmarked: false})
+		return
+	}
+	s.flashAndRedirect(w, r, "Removed the bookmark for "+title, to)
+}
@@ -0,0 +1,85 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+func TestAddAndRemoveBookmark(t *testing.T) {
+	s := newTestDBServer(t)
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice", "secret")
+	if _, err := s.DB.Exec(ctx, "INSERT INTO pages (title, url, content) VALUES ('Go', '/go', 'The Go language')"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := postForm(s.AddBookmark, alice, url.Values{"title": {"Go"}, "next": {"/?q=go"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/?q=go" {
+		t.Fatalf("expected a redirect back to the search, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := flashes(t, s, rec); len(got) != 1 || got[0] != "Bookmarked Go" {
+		t.Errorf("unexpected flashes %q", got)
+	}
+	rows, err := db.ListBookmarks(ctx, s.DB, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].PageTitle != "Go" || rows[0].URL != "/go" {
+		t.Fatalf("expected a bookmark for Go, got %+v", rows)
+	}
+
+	// Starring twice keeps one bookmark.
+	postForm(s.AddBookmark, alice, url.Values{"title": {"Go"}})
+	if rows, _ := db.ListBookmarks(ctx, s.DB, alice.ID); len(rows) != 1 {
+		t.Errorf("expected one bookmark after starring twice, got %+v", rows)
+	}
+
+	rec = postForm(s.RemoveBookmark, alice, url.Values{"title": {"Go"}})
+	if rec.Header().Get("Location") != "/bookmarks" {
+		t.Errorf("expected a redirect to /bookmarks, got %q", rec.Header().Get("Location"))
+	}
+	if rows, _ := db.ListBookmarks(ctx, s.DB, alice.ID); len(rows) != 0 {
+		t.Errorf("expected no bookmarks after removing, got %+v", rows)
+	}
+}
+
+func TestAddBookmarkUnknownPageJSON(t *testing.T) {
+	s := newTestDBServer(t)
+	alice := mustCreateUser(t, s, "alice", "secret")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/me/bookmarks", strings.NewReader(`{"title":"Nope"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.AddBookmark(rec, withUser(req, alice))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+	if rows, _ := db.ListBookmarks(context.Background(), s.DB, alice.ID); len(rows) != 0 {
+		t.Errorf("expected no bookmark for an unknown page, got %+v", rows)
+	}
+}
+
+func TestReturnPathOnlyAllowsLocalPaths(t *testing.T) {
+	cases := map[string]string{
+		"":                      "/bookmarks",
+		"/?q=go&language=en":    "/?q=go&language=en",
+		"//evil.example.com/":   "/bookmarks",
+		"/\\evil.example.com":   "/bookmarks",
+		"https://evil.example/": "/bookmarks",
+		"javascript:alert(1)":   "/bookmarks",
+	}
+	for next, want := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"next": {next}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if got := returnPath(req, "/bookmarks"); got != want {
+			t.Errorf("returnPath(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
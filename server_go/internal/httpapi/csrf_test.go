@@ -0,0 +1,130 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// withCSRF fetches a CSRF token from the router and attaches it, with the
+// session cookie it belongs to, to req.
+func withCSRF(t *testing.T, r http.Handler, req *http.Request) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/csrf-token", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/csrf-token: expected status 200, got %d", rec.Code)
+	}
+
+	var body CSRFTokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if body.CSRFToken == "" {
+		t.Fatal("expected a non-empty csrf_token")
+	}
+
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	req.Header.Set(csrfHeader, body.CSRFToken)
+}
+
+func TestCSRFMissingTokenReturns403JSON(t *testing.T) {
+	r := NewRouter(testServer())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if body.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected statusCode 403 in body, got %d", body.StatusCode)
+	}
+}
+
+func TestCSRFMissingTokenReturns403HTMLForBrowsers(t *testing.T) {
+	r := NewRouter(testServer())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected an HTML response, got Content-Type %q", ct)
+	}
+}
+
+func TestCSRFTokenFromOtherSessionIsRejected(t *testing.T) {
+	r := NewRouter(testServer())
+
+	// A token that is valid for one session must not work with another.
+	other := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	withCSRF(t, r, other)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(url.Values{
+		"csrf_token": {other.Header.Get(csrfHeader)},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+}
+
+func TestCSRFFormFieldIsAccepted(t *testing.T) {
+	r := NewRouter(testServer())
+
+	probe := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	withCSRF(t, r, probe)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(url.Values{
+		"csrf_token": {probe.Header.Get(csrfHeader)},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range probe.Cookies() {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	// The token passes, so the handler's own validation answers.
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rec.Code)
+	}
+}
+
+func TestGetLogoutOnlyWhenAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewRouter(testServer()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/logout", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rec.Code)
+	}
+
+	s := testServer()
+	s.AllowGetLogout = true
+	rec = httptest.NewRecorder()
+	NewRouter(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/logout", nil))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d", rec.Code)
+	}
+}
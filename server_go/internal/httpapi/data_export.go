@@ -0,0 +1,85 @@
+package httpapi
+
+import (
+	"log"
+	"mime"
+	"net/http"
+
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/export"
+)
+
+// writeExport sends everything stored about u as a download, either one JSON
+// document or, with format=zip, a ZIP file with one JSON file per section.
+func (s *Server) writeExport(w http.ResponseWriter, r *http.Request, u *db.UserRow) {
+	format := r.FormValue("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "zip":
+	default:
+		writeError(w, http.StatusBadRequest, "format must be json or zip")
+		return
+	}
+
+	archive, err := export.Default.Collect(r.Context(), s.DB, u.ID)
+	if err != nil {
+		log.Printf("data export for user %d failed: %v", u.ID, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	filename := "whoknows-export-" + u.Username + "-" + archive.GeneratedAt.Format("20060102") + "." + format
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "no-store")
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		err = archive.WriteZip(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = archive.WriteJSON(w)
+	}
+	if err != nil {
+		log.Printf("write data export for user %d failed: %v", u.ID, err)
+	}
+}
+
+// ExportMyData lets the logged-in user download their own data.
+func (s *Server) ExportMyData(w http.ResponseWriter, r *http.Request) {
+	u, err := db.GetUserByID(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		log.Printf("data export user lookup failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	s.audit(r, db.EventDataExport, u.ID, u.Username, "")
+	s.writeExport(w, r, u)
+}
+
+// AdminExportUser godoc
+// @Summary Export User Data
+// @Description Downloads everything stored about a user, as JSON or a zip archive.
+// @Tags admin
+// @Accept x-www-form-urlencoded
+// @Produce json,application/zip
+// @Param username formData string true "Username"
+// @Param format formData string false "json (default) or zip"
+// @Success 200 {file} file "Export archive"
+// @Failure 400 {object} ErrorResponse "Unknown format"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not an admin"
+// @Router /api/admin/users/export [post]
+//
+// AdminExportUser downloads the data of the user in the `username` form
+// field, for answering subject access requests.
+func (s *Server) AdminExportUser(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "username") {
+		return
+	}
+	target := s.adminTargetUser(w, r)
+	if target == nil {
+		return
+	}
+	s.audit(r, db.EventDataExport, target.ID, target.Username, "by admin "+currentUser(r).Username)
+	s.writeExport(w, r, target)
+}
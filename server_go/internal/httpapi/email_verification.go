@@ -0,0 +1,138 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/mail"
+)
+
+// EmailVerificationPolicy controls what unverified accounts may do.
+type EmailVerificationPolicy string
+
+const (
+	// VerifyEmailOff sends verification links but enforces nothing.
+	VerifyEmailOff EmailVerificationPolicy = "off"
+	// VerifyEmailFeatures lets unverified users log in but keeps them out
+	// of routes behind RequireVerifiedEmail.
+	VerifyEmailFeatures EmailVerificationPolicy = "features"
+	// VerifyEmailLogin refuses to log unverified users in at all.
+	VerifyEmailLogin EmailVerificationPolicy = "login"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+const resendVerificationMessage = "If that email address still needs verifying, we have sent a new link"
+
+// RequireVerifiedEmail is chi middleware that keeps unverified users out of
+// privileged routes unless the policy is VerifyEmailOff. It must run after
+// RequireLogin.
+func (s *Server) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.EmailVerification != VerifyEmailOff && !currentUser(r).EmailVerified {
+			writeError(w, http.StatusForbidden, "Please verify your email address first")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sendVerificationEmail mails u a signed link binding their id to their
+// current address, so the link stops working if the address changes.
+func (s *Server) sendVerificationEmail(u *db.UserRow) {
+	payload := strconv.FormatInt(u.ID, 10) + "|" + u.Email
+	token := auth.Sign(s.SigningKeys[0], payload, time.Now().Add(emailVerificationTTL))
+	link := s.BaseURL + "/verify-email?token=" + url.QueryEscape(token)
+
+	s.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: "Verify your WhoKnows email address",
+		Body: "Hi " + u.Username + ",\n\n" +
+			"Please confirm that this is your email address by opening this link\n" +
+			"within 48 hours:\n\n" +
+			link + "\n\n" +
+			"If you didn't create a WhoKnows account, you can ignore this email.\n",
+	})
+}
+
+// VerifyEmail handles the link from a verification email.
+func (s *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	payload, err := auth.VerifySigned(s.SigningKeys, r.URL.Query().Get("token"), time.Now())
+	if errors.Is(err, auth.ErrSignedTokenExpired) {
+		s.flashAndRedirect(w, r, "The verification link has expired, request a new one below", "/verify-email/resend")
+		return
+	}
+	if err != nil {
+		s.flashAndRedirect(w, r, "The verification link is invalid", "/verify-email/resend")
+		return
+	}
+
+	idPart, email, _ := strings.Cut(payload, "|")
+	userID, _ := strconv.ParseInt(idPart, 10, 64)
+
+	err = db.MarkEmailVerified(r.Context(), s.DB, userID, email)
+	switch {
+	case errors.Is(err, db.ErrEmailAlreadyVerified):
+		s.flashAndRedirect(w, r, "This verification link was already used, your email address is verified", "/")
+	case errors.Is(err, db.ErrUserNotFound):
+		s.flashAndRedirect(w, r, "The verification link is no longer valid for this account", "/verify-email/resend")
+	case err != nil:
+		log.Printf("mark email verified failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/")
+	default:
+		s.flashAndRedirect(w, r, "Your email address was verified", "/")
+	}
+}
+
+func (s *Server) ServeResendVerificationPage(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, "verify_email.html", ViewData{User: currentUser(r), Flashes: s.getFlashes(w, r), CSRFToken: s.csrfToken(w, r)})
+}
+
+// ResendVerification sends a fresh link to the logged-in user, or to the
+// address in the `email` form field for users who can't log in yet. The
+// response is the same whether or not anything was sent.
+func (s *Server) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var (
+		u   *db.UserRow
+		err error
+	)
+	if cu := currentUser(r); cu != nil {
+		u, err = db.GetUserByID(r.Context(), s.DB, cu.ID)
+	} else {
+		if !requireFormFields(w, r, "email") {
+			return
+		}
+		u, err = db.GetUserByEmail(r.Context(), s.DB, strings.TrimSpace(r.FormValue("email")))
+	}
+
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+	case err != nil:
+		log.Printf("resend verification lookup failed: %v", err)
+	case u.EmailVerifiedAt == nil:
+		s.sendVerificationEmail(u)
+	}
+
+	s.flashAndRedirect(w, r, resendVerificationMessage, "/")
+}
+
+// ParseEmailVerificationPolicy maps the WHOKNOWS_EMAIL_VERIFICATION setting
+// to a policy. An empty value means VerifyEmailOff.
+func ParseEmailVerificationPolicy(v string) (EmailVerificationPolicy, error) {
+	switch p := EmailVerificationPolicy(strings.TrimSpace(v)); p {
+	case "":
+		return VerifyEmailOff, nil
+	case VerifyEmailOff, VerifyEmailFeatures, VerifyEmailLogin:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown email verification policy %q (want off, features or login)", v)
+	}
+}
@@ -0,0 +1,53 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseEmailVerificationPolicy(t *testing.T) {
+	for in, want := range map[string]EmailVerificationPolicy{
+		"":         VerifyEmailOff,
+		"off":      VerifyEmailOff,
+		"features": VerifyEmailFeatures,
+		"login":    VerifyEmailLogin,
+	} {
+		got, err := ParseEmailVerificationPolicy(in)
+		if err != nil {
+			t.Errorf("ParseEmailVerificationPolicy(%q) returned error: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("ParseEmailVerificationPolicy(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if _, err := ParseEmailVerificationPolicy("sometimes"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	cases := []struct {
+		policy   EmailVerificationPolicy
+		verified bool
+		want     int
+	}{
+		{VerifyEmailOff, false, http.StatusNoContent},
+		{VerifyEmailFeatures, false, http.StatusForbidden},
+		{VerifyEmailFeatures, true, http.StatusNoContent},
+	}
+	for _, c := range cases {
+		s := &Server{EmailVerification: c.policy}
+		req := httptest.NewRequest(http.MethodPost, "/api/tags", nil)
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey, &User{ID: 1, EmailVerified: c.verified}))
+		rec := httptest.NewRecorder()
+
+		s.RequireVerifiedEmail(ok).ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("policy=%s verified=%v: expected status %d, got %d", c.policy, c.verified, c.want, rec.Code)
+		}
+	}
+}
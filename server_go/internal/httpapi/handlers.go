@@ -7,6 +7,7 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,13 +17,15 @@ import (
 	"whoknows_variations/server_go/internal/auth"
 	"whoknows_variations/server_go/internal/db"
 	"whoknows_variations/server_go/internal/metrics"
-	"whoknows_variations/server_go/internal/searchlog"
 )
 
 type contextKey string
 
 const userContextKey contextKey = "user"
 
+// maxJSONFormBytes caps JSON bodies of the auth endpoints.
+const maxJSONFormBytes = 64 << 10
+
 type AuthResponse struct {
 	StatusCode *int    `json:"statusCode"`
 	Message    *string `json:"message"`
@@ -37,6 +40,13 @@ type RequestValidationError struct {
 	Message    *string `json:"message"`
 }
 
+// ErrorResponse is the JSON body for API errors other than request
+// validation failures.
+type ErrorResponse struct {
+	StatusCode int    `json:"statusCode"`
+	Message    string `json:"message"`
+}
+
 type ValidationError struct {
 	Loc  []any  `json:"loc"`
 	Msg  string `json:"msg"`
@@ -48,23 +58,80 @@ type HTTPValidationError struct {
 }
 
 type User struct {
-	ID       int64
-	Username string
-	Email    string
+	ID            int64
+	Username      string
+	Email         string
+	EmailVerified bool
+	// Role is one of db.Roles; templates check it with HasRole.
+	Role string
+	// TwoFactor is set when the user has two-factor login on.
+	TwoFactor bool
+	// SearchHistory is false when the user opted out of search history.
+	SearchHistory bool
+	// TokenID is the personal API token the request authenticated with, or
+	// 0 for session logins.
+	TokenID int64
+	// Scopes limits what a token-authenticated request may do. It is unused
+	// for session logins, which may do anything the user can.
+	Scopes []string
 }
 
 type ViewData struct {
-	User    *User
-	Flashes []string
-	Error   string
-	Results []map[string]any
-	Query   string
+	User      *User
+	Flashes   []string
+	Error     string
+	Results   []map[string]any
+	Query     string
+	Tag       string
+	Sessions  []ActiveSession
+	Token     string
+	APITokens []APIToken
+	// NewAPIToken is a token that was just created; the page shows it once.
+	NewAPIToken string
+	TwoFactor   *TwoFactorView
+	History     *HistoryView
+	// RecentQueries are offered as suggestions in the search box.
+	RecentQueries []string
+	Bookmarks     []Bookmark
+	SavedSearches []SavedSearch
+	Notifications []Notification
+	// Language is the search's language filter, if any.
+	Language    string
+	Preferences *PreferencesView
+	Analytics   *SearchAnalytics
+	// UILanguage sets the page's lang attribute; empty means "en".
+	UILanguage string
+	// ReturnTo is the current page, for forms that should come back to it.
+	ReturnTo string
+	// HasPassword is false for single sign-on accounts that never set one.
+	HasPassword bool
+	// SSOName labels the single sign-on button; empty hides it.
+	SSOName string
+	// CSRFToken goes into a hidden csrf_token field on every POST form.
+	CSRFToken string
 }
 
-// UserFromSession is chi middleware that loads the logged-in user (if any)
-// from the session cookie and stores it in the request context.
-func (s *Server) UserFromSession(next http.Handler) http.Handler {
+// Authenticate is chi middleware that loads the user (if any) from an
+// `Authorization: Bearer` personal API token or, failing that, from the
+// session cookie, and stores it in the request context. A bearer token that
+// doesn't check out is rejected with a 401 rather than ignored.
+func (s *Server) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			u, err := s.userFromAPIToken(r, token)
+			if err != nil {
+				if !errors.Is(err, db.ErrAPITokenNotFound) && !errors.Is(err, db.ErrUserNotFound) {
+					log.Printf("api token lookup failed: %v", err)
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer realm="whoknows"`)
+				writeError(w, http.StatusUnauthorized, "Invalid API token")
+				return
+			}
+			ctx := context.WithValue(r.Context(), userContextKey, u)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		sess, _ := s.Sessions.Get(r, SessionName)
 		uid, ok := sess.Values["user_id"]
 		if !ok {
@@ -84,17 +151,40 @@ func (s *Server) UserFromSession(next http.Handler) http.Handler {
 			return
 		}
 
-		u := &User{ID: row.ID, Username: row.Username, Email: row.Email}
-		ctx := context.WithValue(r.Context(), userContextKey, u)
+		ctx := context.WithValue(r.Context(), userContextKey, userFromRow(row))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func userFromRow(row *db.UserRow) *User {
+	return &User{
+		ID:            row.ID,
+		Username:      row.Username,
+		Email:         row.Email,
+		EmailVerified: row.EmailVerifiedAt != nil,
+		Role:          row.Role,
+		TwoFactor:     row.TOTPEnabledAt != nil,
+		SearchHistory: row.SearchHistoryEnabled,
+	}
+}
+
 func currentUser(r *http.Request) *User {
 	u, _ := r.Context().Value(userContextKey).(*User)
 	return u
 }
 
+// RequireLogin is chi middleware that rejects anonymous requests with a 401.
+// It relies on Authenticate having run first.
+func RequireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentUser(r) == nil {
+			writeError(w, http.StatusUnauthorized, "Login required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *Server) getFlashes(w http.ResponseWriter, r *http.Request) []string {
 	sess, _ := s.Sessions.Get(r, SessionName)
 	raw := sess.Flashes()
@@ -109,6 +199,20 @@ func (s *Server) getFlashes(w http.ResponseWriter, r *http.Request) []string {
 	return out
 }
 
+// authResult answers an auth request: API clients get an AuthResponse with
+// status and msg, browsers get msg flashed and a redirect to `to`.
+func (s *Server) authResult(w http.ResponseWriter, r *http.Request, status int, msg, to string) {
+	if wantsJSON(r) {
+		writeAuthResponse(w, status, msg)
+		return
+	}
+	s.flashAndRedirect(w, r, msg, to)
+}
+
+func writeAuthResponse(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, AuthResponse{StatusCode: &status, Message: &msg})
+}
+
 // flashAndRedirect stashes a message in the session and redirects to `to`.
 // The message renders via layout.html's `.Flashes` on the next page load.
 func (s *Server) flashAndRedirect(w http.ResponseWriter, r *http.Request, msg, to string) {
@@ -187,18 +291,22 @@ func loadTemplateFor(pageFilename string) (*template.Template, error) {
 
 // render helper — parses layout + requested page, executes the page template
 func renderTemplate(w http.ResponseWriter, name string, data any) {
+	renderTemplateStatus(w, http.StatusOK, name, data)
+}
+
+func renderTemplateStatus(w http.ResponseWriter, status int, name string, data any) {
 	t, err := loadTemplateFor(name)
 	if err != nil {
 		_, _ = os.Stderr.WriteString("templates load error: " + err.Error() + "\n")
 		// fallback if templates failed to load
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(status)
 		_, _ = w.Write([]byte("<html><head></head><body><h1>WhoKnows</h1></body></html>"))
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	// First try to execute the page's own template (e.g. "about.html")
 	if execErr := t.ExecuteTemplate(w, name, data); execErr != nil {
@@ -218,6 +326,10 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{StatusCode: status, Message: msg})
+}
+
 func writeLoginRegisterValidationError(w http.ResponseWriter, field string) {
 	writeJSON(w, http.StatusUnprocessableEntity, HTTPValidationError{
 		Detail: []ValidationError{
@@ -231,7 +343,7 @@ func writeLoginRegisterValidationError(w http.ResponseWriter, field string) {
 }
 
 func requireFormFields(w http.ResponseWriter, r *http.Request, requiredFields ...string) bool {
-	if err := r.ParseForm(); err != nil {
+	if err := parseRequestForm(w, r); err != nil {
 		writeLoginRegisterValidationError(w, requiredFields[0])
 		return false
 	}
@@ -245,6 +357,80 @@ func requireFormFields(w http.ResponseWriter, r *http.Request, requiredFields ..
 	return true
 }
 
+// parseRequestForm parses a form post or a JSON object body into r.PostForm.
+func parseRequestForm(w http.ResponseWriter, r *http.Request) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return parseJSONForm(w, r)
+	}
+	return r.ParseForm()
+}
+
+// parseJSONForm decodes a JSON object body into r.PostForm and r.Form, so
+// handlers read JSON and form posts the same way. String members become one
+// value and arrays of strings become repeated values, like a multi-select;
+// anything else counts as a missing field.
+func parseJSONForm(w http.ResponseWriter, r *http.Request) error {
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONFormBytes)).Decode(&body); err != nil {
+		return err
+	}
+
+	r.PostForm = url.Values{}
+	for k, raw := range body {
+		var v string
+		if json.Unmarshal(raw, &v) == nil {
+			r.PostForm.Set(k, v)
+			continue
+		}
+		var vs []string
+		if json.Unmarshal(raw, &vs) == nil && vs != nil {
+			r.PostForm[k] = vs
+		}
+	}
+	r.Form = r.URL.Query()
+	for k, v := range r.PostForm {
+		r.Form[k] = append(v, r.Form[k]...)
+	}
+	return nil
+}
+
+// searchParams builds the db search filters from the query string, falling
+// back to prefs for the language and page size. A non-empty message means a
+// filter names an unknown language or tag and should be reported to the
+// client as a validation error.
+func (s *Server) searchParams(r *http.Request, prefs Preferences) (db.SearchParams, string, error) {
+	params := db.SearchParams{
+		Query: strings.TrimSpace(r.URL.Query().Get("q")),
+		Tag:   strings.TrimSpace(r.URL.Query().Get("tag")),
+		Limit: prefs.PageSize,
+	}
+
+	lang, err := s.languageParam(r)
+	if errors.Is(err, db.ErrLanguageNotFound) {
+		return params, "Unknown language: " + strings.TrimSpace(r.URL.Query().Get("language")), nil
+	}
+	if err != nil {
+		return params, "", err
+	}
+	if lang == nil {
+		if lang, err = s.preferredLanguage(r, prefs); err != nil {
+			return params, "", err
+		}
+	}
+	params.Language = lang
+
+	if params.Tag != "" {
+		_, err := db.GetTagBySlug(r.Context(), s.DB, params.Tag)
+		if errors.Is(err, db.ErrTagNotFound) {
+			return params, "Unknown tag: " + params.Tag, nil
+		}
+		if err != nil {
+			return params, "", err
+		}
+	}
+	return params, "", nil
+}
+
 func writeSearchValidationError(w http.ResponseWriter, msg string) {
 	writeJSON(w, http.StatusUnprocessableEntity, RequestValidationError{
 		StatusCode: http.StatusUnprocessableEntity,
@@ -261,42 +447,74 @@ func writeSearchValidationError(w http.ResponseWriter, msg string) {
 // @Router / [get]
 func (s *Server) ServeRootPage(w http.ResponseWriter, r *http.Request) {
 	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	prefs := s.preferences(r)
 
-	langParam := strings.TrimSpace(r.URL.Query().Get("language"))
-	var lang *string
-	if langParam != "" {
-		lang = &langParam
+	params, invalid, err := s.searchParams(r, prefs)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if invalid != "" {
+		renderTemplate(w, "search.html", ViewData{
+			User:       currentUser(r),
+			Flashes:    s.getFlashes(w, r),
+			Error:      invalid,
+			Query:      q,
+			UILanguage: prefs.UILanguage,
+			CSRFToken:  s.layoutCSRFToken(w, r),
+		})
+		return
 	}
 
 	var results []map[string]any
 	if q != "" {
-		var err error
 		started := time.Now()
-		results, err = db.SearchPages(r.Context(), s.DB, q, lang)
+		results, err = db.Search(r.Context(), s.DB, params)
 		if err != nil {
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 		metrics.ObserveSearch(time.Since(started), len(results))
-		if err := searchlog.LogSearch(q, lang, len(results)); err != nil {
-			log.Printf("search log write failed: %v", err)
+		s.logSearch(r, q, params.Language, len(results))
+		s.recordSearchHistory(r, q, params, len(results))
+		s.markBookmarked(r, results)
+		if prefs.ShowSnippets {
+			for _, row := range results {
+				content, _ := row["content"].(string)
+				row["snippet"] = snippet(content, q, snippetLength)
+			}
 		}
 	}
 
+	var language string
+	if params.Language != nil {
+		language = *params.Language
+	}
 	renderTemplate(w, "search.html", ViewData{
-		User:    currentUser(r),
-		Flashes: s.getFlashes(w, r),
-		Results: results,
-		Query:   q,
+		User:          currentUser(r),
+		Flashes:       s.getFlashes(w, r),
+		Results:       results,
+		Query:         q,
+		Tag:           params.Tag,
+		Language:      language,
+		UILanguage:    prefs.UILanguage,
+		RecentQueries: s.recentQueries(r),
+		ReturnTo:      r.URL.RequestURI(),
+		CSRFToken:     s.layoutCSRFToken(w, r),
 	})
 }
 
 func (s *Server) ServeSearchPage(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "search.html", ViewData{User: currentUser(r), Flashes: s.getFlashes(w, r)})
+	renderTemplate(w, "search.html", ViewData{
+		User:          currentUser(r),
+		Flashes:       s.getFlashes(w, r),
+		RecentQueries: s.recentQueries(r),
+		CSRFToken:     s.layoutCSRFToken(w, r),
+	})
 }
 
 func (s *Server) ServeAboutPage(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "about.html", ViewData{User: currentUser(r), Flashes: s.getFlashes(w, r)})
+	renderTemplate(w, "about.html", ViewData{User: currentUser(r), Flashes: s.getFlashes(w, r), CSRFToken: s.layoutCSRFToken(w, r)})
 }
 
 // ServeRegisterPage godoc
@@ -311,7 +529,7 @@ func (s *Server) ServeRegisterPage(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	renderTemplate(w, "register.html", ViewData{Flashes: s.getFlashes(w, r)})
+	renderTemplate(w, "register.html", ViewData{Flashes: s.getFlashes(w, r), CSRFToken: s.csrfToken(w, r)})
 }
 
 // ServeLoginPage godoc
@@ -326,7 +544,7 @@ func (s *Server) ServeLoginPage(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	renderTemplate(w, "login.html", ViewData{Flashes: s.getFlashes(w, r)})
+	renderTemplate(w, "login.html", ViewData{Flashes: s.getFlashes(w, r), CSRFToken: s.csrfToken(w, r), SSOName: s.ssoName()})
 }
 
 // Search godoc
@@ -335,9 +553,10 @@ func (s *Server) ServeLoginPage(w http.ResponseWriter, r *http.Request) {
 // @Tags search
 // @Produce json
 // @Param q query string true "Search query"
-// @Param language query string false "Language code (e.g., 'en')"
+// @Param language query string false "Language code (e.g., 'en'); one of the codes from /api/languages"
+// @Param tag query string false "Tag slug; only pages with this tag are returned"
 // @Success 200 {object} SearchResponse
-// @Failure 422 {object} RequestValidationError "Unprocessable Entity"
+// @Failure 422 {object} RequestValidationError "Missing q, an unknown or disabled language, or an unknown tag"
 // @Router /api/search [get]
 func (s *Server) Search(w http.ResponseWriter, r *http.Request) {
 	q := strings.TrimSpace(r.URL.Query().Get("q"))
@@ -347,23 +566,27 @@ func (s *Server) Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	langParam := r.URL.Query().Get("language")
-	var lang *string
-	if langParam != "" {
-		lang = &langParam
+	params, invalid, err := s.searchParams(r, s.preferences(r))
+	if err != nil {
+		log.Printf("search filter lookup failed: %v", err)
+		writeJSON(w, http.StatusOK, SearchResponse{Data: []map[string]any{}})
+		return
+	}
+	if invalid != "" {
+		writeSearchValidationError(w, invalid)
+		return
 	}
 
 	started := time.Now()
-	results, err := db.SearchPages(r.Context(), s.DB, q, lang)
+	results, err := db.Search(r.Context(), s.DB, params)
 	if err != nil {
 		log.Printf("search query failed: %v", err)
 		writeJSON(w, http.StatusOK, SearchResponse{Data: []map[string]any{}})
 		return
 	}
 	metrics.ObserveSearch(time.Since(started), len(results))
-	if err := searchlog.LogSearch(q, lang, len(results)); err != nil {
-		log.Printf("search log write failed: %v", err)
-	}
+	s.logSearch(r, q, params.Language, len(results))
+	s.recordSearchHistory(r, q, params, len(results))
 
 	writeJSON(w, http.StatusOK, SearchResponse{Data: results})
 }
@@ -379,6 +602,7 @@ func (s *Server) Search(w http.ResponseWriter, r *http.Request) {
 // @Param password formData string true "Password"
 // @Param password2 formData string false "Password2"
 // @Success 200 {object} AuthResponse
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token"
 // @Failure 422 {object} HTTPValidationError "Validation Error"
 // @Router /api/register [post]
 func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
@@ -387,6 +611,10 @@ func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if currentUser(r) != nil {
+		if wantsJSON(r) {
+			writeAuthResponse(w, http.StatusConflict, "Log out before registering a new account")
+			return
+		}
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -412,24 +640,40 @@ func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 			formError = "The username is already taken"
 		} else if !errors.Is(err, db.ErrUserNotFound) {
 			log.Printf("register username lookup failed: %v", err)
-			s.flashAndRedirect(w, r, "Internal error, please try again", "/register")
+			s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/register")
 			return
 		}
 	}
 
 	if formError != "" {
-		s.flashAndRedirect(w, r, formError, "/register")
+		s.authResult(w, r, http.StatusBadRequest, formError, "/register")
 		return
 	}
 
 	hash := auth.HashPassword(password)
-	if err := db.CreateUser(r.Context(), s.DB, username, email, hash); err != nil {
+	err := db.CreateUser(r.Context(), s.DB, username, email, hash)
+	if errors.Is(err, db.ErrEmailTaken) {
+		s.authResult(w, r, http.StatusConflict, "That email address is already in use", "/register")
+		return
+	}
+	if err != nil {
 		log.Printf("register create user failed: %v", err)
-		s.flashAndRedirect(w, r, "Internal error, please try again", "/register")
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/register")
 		return
 	}
 
-	s.flashAndRedirect(w, r, "You were successfully registered and can login now", "/login")
+	if created, err := db.GetUserByUsername(r.Context(), s.DB, username); err != nil {
+		log.Printf("register lookup for verification email failed: %v", err)
+	} else {
+		s.audit(r, db.EventRegister, created.ID, created.Username, "")
+		s.sendVerificationEmail(created)
+	}
+
+	if s.EmailVerification == VerifyEmailLogin {
+		s.authResult(w, r, http.StatusOK, "You were successfully registered. Check your email and verify your address before logging in", "/login")
+		return
+	}
+	s.authResult(w, r, http.StatusOK, "You were successfully registered and can login now", "/login")
 }
 
 // Login godoc
@@ -441,6 +685,7 @@ func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 // @Param username formData string true "Username"
 // @Param password formData string true "Password"
 // @Success 200 {object} AuthResponse
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token"
 // @Failure 422 {object} HTTPValidationError "Validation Error"
 // @Router /api/login [post]
 func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
@@ -449,47 +694,110 @@ func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if currentUser(r) != nil {
+		if wantsJSON(r) {
+			writeAuthResponse(w, http.StatusOK, "You are already logged in")
+			return
+		}
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	username := strings.TrimSpace(r.FormValue("username"))
 	password := r.FormValue("password")
+	ip := s.clientIP(r)
+	account := throttleAccountKey(username)
 
-	user, err := db.GetUserByUsername(r.Context(), s.DB, username)
+	lockedUntil, err := s.loginLockedUntil(r.Context(), ip, account)
 	if err != nil {
-		if errors.Is(err, db.ErrUserNotFound) {
-			s.flashAndRedirect(w, r, "Invalid username", "/login")
-			return
-		}
+		log.Printf("login throttle lookup failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/login")
+		return
+	}
+	if !lockedUntil.IsZero() {
+		metrics.ObserveLoginFailure("locked")
+		s.audit(r, db.EventLoginFailed, 0, username, "locked")
+		s.authResult(w, r, http.StatusTooManyRequests, lockedMessage(lockedUntil), "/login")
+		return
+	}
+
+	user, err := db.GetUserByUsername(r.Context(), s.DB, username)
+	if err != nil && !errors.Is(err, db.ErrUserNotFound) {
 		log.Printf("login username lookup failed: %v", err)
-		s.flashAndRedirect(w, r, "Internal error, please try again", "/login")
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/login")
 		return
 	}
 
-	if !auth.VerifyPassword(user.PasswordHash, password) {
-		s.flashAndRedirect(w, r, "Invalid password", "/login")
+	// Unknown usernames and wrong passwords get the same answer, and cost
+	// the same hash verification, so neither reveals which accounts exist.
+	storedHash := dummyPasswordHash
+	if user != nil {
+		storedHash = user.PasswordHash
+	}
+	if !auth.VerifyPassword(storedHash, password) || user == nil {
+		s.recordLoginFailure(r.Context(), ip, account)
+		var userID int64
+		if user != nil {
+			userID = user.ID
+		}
+		s.audit(r, db.EventLoginFailed, userID, username, "invalid credentials")
+		s.authResult(w, r, http.StatusUnauthorized, invalidCredentialsFlash, "/login")
 		return
 	}
 
+	if auth.NeedsRehash(user.PasswordHash) {
+		wasLegacy := !auth.IsArgon2id(user.PasswordHash)
+		if err := db.UpdatePasswordHash(r.Context(), s.DB, user.ID, auth.HashPassword(password)); err != nil {
+			log.Printf("login password rehash failed: %v", err)
+		} else if wasLegacy {
+			metrics.ObservePasswordRehash()
+		}
+	}
+
+	if s.EmailVerification == VerifyEmailLogin && user.EmailVerifiedAt == nil {
+		s.audit(r, db.EventLoginFailed, user.ID, user.Username, "email not verified")
+		s.authResult(w, r, http.StatusForbidden, "You have to verify your email address before you can login", "/verify-email/resend")
+		return
+	}
+
+	s.completeLogin(w, r, user, "password")
+}
+
+// logIn binds the session to userID once the user has proven who they are.
+func (s *Server) logIn(w http.ResponseWriter, r *http.Request, userID int64) {
 	sess, _ := s.Sessions.Get(r, SessionName)
-	sess.Values["user_id"] = user.ID
+	// Issue a fresh session token and CSRF token on login to prevent
+	// session fixation.
+	sess.ID = ""
+	delete(sess.Values, csrfSessionKey)
+	delete(sess.Values, pendingUserKey)
+	delete(sess.Values, pendingSinceKey)
+	sess.Values["user_id"] = userID
 	_ = sess.Save(r, w)
-
-	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 // Logout godoc
 // @Summary Logout
-// @Description Clear the session and log the user out.
+// @Description Clear the session and log the user out. Needs the CSRF token from /api/csrf-token.
 // @Tags auth
 // @Produce json
 // @Success 200 {object} AuthResponse
-// @Router /api/logout [get]
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token"
+// @Router /api/logout [post]
+//
+// Logout is served as POST behind the CSRF check. The GET route only exists
+// when AllowGetLogout is set, for clients that still use the old link.
 func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	if u := currentUser(r); u != nil {
+		s.audit(r, db.EventLogout, u.ID, u.Username, "")
+	}
 	sess, _ := s.Sessions.Get(r, SessionName)
 	delete(sess.Values, "user_id")
+	sess.Options.MaxAge = -1
 	_ = sess.Save(r, w)
 
+	if wantsJSON(r) {
+		writeAuthResponse(w, http.StatusOK, "You were logged out")
+		return
+	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -0,0 +1,54 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+type Language struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type LanguagesResponse struct {
+	Data []Language `json:"data"`
+}
+
+// languageParam reads the optional `language` query parameter and checks it
+// against the languages table. A nil result means "use the default".
+// Unknown or disabled codes yield db.ErrLanguageNotFound.
+func (s *Server) languageParam(r *http.Request) (*string, error) {
+	code := strings.TrimSpace(r.URL.Query().Get("language"))
+	if code == "" {
+		return nil, nil
+	}
+	if _, err := db.GetEnabledLanguage(r.Context(), s.DB, code); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// Languages godoc
+// @Summary Languages
+// @Description Lists the enabled search languages, for the language picker and the `language` search parameter.
+// @Tags search
+// @Produce json
+// @Success 200 {object} LanguagesResponse
+// @Router /api/languages [get]
+func (s *Server) Languages(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ListEnabledLanguages(r.Context(), s.DB)
+	if err != nil {
+		log.Printf("list languages failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]Language, len(rows))
+	for i, l := range rows {
+		out[i] = Language{Code: l.Code, Name: l.Name}
+	}
+	writeJSON(w, http.StatusOK, LanguagesResponse{Data: out})
+}
@@ -0,0 +1,217 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/oidc"
+)
+
+// oidcFlowTTL bounds how long a user may spend at the provider.
+const oidcFlowTTL = 10 * time.Minute
+
+const (
+	oidcStateKey    = "oidc_state"
+	oidcNonceKey    = "oidc_nonce"
+	oidcVerifierKey = "oidc_verifier"
+	oidcStartedKey  = "oidc_started"
+)
+
+const ssoFailedFlash = "Single sign-on failed, please try again"
+
+func (s *Server) ssoName() string {
+	if s.OIDC == nil {
+		return ""
+	}
+	if s.OIDCName == "" {
+		return "SSO"
+	}
+	return s.OIDCName
+}
+
+// StartOIDCLogin sends the browser to the provider with a fresh state,
+// nonce and PKCE challenge, remembering them in the session for the
+// callback.
+func (s *Server) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.OIDC == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if currentUser(r) != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	state, _ := auth.NewToken()
+	nonce, _ := auth.NewToken()
+	verifier := oidc.NewPKCEVerifier()
+
+	sess, _ := s.Sessions.Get(r, SessionName)
+	sess.Values[oidcStateKey] = state
+	sess.Values[oidcNonceKey] = nonce
+	sess.Values[oidcVerifierKey] = verifier
+	sess.Values[oidcStartedKey] = time.Now().Unix()
+	if err := sess.Save(r, w); err != nil {
+		log.Printf("oidc session save failed: %v", err)
+		s.flashAndRedirect(w, r, ssoFailedFlash, "/login")
+		return
+	}
+
+	http.Redirect(w, r, s.OIDC.AuthCodeURL(state, nonce, oidc.PKCEChallenge(verifier)), http.StatusFound)
+}
+
+// OIDCCallback finishes the flow: it checks state, redeems the code, and
+// logs in the linked, matched or newly provisioned user.
+func (s *Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.OIDC == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The flow values are single use, whatever happens next.
+	sess, _ := s.Sessions.Get(r, SessionName)
+	state, _ := sess.Values[oidcStateKey].(string)
+	nonce, _ := sess.Values[oidcNonceKey].(string)
+	verifier, _ := sess.Values[oidcVerifierKey].(string)
+	started, _ := sess.Values[oidcStartedKey].(int64)
+	for _, k := range []string{oidcStateKey, oidcNonceKey, oidcVerifierKey, oidcStartedKey} {
+		delete(sess.Values, k)
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		log.Printf("oidc provider returned error: %s", strconv.Quote(e))
+		s.flashAndRedirect(w, r, "Single sign-on was cancelled or refused", "/login")
+		return
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(state)) != 1 ||
+		time.Since(time.Unix(started, 0)) > oidcFlowTTL {
+		s.flashAndRedirect(w, r, "Your single sign-on attempt expired, please try again", "/login")
+		return
+	}
+
+	claims, err := s.OIDC.Exchange(r.Context(), q.Get("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("oidc exchange failed: %v", err)
+		s.flashAndRedirect(w, r, ssoFailedFlash, "/login")
+		return
+	}
+
+	user, refusal, err := s.resolveOIDCUser(r.Context(), claims.Subject, claims.Email, bool(claims.EmailVerified), claims.PreferredUsername)
+	if err != nil {
+		log.Printf("oidc user lookup failed: %v", err)
+		s.flashAndRedirect(w, r, ssoFailedFlash, "/login")
+		return
+	}
+	if refusal != "" {
+		s.audit(r, db.EventLoginFailed, 0, claims.Email, "sso: "+refusal)
+		s.flashAndRedirect(w, r, refusal, "/login")
+		return
+	}
+
+	if s.EmailVerification == VerifyEmailLogin && user.EmailVerifiedAt == nil {
+		s.audit(r, db.EventLoginFailed, user.ID, user.Username, "email not verified")
+		s.flashAndRedirect(w, r, "You have to verify your email address before you can login", "/verify-email/resend")
+		return
+	}
+
+	s.completeLogin(w, r, user, "sso")
+}
+
+// resolveOIDCUser finds the user for a provider identity: an already linked
+// user, else a user with the same verified email (which links them), else a
+// new user when auto-provisioning is on. A non-empty refusal is shown to
+// the user instead of logging them in.
+func (s *Server) resolveOIDCUser(ctx context.Context, subject, email string, emailVerified bool, preferredUsername string) (*db.UserRow, string, error) {
+	issuer := s.OIDC.Issuer()
+	u, err := db.GetUserByIdentity(ctx, s.DB, issuer, subject)
+	if err == nil {
+		return u, "", nil
+	}
+	if !errors.Is(err, db.ErrUserNotFound) {
+		return nil, "", err
+	}
+
+	email = strings.TrimSpace(email)
+	if email == "" || !emailVerified {
+		return nil, "Your identity provider did not share a verified email address", nil
+	}
+
+	u, err = db.GetUserByEmail(ctx, s.DB, email)
+	switch {
+	case err == nil && u.EmailVerifiedAt == nil:
+		// Linking to an unverified account would hand the provider's user
+		// an account someone else may have registered with their address.
+		return nil, "An account with this email address already exists. Log in with your password and verify your email address first", nil
+	case err == nil:
+		if err := db.LinkIdentity(ctx, s.DB, u.ID, issuer, subject); err != nil {
+			return nil, "", err
+		}
+		return u, "", nil
+	case !errors.Is(err, db.ErrUserNotFound):
+		return nil, "", err
+	}
+
+	if !s.OIDCAutoProvision {
+		return nil, "No account uses this email address. Ask an administrator to create one", nil
+	}
+	username, err := s.freeUsername(ctx, ssoUsernameBase(preferredUsername, email))
+	if err != nil {
+		return nil, "", err
+	}
+	u, err = db.CreateSSOUser(ctx, s.DB, username, email, issuer, subject)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, "", nil
+}
+
+// ssoUsernameBase derives a username from the provider's preferred username
+// or, failing that, the local part of the email address.
+func ssoUsernameBase(preferred, email string) string {
+	base := preferred
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	var b strings.Builder
+	for _, r := range base {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+		if b.Len() >= 32 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
+
+// freeUsername returns base, or base followed by the first number that
+// makes it unique.
+func (s *Server) freeUsername(ctx context.Context, base string) (string, error) {
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate += strconv.Itoa(i)
+		}
+		_, err := db.GetUserByUsername(ctx, s.DB, candidate)
+		if errors.Is(err, db.ErrUserNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New("no free username for " + base)
+}
@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"whoknows_variations/server_go/internal/oidc"
+	"whoknows_variations/server_go/internal/oidc/oidctest"
+)
+
+func oidcTestServer(t *testing.T) *Server {
+	t.Helper()
+	fake := oidctest.NewServer(t, "whoknows", "s3cret")
+	p, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:       fake.Issuer(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+		RedirectURL:  "http://example.com/login/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := testServer()
+	s.OIDC = p
+	return s
+}
+
+func TestOIDCLoginDisabledReturns404(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewRouter(testServer()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestStartOIDCLoginRedirectsWithPKCE(t *testing.T) {
+	s := oidcTestServer(t)
+
+	rec := httptest.NewRecorder()
+	NewRouter(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("expected status 302, got %d", rec.Code)
+	}
+
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := loc.Query()
+	for _, p := range []string{"state", "nonce", "code_challenge"} {
+		if q.Get(p) == "" {
+			t.Errorf("expected a %s parameter in %s", p, loc)
+		}
+	}
+	if q.Get("code_challenge_method") != "S256" {
+		t.Errorf("expected code_challenge_method S256, got %q", q.Get("code_challenge_method"))
+	}
+	if len(rec.Result().Cookies()) == 0 {
+		t.Error("expected the flow to be remembered in the session cookie")
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	s := oidcTestServer(t)
+	r := NewRouter(s)
+
+	start := httptest.NewRecorder()
+	r.ServeHTTP(start, httptest.NewRequest(http.MethodGet, "/login/oidc", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?code=abc&state=forged", nil)
+	for _, c := range start.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("expected a redirect to /login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestSSOUsernameBase(t *testing.T) {
+	cases := []struct{ preferred, email, want string }{
+		{"alice", "a@corp.example", "alice"},
+		{"", "bob.smith@corp.example", "bob.smith"},
+		{"", "<>@corp.example", "user"},
+		{"eve<script>", "", "evescript"},
+	}
+	for _, c := range cases {
+		if got := ssoUsernameBase(c.preferred, c.email); got != c.want {
+			t.Errorf("ssoUsernameBase(%q, %q) = %q, want %q", c.preferred, c.email, got, c.want)
+		}
+	}
+}
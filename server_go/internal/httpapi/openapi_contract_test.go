@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -48,6 +49,7 @@ func TestAPILoginMissingFieldsReturns422HTTPValidationError(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(""))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(t, r, req)
 	rec := httptest.NewRecorder()
 	r.ServeHTTP(rec, req)
 
@@ -74,6 +76,7 @@ func TestAPIRegisterMissingEmailReturns422HTTPValidationError(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(t, r, req)
 	rec := httptest.NewRecorder()
 	r.ServeHTTP(rec, req)
 
@@ -89,3 +92,220 @@ func TestAPIRegisterMissingEmailReturns422HTTPValidationError(t *testing.T) {
 		t.Fatal("expected at least one validation error detail")
 	}
 }
+
+func TestAPILoginJSONMissingPasswordReturns422HTTPValidationError(t *testing.T) {
+	r := NewRouter(testServer())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"alice"}`))
+	req.Header.Set("Content-Type", "application/json")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rec.Code)
+	}
+
+	var body HTTPValidationError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if len(body.Detail) == 0 || len(body.Detail[0].Loc) != 2 || body.Detail[0].Loc[1] != "password" {
+		t.Fatalf("expected a validation error for password, got %+v", body.Detail)
+	}
+}
+
+func TestAPILoginMalformedJSONReturns422HTTPValidationError(t *testing.T) {
+	r := NewRouter(testServer())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":`))
+	req.Header.Set("Content-Type", "application/json")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rec.Code)
+	}
+}
+
+func TestAPIRegisterJSONPasswordMismatchReturnsAuthResponse(t *testing.T) {
+	r := NewRouter(testServer())
+
+	payload := `{"username":"alice","email":"alice@example.com","password":"secret","password2":"other"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("expected a JSON response, got Content-Type %q", ct)
+	}
+
+	var body AuthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if body.StatusCode == nil || *body.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected statusCode 400 in body, got %v", body.StatusCode)
+	}
+	if body.Message == nil || *body.Message != "The two passwords do not match" {
+		t.Fatalf("unexpected message %v", body.Message)
+	}
+}
+
+func TestAPIRegisterFormPasswordMismatchRedirects(t *testing.T) {
+	r := NewRouter(testServer())
+
+	form := url.Values{}
+	form.Set("username", "alice")
+	form.Set("email", "alice@example.com")
+	form.Set("password", "secret")
+	form.Set("password2", "other")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d", rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/register" {
+		t.Fatalf("expected redirect to /register, got %q", loc)
+	}
+}
+
+func TestAPIRegisterEmailTakenInAnyCaseReturns409(t *testing.T) {
+	s := newTestDBServer(t)
+	mustCreateUser(t, s, "alice", "correct horse")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(`{"username":"alice2","email":"Alice@Example.com","password":"secret","password2":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.Register(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAPILogoutWithAcceptJSONReturnsAuthResponse(t *testing.T) {
+	r := NewRouter(testServer())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	req.Header.Set("Accept", "application/json")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var body AuthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if body.StatusCode == nil || *body.StatusCode != http.StatusOK {
+		t.Fatalf("expected statusCode 200 in body, got %v", body.StatusCode)
+	}
+}
+
+func TestAPICreateTagWithoutLoginReturns401(t *testing.T) {
+	s := testServer()
+	r := NewRouter(s)
+
+	form := url.Values{}
+	form.Set("name", "Programming")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tags", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if body.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected statusCode 401 in body, got %d", body.StatusCode)
+	}
+}
+
+func TestAPIForgotPasswordMissingEmailReturns422HTTPValidationError(t *testing.T) {
+	s := testServer()
+	r := NewRouter(s)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/forgot-password", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rec.Code)
+	}
+
+	var body HTTPValidationError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if len(body.Detail) == 0 || body.Detail[0].Loc[1] != "email" {
+		t.Fatalf("expected a validation error for the email field, got %+v", body.Detail)
+	}
+}
+
+func TestAPISearchUnknownLanguageReturns422RequestValidationError(t *testing.T) {
+	r := NewRouter(newTestDBServer(t))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search?q=go&language=xx", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rec.Code)
+	}
+	var body RequestValidationError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if body.Message == nil || *body.Message != "Unknown language: xx" {
+		t.Fatalf("expected the unknown language in the message, got %v", body.Message)
+	}
+}
+
+func TestAPILanguagesListsEnabledLanguages(t *testing.T) {
+	s := newTestDBServer(t)
+	if _, err := s.DB.Exec(context.Background(), "UPDATE languages SET enabled = FALSE WHERE code = 'da'"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = s.DB.Exec(context.Background(), "UPDATE languages SET enabled = TRUE WHERE code = 'da'")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/languages", nil)
+	rec := httptest.NewRecorder()
+	NewRouter(s).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var body LanguagesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if len(body.Data) != 1 || body.Data[0] != (Language{Code: "en", Name: "English"}) {
+		t.Fatalf("expected only English, got %+v", body.Data)
+	}
+}
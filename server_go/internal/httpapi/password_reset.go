@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/mail"
+)
+
+const passwordResetTTL = time.Hour
+
+// forgotPasswordMessage is shown whether or not the email is registered so
+// the form can't be used to discover accounts.
+const forgotPasswordMessage = "If that email address is registered, we have sent a link to reset your password"
+
+func (s *Server) ServeForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, "forgot_password.html", ViewData{User: currentUser(r), Flashes: s.getFlashes(w, r), CSRFToken: s.csrfToken(w, r)})
+}
+
+func (s *Server) ServeResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	ok, err := db.PasswordResetTokenValid(r.Context(), s.DB, auth.HashToken(token))
+	if err != nil {
+		log.Printf("reset token lookup failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/forgot-password")
+		return
+	}
+	if !ok {
+		s.flashAndRedirect(w, r, "The reset link is invalid or has expired", "/forgot-password")
+		return
+	}
+	renderTemplate(w, "reset_password.html", ViewData{Flashes: s.getFlashes(w, r), Token: token, CSRFToken: s.csrfToken(w, r)})
+}
+
+// ForgotPassword emails a single-use reset link to the address in the
+// `email` form field, if it belongs to a user.
+func (s *Server) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "email") {
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	user, err := db.GetUserByEmail(r.Context(), s.DB, email)
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		// Fall through to the same response as a known address.
+	case err != nil:
+		log.Printf("forgot password lookup failed: %v", err)
+	default:
+		token, hash := auth.NewToken()
+		if err := db.CreatePasswordResetToken(r.Context(), s.DB, user.ID, hash, time.Now().Add(passwordResetTTL)); err != nil {
+			log.Printf("create reset token failed: %v", err)
+			break
+		}
+		link := s.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+		s.sendMail(mail.Message{
+			To:      user.Email,
+			Subject: "Reset your WhoKnows password",
+			Body: "Hi " + user.Username + ",\n\n" +
+				"Someone asked to reset the password for your WhoKnows account.\n" +
+				"Open this link within an hour to choose a new one:\n\n" +
+				link + "\n\n" +
+				"If it wasn't you, you can ignore this email.\n",
+		})
+	}
+
+	s.flashAndRedirect(w, r, forgotPasswordMessage, "/login")
+}
+
+// ResetPassword sets a new password using a token from a reset email. All of
+// the user's sessions are revoked afterwards.
+func (s *Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "token", "password") {
+		return
+	}
+
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	back := "/reset-password?token=" + url.QueryEscape(token)
+
+	switch {
+	case password == "":
+		s.flashAndRedirect(w, r, "You have to enter a password", back)
+		return
+	case password != r.FormValue("password2"):
+		s.flashAndRedirect(w, r, "The two passwords do not match", back)
+		return
+	}
+
+	userID, err := db.ResetPassword(r.Context(), s.DB, auth.HashToken(token), auth.HashPassword(password))
+	if errors.Is(err, db.ErrResetTokenInvalid) {
+		s.flashAndRedirect(w, r, "The reset link is invalid or has expired", "/forgot-password")
+		return
+	}
+	if err != nil {
+		log.Printf("reset password failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", back)
+		return
+	}
+	s.audit(r, db.EventPasswordReset, userID, "", "")
+
+	if _, err := db.DeleteUserSessions(r.Context(), s.DB, userID); err != nil {
+		log.Printf("revoke sessions after reset failed: %v", err)
+	}
+	s.endCurrentSession(r)
+	s.flashAndRedirect(w, r, "Your password was changed and you can login now", "/login")
+}
+
+// sendMail delivers msg in the background so the response time doesn't
+// reveal whether an email was sent.
+func (s *Server) sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("send mail failed: %v", err)
+		}
+	}()
+}
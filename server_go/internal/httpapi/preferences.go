@@ -0,0 +1,270 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+const (
+	// preferencesCookie holds the preferences of anonymous visitors.
+	preferencesCookie       = "whoknows_prefs"
+	preferencesCookieMaxAge = 365 * 24 * time.Hour
+	maxPageSize             = 100
+	defaultUILanguage       = "en"
+	snippetLength           = 200
+)
+
+// uiLanguages are the languages the interface can be shown in.
+var uiLanguages = []string{"en", "da"}
+
+// pageSizes are the choices offered on the preferences page. The API takes
+// any size from 1 to maxPageSize.
+var pageSizes = []int{10, 20, 30, 50, 100}
+
+// Preferences are a visitor's search and display settings. An empty
+// SearchLanguage means the default language.
+type Preferences struct {
+	SearchLanguage string `json:"search_language"`
+	PageSize       int    `json:"page_size"`
+	ShowSnippets   bool   `json:"show_snippets"`
+	UILanguage     string `json:"ui_language"`
+}
+
+// PreferencesView is what preferences.html shows.
+type PreferencesView struct {
+	Preferences
+	Languages   []Language
+	PageSizes   []int
+	UILanguages []string
+}
+
+func defaultPreferences() Preferences {
+	return Preferences{PageSize: db.DefaultPageSize, UILanguage: defaultUILanguage}
+}
+
+// encode formats p for the preferences cookie.
+func (p Preferences) encode() string {
+	return url.Values{
+		"lang":     {p.SearchLanguage},
+		"size":     {strconv.Itoa(p.PageSize)},
+		"snippets": {strconv.FormatBool(p.ShowSnippets)},
+		"ui":       {p.UILanguage},
+	}.Encode()
+}
+
+// decodePreferences reads a preferences cookie. Anything missing or invalid
+// keeps its default; the search language is checked when it's used.
+func decodePreferences(v string) Preferences {
+	p := defaultPreferences()
+	q, err := url.ParseQuery(v)
+	if err != nil {
+		return p
+	}
+	p.SearchLanguage = strings.TrimSpace(q.Get("lang"))
+	if n, err := strconv.Atoi(q.Get("size")); err == nil && n >= 1 && n <= maxPageSize {
+		p.PageSize = n
+	}
+	p.ShowSnippets = q.Get("snippets") == "true"
+	if ui := q.Get("ui"); slices.Contains(uiLanguages, ui) {
+		p.UILanguage = ui
+	}
+	return p
+}
+
+// preferences returns the request's preferences: the logged-in user's
+// saved ones, else the preferences cookie, else the defaults.
+func (s *Server) preferences(r *http.Request) Preferences {
+	if u := currentUser(r); u != nil {
+		row, err := db.GetPreferences(r.Context(), s.DB, u.ID)
+		if err == nil {
+			return Preferences{
+				SearchLanguage: row.SearchLanguage,
+				PageSize:       row.PageSize,
+				ShowSnippets:   row.ShowSnippets,
+				UILanguage:     row.UILanguage,
+			}
+		}
+		if !errors.Is(err, db.ErrPreferencesNotFound) {
+			log.Printf("preferences lookup failed: %v", err)
+		}
+	}
+	if c, err := r.Cookie(preferencesCookie); err == nil {
+		return decodePreferences(c.Value)
+	}
+	return defaultPreferences()
+}
+
+// preferredLanguage returns the preferred search language if it is still
+// enabled, and nil for the default.
+func (s *Server) preferredLanguage(r *http.Request, prefs Preferences) (*string, error) {
+	if prefs.SearchLanguage == "" {
+		return nil, nil
+	}
+	_, err := db.GetEnabledLanguage(r.Context(), s.DB, prefs.SearchLanguage)
+	if errors.Is(err, db.ErrLanguageNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prefs.SearchLanguage, nil
+}
+
+// snippet returns about maxLen characters of content around the first
+// match of q, for showing under a search result.
+func snippet(content, q string, maxLen int) string {
+	text := []rune(strings.Join(strings.Fields(content), " "))
+	if len(text) <= maxLen {
+		return string(text)
+	}
+
+	start := 0
+	if i := strings.Index(strings.ToLower(string(text)), strings.ToLower(q)); q != "" && i >= 0 {
+		start = max(len([]rune(string(text)[:i]))-maxLen/4, 0)
+	}
+	end := min(start+maxLen, len(text))
+	start = max(end-maxLen, 0)
+
+	out := string(text[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(text) {
+		out += "…"
+	}
+	return out
+}
+
+func (s *Server) ServePreferencesPage(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ListEnabledLanguages(r.Context(), s.DB)
+	if err != nil {
+		log.Printf("list languages failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	languages := make([]Language, len(rows))
+	for i, l := range rows {
+		languages[i] = Language{Code: l.Code, Name: l.Name}
+	}
+
+	prefs := s.preferences(r)
+	renderTemplate(w, "preferences.html", ViewData{
+		User:    currentUser(r),
+		Flashes: s.getFlashes(w, r),
+		Preferences: &PreferencesView{
+			Preferences: prefs,
+			Languages:   languages,
+			PageSizes:   pageSizes,
+			UILanguages: uiLanguages,
+		},
+		UILanguage: prefs.UILanguage,
+		CSRFToken:  s.csrfToken(w, r),
+	})
+}
+
+// GetPreferences returns the caller's preferences, for logged-in users and
+// anonymous visitors alike.
+func (s *Server) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.preferences(r))
+}
+
+// UpdatePreferences changes the preferences given in the search_language,
+// page_size, show_snippets and ui_language fields, as a form or a JSON
+// object; fields that are left out keep their value. Logged-in users' are
+// saved to their account, anonymous visitors' to a cookie. API tokens can
+// read preferences but not change them.
+func (s *Server) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, msg string) {
+		if wantsJSON(r) {
+			writeError(w, status, msg)
+			return
+		}
+		s.flashAndRedirect(w, r, msg, "/preferences")
+	}
+	if err := parseRequestForm(w, r); err != nil {
+		fail(http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	prefs := s.preferences(r)
+	form := r.PostForm
+	if _, ok := form["search_language"]; ok {
+		code := strings.TrimSpace(form.Get("search_language"))
+		if code != "" {
+			_, err := db.GetEnabledLanguage(r.Context(), s.DB, code)
+			if errors.Is(err, db.ErrLanguageNotFound) {
+				fail(http.StatusBadRequest, "Unknown language: "+code)
+				return
+			}
+			if err != nil {
+				log.Printf("preferences language lookup failed: %v", err)
+				fail(http.StatusInternalServerError, "Internal error, please try again")
+				return
+			}
+		}
+		prefs.SearchLanguage = code
+	}
+	if _, ok := form["page_size"]; ok {
+		n, err := strconv.Atoi(strings.TrimSpace(form.Get("page_size")))
+		if err != nil || n < 1 || n > maxPageSize {
+			fail(http.StatusBadRequest, "page_size must be a number from 1 to "+strconv.Itoa(maxPageSize))
+			return
+		}
+		prefs.PageSize = n
+	}
+	if _, ok := form["show_snippets"]; ok {
+		show, err := strconv.ParseBool(form.Get("show_snippets"))
+		if err != nil {
+			fail(http.StatusBadRequest, "show_snippets must be true or false")
+			return
+		}
+		prefs.ShowSnippets = show
+	}
+	if _, ok := form["ui_language"]; ok {
+		ui := strings.TrimSpace(form.Get("ui_language"))
+		if !slices.Contains(uiLanguages, ui) {
+			fail(http.StatusBadRequest, "ui_language must be one of "+strings.Join(uiLanguages, ", "))
+			return
+		}
+		prefs.UILanguage = ui
+	}
+
+	if u := currentUser(r); u != nil {
+		err := db.SavePreferences(r.Context(), s.DB, db.PreferencesRow{
+			UserID:         u.ID,
+			SearchLanguage: prefs.SearchLanguage,
+			PageSize:       prefs.PageSize,
+			ShowSnippets:   prefs.ShowSnippets,
+			UILanguage:     prefs.UILanguage,
+		})
+		if err != nil {
+			log.Printf("save preferences failed: %v", err)
+			fail(http.StatusInternalServerError, "Internal error, please try again")
+			return
+		}
+	} else {
+		http.SetCookie(w, &http.Cookie{
+			Name:     preferencesCookie,
+			Value:    prefs.encode(),
+			Path:     "/",
+			MaxAge:   int(preferencesCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			Secure:   s.SecureCookies,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, prefs)
+		return
+	}
+	s.flashAndRedirect(w, r, "Your preferences were saved", "/preferences")
+}
@@ -0,0 +1,170 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+)
+
+func TestPreferencesCookieRoundTrip(t *testing.T) {
+	want := Preferences{SearchLanguage: "da", PageSize: 50, ShowSnippets: true, UILanguage: "da"}
+	if got := decodePreferences(want.encode()); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDecodePreferencesFallsBackToDefaults(t *testing.T) {
+	for _, v := range []string{"", "%zz", "size=0&ui=fr", "size=500&snippets=maybe", "size=abc"} {
+		got := decodePreferences(v)
+		if got.PageSize != 30 || got.UILanguage != "en" || got.ShowSnippets {
+			t.Errorf("%q: expected the defaults, got %+v", v, got)
+		}
+	}
+}
+
+func TestGetPreferencesAnonymousReadsCookie(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/preferences", nil)
+	req.AddCookie(&http.Cookie{Name: preferencesCookie, Value: Preferences{PageSize: 10, UILanguage: "da"}.encode()})
+	rec := httptest.NewRecorder()
+	NewRouter(testServer()).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var got Preferences
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if got.PageSize != 10 || got.UILanguage != "da" {
+		t.Errorf("expected the cookie's preferences, got %+v", got)
+	}
+}
+
+func TestUpdatePreferencesAnonymousSetsCookie(t *testing.T) {
+	r := NewRouter(testServer())
+	req := httptest.NewRequest(http.MethodPost, "/api/preferences", strings.NewReader(`{"page_size":"20","show_snippets":"true"}`))
+	req.Header.Set("Content-Type", "application/json")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == preferencesCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("expected a preferences cookie")
+	}
+	got := decodePreferences(cookie.Value)
+	want := Preferences{PageSize: 20, ShowSnippets: true, UILanguage: "en"}
+	if got != want {
+		t.Errorf("expected %+v in the cookie, got %+v", want, got)
+	}
+}
+
+func TestPreferencesCookieFollowsSecureCookies(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		s := testServer()
+		s.SecureCookies = secure
+		r := NewRouter(s)
+		req := httptest.NewRequest(http.MethodPost, "/api/preferences", strings.NewReader(`{"page_size":"20"}`))
+		req.Header.Set("Content-Type", "application/json")
+		withCSRF(t, r, req)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		var cookie *http.Cookie
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == preferencesCookie {
+				cookie = c
+			}
+		}
+		if cookie == nil || cookie.Secure != secure {
+			t.Errorf("SecureCookies %v: expected a preferences cookie with Secure %v, got %+v", secure, secure, cookie)
+		}
+	}
+}
+
+func TestUpdatePreferencesRejectsBadValues(t *testing.T) {
+	r := NewRouter(testServer())
+	for _, body := range []string{`{"page_size":"0"}`, `{"page_size":"101"}`, `{"show_snippets":"sometimes"}`, `{"ui_language":"fr"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/api/preferences", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		withCSRF(t, r, req)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+		}
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == preferencesCookie {
+				t.Errorf("%s: expected no preferences cookie", body)
+			}
+		}
+	}
+}
+
+func TestSnippetCentersOnMatch(t *testing.T) {
+	content := strings.Repeat("lorem ipsum ", 50) + "golang rocks " + strings.Repeat("dolor sit ", 50)
+	got := snippet(content, "GoLang", 80)
+	if !strings.Contains(got, "golang rocks") {
+		t.Errorf("expected the snippet to include the match, got %q", got)
+	}
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("expected ellipses on both ends, got %q", got)
+	}
+	if short := snippet("  short\ntext ", "x", 80); short != "short text" {
+		t.Errorf("expected short content as is, got %q", short)
+	}
+}
+
+func TestPreferencesPageUsesUILanguage(t *testing.T) {
+	s := newTestDBServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/preferences", nil)
+	req.AddCookie(&http.Cookie{Name: preferencesCookie, Value: Preferences{PageSize: 10, UILanguage: "da"}.encode()})
+	rec := httptest.NewRecorder()
+	s.ServePreferencesPage(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `<html lang="da">`) || !strings.Contains(body, ">Sprog</label>") {
+		t.Errorf("expected the page in Danish, got %s", body)
+	}
+}
+
+func TestUpdatePreferencesRejectsAPITokens(t *testing.T) {
+	s := newTestDBServer(t)
+	user := mustCreateUser(t, s, "alice", "correct horse")
+	token := apiTokenPrefix + "preferences-test"
+	if _, err := db.CreateAPIToken(context.Background(), s.DB, user.ID, "ci", auth.HashToken(token), []string{ScopeSearchRead}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/preferences", strings.NewReader(`{"page_size":"10"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	NewRouter(s).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "Not available to API tokens") {
+		t.Fatalf("expected 403 for an API token, got %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := db.GetPreferences(context.Background(), s.DB, user.ID); !errors.Is(err, db.ErrPreferencesNotFound) {
+		t.Errorf("expected no preferences to be saved, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+// HasRole reports whether u has role or a more privileged one.
+func (u *User) HasRole(role string) bool {
+	return u != nil && db.RoleRank(role) >= 0 && db.RoleRank(u.Role) >= db.RoleRank(role)
+}
+
+// RequireRole returns chi middleware that lets through only users with role
+// or a more privileged one. Anonymous requests get a 401, everyone else
+// lacking the role a 403. Users whose role requires two-factor login are
+// also turned away until they have set it up.
+func (s *Server) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u := currentUser(r)
+			if u == nil {
+				writeError(w, http.StatusUnauthorized, "Login required")
+				return
+			}
+			if !u.HasRole(role) {
+				writeForbidden(w, r, "This requires the "+role+" role")
+				return
+			}
+			if s.twoFactorRequired(u) && !u.TwoFactor {
+				writeForbidden(w, r, "Set up two-factor authentication at /settings/2fa first")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *Server) ServeAdminPage(w http.ResponseWriter, r *http.Request) {
+	renderTemplate(w, "admin.html", ViewData{
+		User:      currentUser(r),
+		Flashes:   s.getFlashes(w, r),
+		CSRFToken: s.csrfToken(w, r),
+	})
+}
+
+// adminTargetUser resolves the `username` form field of an admin action,
+// flashing and redirecting back to /admin when it can't.
+func (s *Server) adminTargetUser(w http.ResponseWriter, r *http.Request) *db.UserRow {
+	u, err := db.GetUserByUsername(r.Context(), s.DB, strings.TrimSpace(r.FormValue("username")))
+	if errors.Is(err, db.ErrUserNotFound) {
+		s.flashAndRedirect(w, r, "No such user", "/admin")
+		return nil
+	}
+	if err != nil {
+		log.Printf("admin user lookup failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/admin")
+		return nil
+	}
+	return u
+}
+
+// SetUserRole godoc
+// @Summary Set User Role
+// @Description Changes a user's role and redirects to /admin with a flash message. Admins can't change their own role.
+// @Tags admin
+// @Accept x-www-form-urlencoded
+// @Param username formData string true "Username"
+// @Param role formData string true "user, editor or admin"
+// @Success 303 {string} string "Redirect to /admin"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not an admin"
+// @Router /api/admin/users/role [post]
+//
+// SetUserRole gives the user in the `username` form field the `role` form
+// field's role. Admins can't change their own role, so the last admin can't
+// lock everyone out by accident.
+func (s *Server) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "username", "role") {
+		return
+	}
+	target := s.adminTargetUser(w, r)
+	if target == nil {
+		return
+	}
+	if target.ID == currentUser(r).ID {
+		s.flashAndRedirect(w, r, "You can't change your own role", "/admin")
+		return
+	}
+
+	role := r.FormValue("role")
+	err := db.SetUserRole(r.Context(), s.DB, target.ID, role)
+	if errors.Is(err, db.ErrInvalidRole) {
+		s.flashAndRedirect(w, r, "Unknown role: "+role, "/admin")
+		return
+	}
+	if err != nil {
+		log.Printf("set user role failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/admin")
+		return
+	}
+	s.audit(r, db.EventRoleChange, target.ID, target.Username, target.Role+" -> "+role+" by admin "+currentUser(r).Username)
+	s.flashAndRedirect(w, r, target.Username+" is now "+role, "/admin")
+}
+
+// AdminRevokeSessions godoc
+// @Summary Revoke User Sessions
+// @Description Logs a user out on every device and redirects to /admin with a flash message.
+// @Tags admin
+// @Accept x-www-form-urlencoded
+// @Param username formData string true "Username"
+// @Success 303 {string} string "Redirect to /admin"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not an admin"
+// @Router /api/admin/users/revoke-sessions [post]
+//
+// AdminRevokeSessions logs the user in the `username` form field out on
+// every device.
+func (s *Server) AdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "username") {
+		return
+	}
+	target := s.adminTargetUser(w, r)
+	if target == nil {
+		return
+	}
+
+	n, err := db.DeleteUserSessions(r.Context(), s.DB, target.ID)
+	if err != nil {
+		log.Printf("admin revoke sessions failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/admin")
+		return
+	}
+	s.audit(r, db.EventSessionsRevoke, target.ID, target.Username, "by admin "+currentUser(r).Username)
+	if target.ID == currentUser(r).ID {
+		s.endCurrentSession(r)
+		s.flashAndRedirect(w, r, "You were logged out on all devices", "/login")
+		return
+	}
+	s.flashAndRedirect(w, r, "Revoked "+pluralize(n, "session")+" for "+target.Username, "/admin")
+}
+
+// AdminUnlockLogin godoc
+// @Summary Unlock Login
+// @Description Lifts a login lockout for an account or an IP address and redirects to /admin with a flash message. The IP address wins when both are given.
+// @Tags admin
+// @Accept x-www-form-urlencoded
+// @Param username formData string false "Username"
+// @Param ip formData string false "IP address"
+// @Success 303 {string} string "Redirect to /admin"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not an admin"
+// @Router /api/admin/login-unlock [post]
+//
+// AdminUnlockLogin lifts a login lockout for the `username` or `ip` form
+// field.
+func (s *Server) AdminUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	scope, key := db.ThrottleScopeAccount, throttleAccountKey(r.FormValue("username"))
+	if ip := strings.TrimSpace(r.FormValue("ip")); ip != "" {
+		scope, key = db.ThrottleScopeIP, ip
+	}
+	if key == "" {
+		s.flashAndRedirect(w, r, "Enter a username or an IP address", "/admin")
+		return
+	}
+
+	cleared, err := db.ClearLoginFailures(r.Context(), s.DB, scope, key)
+	if err != nil {
+		log.Printf("admin unlock login failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/admin")
+		return
+	}
+	if !cleared {
+		s.flashAndRedirect(w, r, "No failed logins recorded for "+key, "/admin")
+		return
+	}
+	if scope == db.ThrottleScopeIP {
+		s.audit(r, db.EventLoginUnlock, 0, "", "ip "+key+" by admin "+currentUser(r).Username)
+	} else {
+		s.audit(r, db.EventLoginUnlock, 0, key, "by admin "+currentUser(r).Username)
+	}
+	s.flashAndRedirect(w, r, "Unlocked "+key, "/admin")
+}
+
+func pluralize(n int64, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return strconv.FormatInt(n, 10) + " " + noun + "s"
+}
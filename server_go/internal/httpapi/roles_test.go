@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+func TestUserHasRole(t *testing.T) {
+	cases := []struct {
+		role, want string
+		ok         bool
+	}{
+		{db.RoleUser, db.RoleUser, true},
+		{db.RoleUser, db.RoleEditor, false},
+		{db.RoleEditor, db.RoleEditor, true},
+		{db.RoleAdmin, db.RoleEditor, true},
+		{db.RoleAdmin, "root", false},
+	}
+	for _, c := range cases {
+		u := &User{Role: c.role}
+		if got := u.HasRole(c.want); got != c.ok {
+			t.Errorf("%s.HasRole(%q) = %v, want %v", c.role, c.want, got, c.ok)
+		}
+	}
+
+	var anonymous *User
+	if anonymous.HasRole(db.RoleUser) {
+		t.Error("expected a nil user to have no role")
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	cases := []struct {
+		name string
+		user *User
+		want int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"user", &User{ID: 1, Role: db.RoleUser}, http.StatusForbidden},
+		{"editor", &User{ID: 1, Role: db.RoleEditor}, http.StatusNoContent},
+		{"admin", &User{ID: 1, Role: db.RoleAdmin}, http.StatusNoContent},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/tags", nil)
+		req.Header.Set("Accept", "application/json")
+		if c.user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, c.user))
+		}
+		rec := httptest.NewRecorder()
+
+		(&Server{}).RequireRole(db.RoleEditor)(ok).ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.want, rec.Code)
+		}
+	}
+}
+
+func TestAdminPageWithoutLoginReturns401(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewRouter(testServer()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+}
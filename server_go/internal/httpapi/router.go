@@ -11,21 +11,56 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
 
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/mail"
 	"whoknows_variations/server_go/internal/metrics"
+	"whoknows_variations/server_go/internal/oidc"
+	"whoknows_variations/server_go/internal/searchlog"
 )
 
 const SessionName = "session"
 
 type Server struct {
 	DB       *pgxpool.Pool
-	Sessions *sessions.CookieStore
+	Sessions sessions.Store
+	Mailer   mail.Mailer
+	// SearchLog records searches for the analytics; nil turns it off.
+	SearchLog *searchlog.Logger
+	// BaseURL is the public origin used in links sent by email, e.g.
+	// "https://huw.dk". It must not come from the request's Host header.
+	BaseURL string
+	// SecureCookies marks the cookies the server sets as HTTPS-only.
+	SecureCookies bool
+	// SigningKeys authenticate emailed links. The first key signs; all of
+	// them are accepted when verifying.
+	SigningKeys       [][]byte
+	EmailVerification EmailVerificationPolicy
+	// OIDC enables single sign-on through an OpenID provider when set.
+	OIDC *oidc.Provider
+	// OIDCName is the provider name shown on the login button.
+	OIDCName string
+	// OIDCAutoProvision creates accounts for provider users whose email
+	// address is unknown here instead of turning them away.
+	OIDCAutoProvision bool
+	// TwoFactorRequiredRole makes two-factor login mandatory for this role
+	// and every more privileged one. Empty leaves it optional for everyone.
+	TwoFactorRequiredRole string
+	// TrustProxy makes clientIP use the X-Real-IP header set by nginx.
+	TrustProxy bool
+	// AllowGetLogout keeps the old GET /api/logout link working. Logging
+	// out via GET can't be protected against CSRF, so it is off by default.
+	AllowGetLogout bool
+
+	invalidTokenAudits auditLimiter
 }
 
 func NewRouter(s *Server) http.Handler {
 	r := chi.NewRouter()
 
-	r.Use(s.UserFromSession)
+	r.Use(middleware.RequestID)
+	r.Use(s.Authenticate)
 	r.Use(observeHTTPMetrics)
+	r.Use(s.CSRF)
 
 	r.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 	r.Handle("/metrics", promhttp.Handler())
@@ -33,14 +68,109 @@ func NewRouter(s *Server) http.Handler {
 	// HTML routes
 	r.Get("/", s.ServeRootPage)
 	r.Get("/about", s.ServeAboutPage)
+	r.Get("/preferences", s.ServePreferencesPage)
 	r.Get("/register", s.ServeRegisterPage)
 	r.Get("/login", s.ServeLoginPage)
+	r.Get("/login/2fa", s.ServeTwoFactorLoginPage)
+	r.Get("/login/oidc", s.StartOIDCLogin)
+	r.Get("/login/oidc/callback", s.OIDCCallback)
+	r.Get("/sessions", s.ServeSessionsPage)
+	r.Get("/settings", s.ServeSettingsPage)
+	r.Get("/settings/tokens", s.ServeAPITokensPage)
+	r.Get("/settings/2fa", s.ServeTwoFactorPage)
+	r.Get("/history", s.ServeHistoryPage)
+	r.Get("/bookmarks", s.ServeBookmarksPage)
+	r.Get("/saved-searches", s.ServeSavedSearchesPage)
+	r.Get("/notifications", s.ServeNotificationsPage)
+	r.Get("/forgot-password", s.ServeForgotPasswordPage)
+	r.Get("/reset-password", s.ServeResetPasswordPage)
+	r.Get("/verify-email", s.VerifyEmail)
+	r.Get("/verify-email/resend", s.ServeResendVerificationPage)
 
 	// API routes
-	r.Get("/api/search", s.Search)
+	r.With(RequireScope(ScopeSearchRead)).Get("/api/search", s.Search)
+	r.Get("/api/languages", s.Languages)
+	r.Get("/api/preferences", s.GetPreferences)
+	r.With(RequireSession).Post("/api/preferences", s.UpdatePreferences)
 	r.Post("/api/register", s.Register)
 	r.Post("/api/login", s.Login)
-	r.Get("/api/logout", s.Logout)
+	r.Post("/api/login/2fa", s.VerifyTwoFactorLogin)
+	r.Post("/api/logout", s.Logout)
+	if s.AllowGetLogout {
+		r.Get("/api/logout", s.Logout)
+	}
+	r.Get("/api/csrf-token", s.CSRFToken)
+	r.Post("/api/forgot-password", s.ForgotPassword)
+	r.Post("/api/reset-password", s.ResetPassword)
+	r.Post("/api/verify-email/resend", s.ResendVerification)
+	r.Get("/api/tags", s.ListTags)
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireLogin)
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequireSession)
+
+			r.Post("/api/me/password", s.ChangePassword)
+			r.Post("/api/me/email", s.ChangeEmail)
+			r.Post("/api/me/delete", s.DeleteAccount)
+			r.Get("/api/me/export", s.ExportMyData)
+
+			r.Get("/api/me/history", s.ListSearchHistory)
+			r.Post("/api/me/history/clear", s.ClearSearchHistory)
+			r.Post("/api/me/history/settings", s.SetSearchHistory)
+			r.Post("/api/me/history/{id}/delete", s.DeleteSearchHistoryEntry)
+
+			r.Get("/api/me/bookmarks", s.ListBookmarks)
+			r.Post("/api/me/bookmarks", s.AddBookmark)
+			r.Post("/api/me/bookmarks/remove", s.RemoveBookmark)
+
+			r.Get("/api/me/saved-searches", s.ListSavedSearches)
+			r.Post("/api/me/saved-searches", s.CreateSavedSearch)
+			r.Post("/api/me/saved-searches/{id}/delete", s.DeleteSavedSearch)
+			r.Get("/api/me/notifications", s.ListNotifications)
+			r.Post("/api/me/notifications/read", s.MarkNotificationsRead)
+
+			r.Get("/api/me/sessions", s.ListSessions)
+			r.Post("/api/me/sessions/revoke-all", s.RevokeAllSessions)
+			r.Post("/api/me/sessions/{id}/revoke", s.RevokeSession)
+
+			r.Get("/api/me/tokens", s.ListAPITokens)
+			r.Post("/api/me/tokens", s.CreateAPIToken)
+			r.Post("/api/me/tokens/{id}/revoke", s.RevokeAPIToken)
+
+			r.Post("/api/me/2fa/enable", s.EnableTwoFactor)
+			r.Post("/api/me/2fa/disable", s.DisableTwoFactor)
+			r.Post("/api/me/2fa/recovery-codes", s.RegenerateRecoveryCodes)
+		})
+
+		// Page editing is for editors and admins.
+		r.Group(func(r chi.Router) {
+			r.Use(s.RequireRole(db.RoleEditor))
+			r.Use(s.RequireVerifiedEmail)
+			r.Use(RequireScope(ScopePagesWrite))
+
+			r.Post("/api/tags", s.CreateTag)
+			r.Delete("/api/tags/{slug}", s.DeleteTag)
+			r.Post("/api/tags/{slug}/pages", s.TagPage)
+			r.Delete("/api/tags/{slug}/pages", s.UntagPage)
+		})
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.RequireRole(db.RoleAdmin))
+		r.Use(RequireSession)
+
+		r.Get("/admin", s.ServeAdminPage)
+		r.Get("/admin/analytics", s.ServeAnalyticsPage)
+		r.Post("/api/admin/users/role", s.SetUserRole)
+		r.Post("/api/admin/users/revoke-sessions", s.AdminRevokeSessions)
+		r.Post("/api/admin/login-unlock", s.AdminUnlockLogin)
+		r.Post("/api/admin/users/reset-2fa", s.AdminResetTwoFactor)
+		r.Post("/api/admin/users/export", s.AdminExportUser)
+		r.Get("/api/admin/auth-events", s.ListAuthEvents)
+		r.Get("/api/admin/analytics", s.GetSearchAnalytics)
+	})
 
 	// Swagger UI
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
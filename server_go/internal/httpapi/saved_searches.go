@@ -0,0 +1,257 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+const (
+	maxSavedSearches       = 20
+	maxSavedSearchQueryLen = 200
+	notificationListLimit  = 50
+)
+
+type SavedSearch struct {
+	ID            int64      `json:"id"`
+	Query         string     `json:"query"`
+	Language      string     `json:"language"`
+	Notify        string     `json:"notify"`
+	WebhookURL    string     `json:"webhook_url,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+}
+
+type SavedSearchesResponse struct {
+	Data []SavedSearch `json:"data"`
+}
+
+type Notification struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	Read      bool      `json:"read"`
+}
+
+type NotificationsResponse struct {
+	Unread int64          `json:"unread"`
+	Data   []Notification `json:"data"`
+}
+
+func (s *Server) savedSearches(r *http.Request) ([]SavedSearch, error) {
+	rows, err := db.ListSavedSearches(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SavedSearch, len(rows))
+	for i, row := range rows {
+		out[i] = SavedSearch{
+			ID:            row.ID,
+			Query:         row.Query,
+			Language:      row.Language,
+			Notify:        row.Notify,
+			WebhookURL:    row.WebhookURL,
+			CreatedAt:     row.CreatedAt,
+			LastCheckedAt: row.LastCheckedAt,
+		}
+	}
+	return out, nil
+}
+
+func (s *Server) notifications(r *http.Request) ([]Notification, int64, error) {
+	rows, err := db.ListNotifications(r.Context(), s.DB, currentUser(r).ID, notificationListLimit)
+	if err != nil {
+		return nil, 0, err
+	}
+	unread, err := db.CountUnreadNotifications(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := make([]Notification, len(rows))
+	for i, n := range rows {
+		out[i] = Notification{ID: n.ID, Title: n.Title, Body: n.Body, URL: n.URL, CreatedAt: n.CreatedAt, Read: n.ReadAt != nil}
+	}
+	return out, unread, nil
+}
+
+func (s *Server) ServeSavedSearchesPage(w http.ResponseWriter, r *http.Request) {
+	if u := currentUser(r); u == nil || u.TokenID != 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	saved, err := s.savedSearches(r)
+	if err != nil {
+		log.Printf("list saved searches failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "saved_searches.html", ViewData{
+		User:          currentUser(r),
+		Flashes:       s.getFlashes(w, r),
+		SavedSearches: saved,
+		CSRFToken:     s.csrfToken(w, r),
+	})
+}
+
+func (s *Server) ServeNotificationsPage(w http.ResponseWriter, r *http.Request) {
+	if u := currentUser(r); u == nil || u.TokenID != 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	notifications, _, err := s.notifications(r)
+	if err != nil {
+		log.Printf("list notifications failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "notifications.html", ViewData{
+		User:          currentUser(r),
+		Flashes:       s.getFlashes(w, r),
+		Notifications: notifications,
+		CSRFToken:     s.csrfToken(w, r),
+	})
+}
+
+// ListSavedSearches returns the logged-in user's saved searches.
+func (s *Server) ListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	saved, err := s.savedSearches(r)
+	if err != nil {
+		log.Printf("list saved searches failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, SavedSearchesResponse{Data: saved})
+}
+
+// validWebhookURL accepts absolute http and https URLs. Which addresses the
+// webhook may reach is checked when it's called.
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.User == nil
+}
+
+// CreateSavedSearch saves the `query` and optional `language` form fields.
+// `notify` is email (the default), webhook, which needs `webhook_url`, or
+// none for in-app notifications only.
+func (s *Server) CreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "query") {
+		return
+	}
+	to := returnPath(r, "/saved-searches")
+
+	row := db.SavedSearchRow{
+		UserID:     currentUser(r).ID,
+		Query:      strings.TrimSpace(r.FormValue("query")),
+		Language:   strings.TrimSpace(r.FormValue("language")),
+		Notify:     strings.TrimSpace(r.FormValue("notify")),
+		WebhookURL: strings.TrimSpace(r.FormValue("webhook_url")),
+	}
+	if row.Notify == "" {
+		row.Notify = db.NotifyEmail
+	}
+	switch {
+	case row.Query == "":
+		s.flashAndRedirect(w, r, "You have to enter a search query", to)
+		return
+	case len(row.Query) > maxSavedSearchQueryLen:
+		s.flashAndRedirect(w, r, "The search query is too long", to)
+		return
+	case row.Notify != db.NotifyEmail && row.Notify != db.NotifyWebhook && row.Notify != db.NotifyNone:
+		s.flashAndRedirect(w, r, "notify must be email, webhook or none", to)
+		return
+	case row.Notify == db.NotifyWebhook && !validWebhookURL(row.WebhookURL):
+		s.flashAndRedirect(w, r, "You have to enter a valid http or https webhook URL", to)
+		return
+	}
+	if row.Notify != db.NotifyWebhook {
+		row.WebhookURL = ""
+	}
+
+	if row.Language != "" {
+		_, err := db.GetEnabledLanguage(r.Context(), s.DB, row.Language)
+		if errors.Is(err, db.ErrLanguageNotFound) {
+			s.flashAndRedirect(w, r, "Unknown language: "+row.Language, to)
+			return
+		}
+		if err != nil {
+			log.Printf("saved search language lookup failed: %v", err)
+			s.flashAndRedirect(w, r, "Internal error, please try again", to)
+			return
+		}
+	}
+
+	n, err := db.CountSavedSearches(r.Context(), s.DB, row.UserID)
+	if err != nil {
+		log.Printf("count saved searches failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", to)
+		return
+	}
+	if n >= maxSavedSearches {
+		s.flashAndRedirect(w, r, "You can have at most "+strconv.Itoa(maxSavedSearches)+" saved searches. Delete one first", to)
+		return
+	}
+
+	_, err = db.CreateSavedSearch(r.Context(), s.DB, row)
+	if errors.Is(err, db.ErrSavedSearchExists) {
+		s.flashAndRedirect(w, r, "You already saved this search", to)
+		return
+	}
+	if err != nil {
+		log.Printf("create saved search failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", to)
+		return
+	}
+	s.flashAndRedirect(w, r, "Search saved. You'll be notified about new results", to)
+}
+
+func (s *Server) DeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err == nil {
+		err = db.DeleteSavedSearch(r.Context(), s.DB, currentUser(r).ID, id)
+	} else {
+		err = db.ErrSavedSearchNotFound
+	}
+	if errors.Is(err, db.ErrSavedSearchNotFound) {
+		s.flashAndRedirect(w, r, "That saved search no longer exists", "/saved-searches")
+		return
+	}
+	if err != nil {
+		log.Printf("delete saved search failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/saved-searches")
+		return
+	}
+	s.flashAndRedirect(w, r, "The saved search was deleted", "/saved-searches")
+}
+
+// ListNotifications returns the logged-in user's latest notifications and
+// how many are unread.
+func (s *Server) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	notifications, unread, err := s.notifications(r)
+	if err != nil {
+		log.Printf("list notifications failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, NotificationsResponse{Unread: unread, Data: notifications})
+}
+
+func (s *Server) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if _, err := db.MarkNotificationsRead(r.Context(), s.DB, currentUser(r).ID); err != nil {
+		log.Printf("mark notifications read failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/notifications")
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+func TestCreateSavedSearchWebhookThroughRouter(t *testing.T) {
+	s := newTestDBServer(t)
+	r := NewRouter(s)
+	alice := mustCreateUser(t, s, "alice", "secret")
+	cookie, csrf := loginCookie(t, s, alice)
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/me/saved-searches", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(csrfHeader, csrf)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	saved := func() []db.SavedSearchRow {
+		rows, err := db.ListSavedSearches(context.Background(), s.DB, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	for _, hook := range []string{"", "ftp://example.com/hook", "https://user:pw@example.com/hook", "/relative"} {
+		rec := post(url.Values{"query": {"go"}, "notify": {"webhook"}, "webhook_url": {hook}})
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("%q: expected a redirect, got %d", hook, rec.Code)
+		}
+		if got := flashes(t, s, rec); len(got) != 1 || got[0] != "You have to enter a valid http or https webhook URL" {
+			t.Errorf("%q: unexpected flashes %q", hook, got)
+		}
+	}
+	if rows := saved(); len(rows) != 0 {
+		t.Fatalf("expected invalid webhooks to save nothing, got %+v", rows)
+	}
+
+	rec := post(url.Values{"query": {"go"}, "notify": {"webhook"}, "webhook_url": {"https://example.com/hook"}})
+	if got := flashes(t, s, rec); len(got) != 1 || !strings.HasPrefix(got[0], "Search saved") {
+		t.Fatalf("unexpected flashes %q", got)
+	}
+	// Email alerts don't keep a webhook URL that was sent along.
+	post(url.Values{"query": {"rust"}, "notify": {"email"}, "webhook_url": {"https://example.com/hook"}})
+
+	rows := saved()
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 saved searches, got %+v", rows)
+	}
+	for _, row := range rows {
+		want := map[string]string{"go": "https://example.com/hook", "rust": ""}[row.Query]
+		if row.WebhookURL != want {
+			t.Errorf("%s: expected webhook URL %q, got %q", row.Query, want, row.WebhookURL)
+		}
+	}
+}
+
+// The checks below fail before the database is used.
+func TestCreateSavedSearchValidatesInput(t *testing.T) {
+	s := testServer()
+	user := &User{ID: 1, Username: "alice"}
+
+	cases := []struct {
+		name string
+		form url.Values
+	}{
+		{"empty query", url.Values{"query": {"  "}}},
+		{"long query", url.Values{"query": {strings.Repeat("x", maxSavedSearchQueryLen+1)}}},
+		{"unknown notify", url.Values{"query": {"go"}, "notify": {"sms"}}},
+		{"webhook without url", url.Values{"query": {"go"}, "notify": {"webhook"}}},
+		{"webhook with other scheme", url.Values{"query": {"go"}, "notify": {"webhook"}, "webhook_url": {"file:///etc/passwd"}}},
+		{"webhook with credentials", url.Values{"query": {"go"}, "notify": {"webhook"}, "webhook_url": {"https://user:pw@example.com/"}}},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+		rec := httptest.NewRecorder()
+
+		s.CreateSavedSearch(rec, req)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/saved-searches" {
+			t.Errorf("%s: expected a redirect to /saved-searches, got %d %q", c.name, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
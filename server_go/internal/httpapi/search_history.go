@@ -0,0 +1,204 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+const (
+	defaultSearchHistoryLimit = 50
+	maxSearchHistoryLimit     = 500
+	recentQueryLimit          = 10
+)
+
+type SearchHistoryEntry struct {
+	ID          int64     `json:"id"`
+	Query       string    `json:"query"`
+	Language    string    `json:"language"`
+	ResultCount int       `json:"result_count"`
+	SearchedAt  time.Time `json:"searched_at"`
+}
+
+type SearchHistoryResponse struct {
+	Enabled bool                 `json:"enabled"`
+	Data    []SearchHistoryEntry `json:"data"`
+}
+
+// HistoryView is what history.html shows.
+type HistoryView struct {
+	Enabled bool
+	Entries []SearchHistoryEntry
+	// Older is the `before` value for the next page, or 0 on the last one.
+	Older int64
+}
+
+// recordSearchHistory adds a search to the logged-in user's history unless
+// they opted out. Anonymous searches aren't recorded.
+func (s *Server) recordSearchHistory(r *http.Request, q string, params db.SearchParams, resultCount int) {
+	u := currentUser(r)
+	if u == nil || !u.SearchHistory {
+		return
+	}
+	var language string
+	if params.Language != nil {
+		language = *params.Language
+	}
+	if _, err := db.RecordSearch(r.Context(), s.DB, u.ID, q, language, resultCount); err != nil {
+		log.Printf("record search history failed: %v", err)
+	}
+}
+
+// recentQueries returns the queries to suggest in the search box.
+func (s *Server) recentQueries(r *http.Request) []string {
+	u := currentUser(r)
+	if u == nil || u.TokenID != 0 || !u.SearchHistory {
+		return nil
+	}
+	queries, err := db.RecentQueries(r.Context(), s.DB, u.ID, recentQueryLimit)
+	if err != nil {
+		log.Printf("recent queries lookup failed: %v", err)
+		return nil
+	}
+	return queries
+}
+
+// searchHistory reads the before and limit query parameters and returns
+// that page of the user's history. A non-empty message is a bad parameter.
+func (s *Server) searchHistory(r *http.Request) ([]SearchHistoryEntry, string, error) {
+	var before int64
+	limit := defaultSearchHistoryLimit
+	if v := r.URL.Query().Get("before"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, "before must be a history entry id", nil
+		}
+		before = id
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, "limit must be a positive number", nil
+		}
+		limit = min(n, maxSearchHistoryLimit)
+	}
+
+	rows, err := db.ListSearchHistory(r.Context(), s.DB, currentUser(r).ID, before, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	out := make([]SearchHistoryEntry, len(rows))
+	for i, h := range rows {
+		out[i] = SearchHistoryEntry{
+			ID:          h.ID,
+			Query:       h.Query,
+			Language:    h.Language,
+			ResultCount: h.ResultCount,
+			SearchedAt:  h.SearchedAt,
+		}
+	}
+	return out, "", nil
+}
+
+func (s *Server) ServeHistoryPage(w http.ResponseWriter, r *http.Request) {
+	if u := currentUser(r); u == nil || u.TokenID != 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	entries, invalid, err := s.searchHistory(r)
+	if err != nil {
+		log.Printf("list search history failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if invalid != "" {
+		http.Redirect(w, r, "/history", http.StatusSeeOther)
+		return
+	}
+
+	view := &HistoryView{Enabled: currentUser(r).SearchHistory, Entries: entries}
+	if len(entries) == defaultSearchHistoryLimit {
+		view.Older = entries[len(entries)-1].ID
+	}
+	renderTemplate(w, "history.html", ViewData{
+		User:      currentUser(r),
+		Flashes:   s.getFlashes(w, r),
+		History:   view,
+		CSRFToken: s.csrfToken(w, r),
+	})
+}
+
+// ListSearchHistory returns the logged-in user's searches, newest first.
+// before (an entry id) and limit page through older ones.
+func (s *Server) ListSearchHistory(w http.ResponseWriter, r *http.Request) {
+	entries, invalid, err := s.searchHistory(r)
+	if err != nil {
+		log.Printf("list search history failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if invalid != "" {
+		writeError(w, http.StatusBadRequest, invalid)
+		return
+	}
+	writeJSON(w, http.StatusOK, SearchHistoryResponse{Enabled: currentUser(r).SearchHistory, Data: entries})
+}
+
+func (s *Server) DeleteSearchHistoryEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err == nil {
+		err = db.DeleteSearchHistoryEntry(r.Context(), s.DB, currentUser(r).ID, id)
+	} else {
+		err = db.ErrSearchHistoryNotFound
+	}
+	if errors.Is(err, db.ErrSearchHistoryNotFound) {
+		s.flashAndRedirect(w, r, "That search is no longer in your history", "/history")
+		return
+	}
+	if err != nil {
+		log.Printf("delete search history entry failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/history")
+		return
+	}
+	s.flashAndRedirect(w, r, "The search was removed from your history", "/history")
+}
+
+func (s *Server) ClearSearchHistory(w http.ResponseWriter, r *http.Request) {
+	if _, err := db.ClearSearchHistory(r.Context(), s.DB, currentUser(r).ID); err != nil {
+		log.Printf("clear search history failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/history")
+		return
+	}
+	s.flashAndRedirect(w, r, "Your search history was cleared", "/history")
+}
+
+// SetSearchHistory turns search history on or off with the `enabled` form
+// field. Turning it off keeps past searches until they are cleared.
+func (s *Server) SetSearchHistory(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "enabled") {
+		return
+	}
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		s.flashAndRedirect(w, r, "enabled must be true or false", "/history")
+		return
+	}
+
+	if err := db.SetSearchHistoryEnabled(r.Context(), s.DB, currentUser(r).ID, enabled); err != nil {
+		log.Printf("set search history failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/history")
+		return
+	}
+	if enabled {
+		s.flashAndRedirect(w, r, "Your searches will be saved in your history", "/history")
+		return
+	}
+	s.flashAndRedirect(w, r, "Your searches will no longer be saved. Clear your history to remove past searches", "/history")
+}
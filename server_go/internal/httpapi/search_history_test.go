@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+func TestDeleteSearchHistoryEntryOnlyOwnEntries(t *testing.T) {
+	s := newTestDBServer(t)
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice", "secret")
+	bob := mustCreateUser(t, s, "bob", "secret")
+	for _, u := range []*User{alice, alice, bob} {
+		if _, err := db.RecordSearch(ctx, s.DB, u.ID, "go", "", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Entries 1 and 2 are alice's, 3 is bob's.
+
+	deleteEntry := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/me/history/"+id+"/delete", nil)
+		rec := httptest.NewRecorder()
+		s.DeleteSearchHistoryEntry(rec, withURLParam(withUser(req, alice), "id", id))
+		return rec
+	}
+
+	if got := flashes(t, s, deleteEntry("1")); len(got) != 1 || got[0] != "The search was removed from your history" {
+		t.Errorf("own entry: unexpected flashes %q", got)
+	}
+	for _, id := range []string{"3", "1", "abc"} {
+		if got := flashes(t, s, deleteEntry(id)); len(got) != 1 || got[0] != "That search is no longer in your history" {
+			t.Errorf("entry %s: unexpected flashes %q", id, got)
+		}
+	}
+
+	left, err := db.ListSearchHistory(ctx, s.DB, alice.ID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].ID != 2 {
+		t.Errorf("expected only alice's entry 2 to be left, got %+v", left)
+	}
+	if left, _ := db.ListSearchHistory(ctx, s.DB, bob.ID, 0, 10); len(left) != 1 {
+		t.Errorf("expected bob's entry to be kept, got %+v", left)
+	}
+}
+
+func TestClearSearchHistoryOnlyOwnEntries(t *testing.T) {
+	s := newTestDBServer(t)
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice", "secret")
+	bob := mustCreateUser(t, s, "bob", "secret")
+	for _, u := range []*User{alice, alice, bob} {
+		if _, err := db.RecordSearch(ctx, s.DB, u.ID, "go", "", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := postForm(s.ClearSearchHistory, alice, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/history" {
+		t.Fatalf("expected a redirect to /history, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := flashes(t, s, rec); len(got) != 1 || got[0] != "Your search history was cleared" {
+		t.Errorf("unexpected flashes %q", got)
+	}
+	if left, _ := db.ListSearchHistory(ctx, s.DB, alice.ID, 0, 10); len(left) != 0 {
+		t.Errorf("expected alice's history to be empty, got %+v", left)
+	}
+	if left, _ := db.ListSearchHistory(ctx, s.DB, bob.ID, 0, 10); len(left) != 1 {
+		t.Errorf("expected bob's history to be kept, got %+v", left)
+	}
+}
+
+func TestListSearchHistoryRejectsBadParams(t *testing.T) {
+	s := testServer()
+	user := &User{ID: 1, Username: "alice", SearchHistory: true}
+
+	for _, query := range []string{"before=abc", "before=0", "limit=-1"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/me/history?"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+		rec := httptest.NewRecorder()
+
+		s.ListSearchHistory(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestSetSearchHistoryRejectsBadValue(t *testing.T) {
+	s := testServer()
+	user := &User{ID: 1, Username: "alice", SearchHistory: true}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"enabled": {"maybe"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+	rec := httptest.NewRecorder()
+
+	s.SetSearchHistory(rec, req)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/history" {
+		t.Fatalf("expected a redirect to /history, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+// Opted-out and anonymous searches must not reach the database, which the
+// test server doesn't have.
+func TestRecordSearchHistorySkipsOptedOutAndAnonymous(t *testing.T) {
+	s := testServer()
+
+	for _, user := range []*User{nil, {ID: 1, Username: "alice", SearchHistory: false}} {
+		req := httptest.NewRequest(http.MethodGet, "/?q=go", nil)
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+		}
+		s.recordSearchHistory(req, "go", db.SearchParams{Query: "go"}, 0)
+		if got := s.recentQueries(req); got != nil {
+			t.Errorf("expected no recent queries, got %v", got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/sessionstore"
+)
+
+type ActiveSession struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type SessionsResponse struct {
+	Data []ActiveSession `json:"data"`
+}
+
+// currentSessionID returns the sessions table key of the request's own
+// session, or "" if it has none yet.
+func (s *Server) currentSessionID(r *http.Request) string {
+	sess, _ := s.Sessions.Get(r, SessionName)
+	if sess.ID == "" {
+		return ""
+	}
+	return sessionstore.HashID(sess.ID)
+}
+
+func (s *Server) activeSessions(r *http.Request) ([]ActiveSession, error) {
+	rows, err := db.ListUserSessions(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := s.currentSessionID(r)
+	out := make([]ActiveSession, len(rows))
+	for i, row := range rows {
+		out[i] = ActiveSession{
+			ID:         row.ID,
+			UserAgent:  row.UserAgent,
+			CreatedAt:  row.CreatedAt,
+			LastSeenAt: row.LastSeenAt,
+			ExpiresAt:  row.ExpiresAt,
+			Current:    row.ID == current,
+		}
+	}
+	return out, nil
+}
+
+// endCurrentSession logs the request's session out locally. It's used after
+// the session rows were revoked so the following flash doesn't resurrect
+// the revoked session.
+func (s *Server) endCurrentSession(r *http.Request) {
+	sess, _ := s.Sessions.Get(r, SessionName)
+	delete(sess.Values, "user_id")
+	sess.ID = ""
+}
+
+func (s *Server) ServeSessionsPage(w http.ResponseWriter, r *http.Request) {
+	if currentUser(r) == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	active, err := s.activeSessions(r)
+	if err != nil {
+		log.Printf("list sessions failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "sessions.html", ViewData{
+		User:      currentUser(r),
+		Flashes:   s.getFlashes(w, r),
+		Sessions:  active,
+		CSRFToken: s.csrfToken(w, r),
+	})
+}
+
+// ListSessions returns the logged-in user's active sessions.
+func (s *Server) ListSessions(w http.ResponseWriter, r *http.Request) {
+	active, err := s.activeSessions(r)
+	if err != nil {
+		log.Printf("list sessions failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, SessionsResponse{Data: active})
+}
+
+// RevokeSession logs out one of the user's sessions. Revoking the current
+// session is the same as logging out.
+func (s *Server) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	err := db.DeleteUserSession(r.Context(), s.DB, currentUser(r).ID, id)
+	if errors.Is(err, db.ErrSessionNotFound) {
+		s.flashAndRedirect(w, r, "That session no longer exists", "/sessions")
+		return
+	}
+	if err != nil {
+		log.Printf("revoke session failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/sessions")
+		return
+	}
+
+	if id == s.currentSessionID(r) {
+		s.endCurrentSession(r)
+		s.flashAndRedirect(w, r, "You were logged out", "/login")
+		return
+	}
+	s.flashAndRedirect(w, r, "The session was revoked", "/sessions")
+}
+
+// RevokeAllSessions logs the user out everywhere, including here.
+func (s *Server) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	if _, err := db.DeleteUserSessions(r.Context(), s.DB, currentUser(r).ID); err != nil {
+		log.Printf("revoke all sessions failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/sessions")
+		return
+	}
+	s.audit(r, db.EventSessionsRevoke, currentUser(r).ID, currentUser(r).Username, "")
+
+	s.endCurrentSession(r)
+	s.flashAndRedirect(w, r, "You were logged out on all devices", "/login")
+}
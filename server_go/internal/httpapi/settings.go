@@ -0,0 +1,184 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/mail"
+)
+
+func (s *Server) ServeSettingsPage(w http.ResponseWriter, r *http.Request) {
+	u := currentUser(r)
+	if u == nil || u.TokenID != 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	row, err := db.GetUserByID(r.Context(), s.DB, u.ID)
+	if err != nil {
+		log.Printf("settings page user lookup failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, "settings.html", ViewData{
+		User:        u,
+		Flashes:     s.getFlashes(w, r),
+		HasPassword: row.PasswordHash != "",
+		CSRFToken:   s.csrfToken(w, r),
+	})
+}
+
+// reauthenticate checks the `current_password` form field before an account
+// change, so a hijacked session alone can't take the account over. Wrong
+// passwords count towards the login lockout. It answers through authResult
+// when the check fails.
+func (s *Server) reauthenticate(w http.ResponseWriter, r *http.Request) (*db.UserRow, bool) {
+	row, err := db.GetUserByID(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		log.Printf("reauthenticate user lookup failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/settings")
+		return nil, false
+	}
+	if row.PasswordHash == "" {
+		s.authResult(w, r, http.StatusBadRequest, "Your account has no password yet. Set one with \"Forgot password\" on the login page first", "/settings")
+		return nil, false
+	}
+
+	ip, account := s.clientIP(r), throttleAccountKey(row.Username)
+	until, err := s.loginLockedUntil(r.Context(), ip, account)
+	if err != nil {
+		log.Printf("login throttle lookup failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/settings")
+		return nil, false
+	}
+	if !until.IsZero() {
+		s.authResult(w, r, http.StatusTooManyRequests, lockedMessage(until), "/settings")
+		return nil, false
+	}
+	if !auth.VerifyPassword(row.PasswordHash, r.FormValue("current_password")) {
+		s.recordLoginFailure(r.Context(), ip, account)
+		s.audit(r, db.EventLoginFailed, row.ID, row.Username, "reauthentication")
+		s.authResult(w, r, http.StatusUnauthorized, "Your current password is incorrect", "/settings")
+		return nil, false
+	}
+	return row, true
+}
+
+// ChangePassword sets a new password after checking the current one. The
+// user's other sessions are logged out and this one gets a fresh token.
+func (s *Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "current_password", "password") {
+		return
+	}
+
+	password := r.FormValue("password")
+	switch {
+	case password == "":
+		s.authResult(w, r, http.StatusBadRequest, "You have to enter a new password", "/settings")
+		return
+	case password != r.FormValue("password2"):
+		s.authResult(w, r, http.StatusBadRequest, "The two passwords do not match", "/settings")
+		return
+	}
+
+	row, ok := s.reauthenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.UpdatePasswordHash(r.Context(), s.DB, row.ID, auth.HashPassword(password)); err != nil {
+		log.Printf("change password failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/settings")
+		return
+	}
+	s.audit(r, db.EventPasswordChange, row.ID, row.Username, "")
+	if _, err := db.DeleteUserSessions(r.Context(), s.DB, row.ID); err != nil {
+		log.Printf("revoke sessions after password change failed: %v", err)
+	}
+	s.logIn(w, r, row.ID)
+	s.authResult(w, r, http.StatusOK, "Your password was changed and your other devices were logged out", "/settings")
+}
+
+// ChangeEmail moves the account to a new address after checking the
+// password. The new address has to be verified again, and the old one is
+// told about the change.
+func (s *Server) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "current_password", "email") {
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	switch {
+	case email == "" || !strings.Contains(email, "@"):
+		s.authResult(w, r, http.StatusBadRequest, "You have to enter a valid email address", "/settings")
+		return
+	case strings.EqualFold(email, currentUser(r).Email):
+		s.authResult(w, r, http.StatusBadRequest, "That is already your email address", "/settings")
+		return
+	}
+
+	row, ok := s.reauthenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err := db.ChangeEmail(r.Context(), s.DB, row.ID, email)
+	if errors.Is(err, db.ErrEmailTaken) {
+		s.authResult(w, r, http.StatusConflict, "That email address is already in use", "/settings")
+		return
+	}
+	if err != nil {
+		log.Printf("change email failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/settings")
+		return
+	}
+
+	s.audit(r, db.EventEmailChange, row.ID, row.Username, row.Email+" -> "+email)
+	s.sendMail(mail.Message{
+		To:      row.Email,
+		Subject: "Your WhoKnows email address was changed",
+		Body: "Hi " + row.Username + ",\n\n" +
+			"The email address of your WhoKnows account was changed to " + email + ".\n\n" +
+			"If it wasn't you, reset your password and contact us right away.\n",
+	})
+	row.Email = email
+	s.sendVerificationEmail(row)
+
+	s.authResult(w, r, http.StatusOK, "Your email address was changed. Check your inbox to verify the new address", "/settings")
+}
+
+// DeleteAccount removes the user and everything tied to them after checking
+// the password and that the `confirm_username` field matches.
+func (s *Server) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "current_password", "confirm_username") {
+		return
+	}
+	if strings.TrimSpace(r.FormValue("confirm_username")) != currentUser(r).Username {
+		s.authResult(w, r, http.StatusBadRequest, "Type your username to confirm that you want to delete your account", "/settings")
+		return
+	}
+
+	row, ok := s.reauthenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err := db.DeleteUser(r.Context(), s.DB, row.ID)
+	if errors.Is(err, db.ErrLastAdmin) {
+		s.authResult(w, r, http.StatusConflict, "You are the only admin. Make someone else an admin before deleting your account", "/settings")
+		return
+	}
+	if err != nil {
+		log.Printf("delete account failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/settings")
+		return
+	}
+
+	s.audit(r, db.EventAccountDelete, 0, row.Username, "")
+	s.endCurrentSession(r)
+	s.authResult(w, r, http.StatusOK, "Your account was deleted", "/")
+}
@@ -0,0 +1,186 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+)
+
+// The checks below fail before the password is verified, so they don't
+// need a database.
+func TestAccountChangesValidateInput(t *testing.T) {
+	s := testServer()
+	user := &User{ID: 1, Username: "alice", Email: "alice@example.com"}
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		form    url.Values
+	}{
+		{"password mismatch", s.ChangePassword, url.Values{"current_password": {"old"}, "password": {"new"}, "password2": {"other"}}},
+		{"invalid email", s.ChangeEmail, url.Values{"current_password": {"old"}, "email": {"nope"}}},
+		{"same email", s.ChangeEmail, url.Values{"current_password": {"old"}, "email": {"ALICE@example.com"}}},
+		{"wrong username", s.DeleteAccount, url.Values{"current_password": {"old"}, "confirm_username": {"bob"}}},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+		rec := httptest.NewRecorder()
+
+		c.handler(rec, req)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/settings" {
+			t.Errorf("%s: expected a redirect to /settings, got %d %q", c.name, rec.Code, rec.Header().Get("Location"))
+		}
+
+		req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+		rec = httptest.NewRecorder()
+
+		c.handler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400 for a JSON client, got %d", c.name, rec.Code)
+		}
+	}
+}
+
+func TestExportWithoutLoginReturns401(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewRouter(testServer()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/me/export", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestChangePasswordWrongCurrentPassword(t *testing.T) {
+	s := newTestDBServer(t)
+	user := mustCreateUser(t, s, "alice", "correct horse")
+
+	rec := postForm(s.ChangePassword, user, url.Values{"current_password": {"wrong"}, "password": {"new secret"}, "password2": {"new secret"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/settings" {
+		t.Fatalf("expected a redirect to /settings, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := flashes(t, s, rec); len(got) != 1 || got[0] != "Your current password is incorrect" {
+		t.Errorf("unexpected flashes %q", got)
+	}
+
+	ctx := context.Background()
+	row, err := db.GetUserByID(ctx, s.DB, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.VerifyPassword(row.PasswordHash, "correct horse") {
+		t.Error("expected the password to be unchanged")
+	}
+	var failures int
+	if err := s.DB.QueryRow(ctx, "SELECT failures FROM login_throttles WHERE scope = $1 AND key = $2", db.ThrottleScopeAccount, "alice").Scan(&failures); err != nil {
+		t.Fatalf("expected the failure to count towards the lockout: %v", err)
+	}
+	if failures != 1 {
+		t.Errorf("expected 1 failure, got %d", failures)
+	}
+	events, err := db.ListAuthEvents(ctx, s.DB, db.AuthEventFilter{Type: db.EventLoginFailed, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Detail != "reauthentication" {
+		t.Errorf("expected a reauthentication failure in the audit log, got %+v", events)
+	}
+}
+
+func TestChangePasswordWithCurrentPassword(t *testing.T) {
+	s := newTestDBServer(t)
+	user := mustCreateUser(t, s, "alice", "correct horse")
+
+	rec := postForm(s.ChangePassword, user, url.Values{"current_password": {"correct horse"}, "password": {"new secret"}, "password2": {"new secret"}})
+	if got := flashes(t, s, rec); len(got) != 1 || !strings.HasPrefix(got[0], "Your password was changed") {
+		t.Errorf("unexpected flashes %q", got)
+	}
+	row, err := db.GetUserByID(context.Background(), s.DB, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.VerifyPassword(row.PasswordHash, "new secret") {
+		t.Error("expected the new password to be set")
+	}
+}
+
+func TestDeleteAccountConfirmUsernameMismatch(t *testing.T) {
+	s := newTestDBServer(t)
+	user := mustCreateUser(t, s, "alice", "correct horse")
+
+	// Usernames are compared exactly; a case variant doesn't confirm.
+	rec := postForm(s.DeleteAccount, user, url.Values{"current_password": {"correct horse"}, "confirm_username": {"Alice"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/settings" {
+		t.Fatalf("expected a redirect to /settings, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := flashes(t, s, rec); len(got) != 1 || !strings.HasPrefix(got[0], "Type your username") {
+		t.Errorf("unexpected flashes %q", got)
+	}
+	if _, err := db.GetUserByID(context.Background(), s.DB, user.ID); err != nil {
+		t.Fatalf("expected the account to be kept, got %v", err)
+	}
+
+	rec = postForm(s.DeleteAccount, user, url.Values{"current_password": {"correct horse"}, "confirm_username": {"alice"}})
+	if rec.Header().Get("Location") != "/" {
+		t.Fatalf("expected a redirect to /, got %q", rec.Header().Get("Location"))
+	}
+	if _, err := db.GetUserByID(context.Background(), s.DB, user.ID); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("expected the account to be deleted, got %v", err)
+	}
+}
+
+func TestAccountChangesAnswerJSONClients(t *testing.T) {
+	s := newTestDBServer(t)
+	user := mustCreateUser(t, s, "alice", "correct horse")
+	mustCreateUser(t, s, "bob", "battery staple")
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		want    int
+	}{
+		{"wrong password", s.ChangePassword, `{"current_password":"wrong","password":"new secret","password2":"new secret"}`, http.StatusUnauthorized},
+		{"email taken", s.ChangeEmail, `{"current_password":"correct horse","email":"bob@example.com"}`, http.StatusConflict},
+		{"email changed", s.ChangeEmail, `{"current_password":"correct horse","email":"alice@example.org"}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		rec := postJSON(c.handler, user, c.body)
+		if rec.Code != c.want {
+			t.Errorf("%s: expected status %d, got %d: %s", c.name, c.want, rec.Code, rec.Body)
+		}
+		var got AuthResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.StatusCode == nil || *got.StatusCode != c.want {
+			t.Errorf("%s: expected an AuthResponse, got %s", c.name, rec.Body)
+		}
+	}
+
+	ctx := context.Background()
+	if err := db.LockLogin(ctx, s.DB, db.ThrottleScopeAccount, "alice", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	rec := postJSON(s.DeleteAccount, user, `{"current_password":"correct horse","confirm_username":"alice"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 while locked out, got %d", rec.Code)
+	}
+	if _, err := db.ClearLoginFailures(ctx, s.DB, db.ThrottleScopeAccount, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	rec = postJSON(s.DeleteAccount, user, `{"current_password":"correct horse","confirm_username":"alice"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200 after deleting, got %d: %s", rec.Code, rec.Body)
+	}
+}
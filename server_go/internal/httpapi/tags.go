@@ -0,0 +1,194 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+type Tag struct {
+	Slug      string `json:"slug"`
+	Name      string `json:"name"`
+	PageCount int64  `json:"page_count"`
+}
+
+type TagsResponse struct {
+	Data []Tag `json:"data"`
+}
+
+// ListTags godoc
+// @Summary List Tags
+// @Description Lists every tag with the number of pages carrying it.
+// @Tags tags
+// @Produce json
+// @Success 200 {object} TagsResponse
+// @Router /api/tags [get]
+//
+// ListTags returns every tag with the number of pages carrying it.
+func (s *Server) ListTags(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ListTags(r.Context(), s.DB)
+	if err != nil {
+		log.Printf("list tags failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	out := make([]Tag, len(rows))
+	for i, t := range rows {
+		out[i] = Tag{Slug: t.Slug, Name: t.Name, PageCount: t.PageCount}
+	}
+	writeJSON(w, http.StatusOK, TagsResponse{Data: out})
+}
+
+// CreateTag godoc
+// @Summary Create Tag
+// @Description Creates a tag, or returns the existing one with the same slug. Needs an editor with a verified email address; API tokens need the pages:write scope.
+// @Tags tags
+// @Accept x-www-form-urlencoded,json
+// @Produce json
+// @Param name formData string true "Tag name"
+// @Success 201 {object} Tag
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not allowed to edit pages"
+// @Failure 422 {object} ErrorResponse "Name has no letters or digits"
+// @Router /api/tags [post]
+//
+// CreateTag creates a tag from the `name` form field. Creating a tag that
+// already exists is not an error and returns the existing tag.
+func (s *Server) CreateTag(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "name") {
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if db.Slugify(name) == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Tag name must contain letters or digits")
+		return
+	}
+
+	t, err := db.EnsureTag(r.Context(), s.DB, name)
+	if err != nil {
+		log.Printf("create tag failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, Tag{Slug: t.Slug, Name: t.Name})
+}
+
+// DeleteTag godoc
+// @Summary Delete Tag
+// @Description Deletes a tag and takes it off every page.
+// @Tags tags
+// @Produce json
+// @Param slug path string true "Tag slug"
+// @Success 204 "Deleted"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not allowed to edit pages"
+// @Failure 404 {object} ErrorResponse "Tag not found"
+// @Router /api/tags/{slug} [delete]
+func (s *Server) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	err := db.DeleteTag(r.Context(), s.DB, chi.URLParam(r, "slug"))
+	if errors.Is(err, db.ErrTagNotFound) {
+		writeError(w, http.StatusNotFound, "Tag not found")
+		return
+	}
+	if err != nil {
+		log.Printf("delete tag failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TagPage godoc
+// @Summary Tag Page
+// @Description Attaches a tag to a page.
+// @Tags tags
+// @Accept x-www-form-urlencoded,json
+// @Produce json
+// @Param slug path string true "Tag slug"
+// @Param title formData string true "Page title"
+// @Success 204 "Tagged"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not allowed to edit pages"
+// @Failure 404 {object} ErrorResponse "Tag or page not found"
+// @Failure 422 {object} HTTPValidationError "Validation Error"
+// @Router /api/tags/{slug}/pages [post]
+//
+// TagPage attaches the tag in the URL to the page named by the `title`
+// form field.
+func (s *Server) TagPage(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "title") {
+		return
+	}
+	t, ok := s.tagFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := db.AddPageTag(r.Context(), s.DB, r.FormValue("title"), t.ID)
+	if errors.Is(err, db.ErrPageNotFound) {
+		writeError(w, http.StatusNotFound, "Page not found")
+		return
+	}
+	if err != nil {
+		log.Printf("tag page failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UntagPage godoc
+// @Summary Untag Page
+// @Description Detaches a tag from a page.
+// @Tags tags
+// @Produce json
+// @Param slug path string true "Tag slug"
+// @Param title query string true "Page title"
+// @Success 204 "Untagged"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not allowed to edit pages"
+// @Failure 404 {object} ErrorResponse "Tag not found"
+// @Failure 422 {object} ErrorResponse "Missing title"
+// @Router /api/tags/{slug}/pages [delete]
+//
+// UntagPage detaches the tag in the URL from the page named by the `title`
+// query parameter.
+func (s *Server) UntagPage(w http.ResponseWriter, r *http.Request) {
+	title := r.URL.Query().Get("title")
+	if title == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Missing required query parameter: title")
+		return
+	}
+	t, ok := s.tagFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.RemovePageTag(r.Context(), s.DB, title, t.ID); err != nil {
+		log.Printf("untag page failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) tagFromURL(w http.ResponseWriter, r *http.Request) (*db.TagRow, bool) {
+	t, err := db.GetTagBySlug(r.Context(), s.DB, chi.URLParam(r, "slug"))
+	if errors.Is(err, db.ErrTagNotFound) {
+		writeError(w, http.StatusNotFound, "Tag not found")
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("tag lookup failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return nil, false
+	}
+	return t, true
+}
@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/sessions"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/mail"
+)
+
+// newTestDBServer is testServer backed by TEST_DATABASE_URL, for handler
+// tests that need real rows. It applies migrations and truncates data so
+// each test starts with a clean slate.
+func newTestDBServer(t *testing.T) *Server {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set — skipping integration test")
+	}
+
+	ctx := context.Background()
+
+	sqlDB, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open sql db: %v", err)
+	}
+	defer func() { _ = sqlDB.Close() }()
+
+	if err := goose.SetDialect("postgres"); err != nil {
+		t.Fatalf("goose dialect: %v", err)
+	}
+	if err := goose.Up(sqlDB, migrationsDir()); err != nil {
+		t.Fatalf("goose up: %v", err)
+	}
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("open pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if _, err := pool.Exec(ctx, "TRUNCATE users, pages, tags, sessions, password_reset_tokens, login_throttles, api_tokens, user_identities, recovery_codes, auth_events, search_history, bookmarks, saved_searches, notifications, user_preferences, search_log RESTART IDENTITY CASCADE"); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	return &Server{
+		DB:          pool,
+		Sessions:    sessions.NewCookieStore([]byte("test-secret")),
+		Mailer:      &mail.MemoryMailer{},
+		SigningKeys: [][]byte{[]byte("test-signing-key")},
+	}
+}
+
+// migrationsDir resolves the migrations directory relative to this file.
+func migrationsDir() string {
+	_, thisFile, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(thisFile), "..", "..", "migrations")
+}
+
+// mustCreateUser inserts a user with the given password and returns it as
+// the request context carries it.
+func mustCreateUser(t *testing.T, s *Server, username, password string) *User {
+	t.Helper()
+	ctx := context.Background()
+	if err := db.CreateUser(ctx, s.DB, username, username+"@example.com", auth.HashPassword(password)); err != nil {
+		t.Fatal(err)
+	}
+	u, err := db.GetUserByUsername(ctx, s.DB, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &User{ID: u.ID, Username: u.Username, Email: u.Email, Role: u.Role, SearchHistory: u.SearchHistoryEnabled}
+}
+
+// withUser returns req with user logged in, as loadUser would leave it.
+func withUser(req *http.Request, user *User) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+}
+
+// postForm runs a form POST through handler as user.
+func postForm(handler http.HandlerFunc, user *User, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler(rec, withUser(req, user))
+	return rec
+}
+
+// postJSON runs a JSON POST through handler as user.
+func postJSON(handler http.HandlerFunc, user *User, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, withUser(req, user))
+	return rec
+}
+
+// flashes returns the flash messages a response saved to the session.
+func flashes(t *testing.T, s *Server, rec *httptest.ResponseRecorder) []string {
+	t.Helper()
+	// A handler may save the session more than once; the last cookie wins.
+	var last *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == SessionName {
+			last = c
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(last)
+	sess, err := s.Sessions.Get(req, SessionName)
+	if err != nil {
+		t.Fatalf("read session: %v", err)
+	}
+	var out []string
+	for _, f := range sess.Flashes() {
+		out = append(out, f.(string))
+	}
+	return out
+}
+
+// withURLParam sets a chi URL parameter, as the router would for a route
+// like /api/me/history/{id}/delete.
+func withURLParam(req *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// loginCookie returns a session cookie logging user in, and the session's
+// CSRF token, for requests that go through the router.
+func loginCookie(t *testing.T, s *Server, user *User) (*http.Cookie, string) {
+	t.Helper()
+	const csrf = "test-csrf-token"
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	sess, _ := s.Sessions.Get(req, SessionName)
+	sess.Values["user_id"] = user.ID
+	sess.Values[csrfSessionKey] = csrf
+	if err := sess.Save(req, rec); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	return rec.Result().Cookies()[0], csrf
+}
@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+	"whoknows_variations/server_go/internal/metrics"
+)
+
+// Login throttling. Failures are counted per client IP and per attempted
+// username in Postgres so blue and green share the same view. Once a key
+// reaches its threshold, every further failure locks it for an
+// exponentially growing delay.
+const (
+	loginFailureWindow      = 24 * time.Hour
+	loginAccountThreshold   = 5
+	loginIPThreshold        = 20
+	loginLockBaseDelay      = 30 * time.Second
+	loginLockMaxDelay       = time.Hour
+	invalidCredentialsFlash = "Invalid credentials"
+)
+
+// dummyPasswordHash is verified against when the username doesn't exist so
+// unknown and known usernames take about as long to reject.
+var dummyPasswordHash = auth.HashPassword("whoknows-dummy-password")
+
+// lockDuration returns how long to lock a key after its n-th failure, or 0
+// while it's under threshold.
+func lockDuration(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	d := loginLockBaseDelay
+	for i := threshold; i < failures && d < loginLockMaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, loginLockMaxDelay)
+}
+
+// clientIP returns the address of the client. Behind nginx (TrustProxy) the
+// X-Real-IP header it sets is used; otherwise the connection's peer address.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.TrustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func throttleAccountKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// loginLockedUntil returns the later of the IP and account locks, or the
+// zero time if neither is locked.
+func (s *Server) loginLockedUntil(ctx context.Context, ip, account string) (time.Time, error) {
+	ipUntil, err := db.LoginLockedUntil(ctx, s.DB, db.ThrottleScopeIP, ip)
+	if err != nil {
+		return time.Time{}, err
+	}
+	accountUntil, err := db.LoginLockedUntil(ctx, s.DB, db.ThrottleScopeAccount, account)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if accountUntil.After(ipUntil) {
+		return accountUntil, nil
+	}
+	return ipUntil, nil
+}
+
+// recordLoginFailure counts a failed attempt against both keys and locks
+// whichever crossed its threshold.
+func (s *Server) recordLoginFailure(ctx context.Context, ip, account string) {
+	metrics.ObserveLoginFailure("invalid_credentials")
+
+	for _, k := range []struct {
+		scope, key string
+		threshold  int
+	}{
+		{db.ThrottleScopeIP, ip, loginIPThreshold},
+		{db.ThrottleScopeAccount, account, loginAccountThreshold},
+	} {
+		failures, err := db.RecordLoginFailure(ctx, s.DB, k.scope, k.key, loginFailureWindow)
+		if err != nil {
+			log.Printf("record login failure failed: %v", err)
+			continue
+		}
+		if d := lockDuration(failures, k.threshold); d > 0 {
+			if err := db.LockLogin(ctx, s.DB, k.scope, k.key, time.Now().Add(d)); err != nil {
+				log.Printf("lock login failed: %v", err)
+				continue
+			}
+			metrics.ObserveLoginLockout(k.scope)
+		}
+	}
+}
+
+func lockedMessage(until time.Time) string {
+	wait := time.Until(until).Round(time.Second)
+	if wait >= time.Minute {
+		return fmt.Sprintf("Too many failed login attempts, try again in %d minutes", int(wait.Minutes()+0.5))
+	}
+	return fmt.Sprintf("Too many failed login attempts, try again in %d seconds", int(wait.Seconds()))
+}
+
+// SweepLoginThrottles deletes login throttle rows that no longer count
+// every interval until ctx is cancelled. Like the session sweep it's safe
+// to run in both containers.
+func (s *Server) SweepLoginThrottles(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := db.DeleteStaleLoginThrottles(ctx, s.DB, loginFailureWindow)
+		if err != nil {
+			log.Printf("login throttle sweep failed: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("login throttle sweep removed %d rows", n)
+		}
+	}
+}
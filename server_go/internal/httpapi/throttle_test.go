@@ -0,0 +1,38 @@
+package httpapi
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLockDuration(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{50, time.Hour},
+	}
+	for _, c := range cases {
+		if got := lockDuration(c.failures, 5); got != c.want {
+			t.Errorf("lockDuration(%d, 5) = %v, want %v", c.failures, got, c.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/login", nil)
+	req.RemoteAddr = "172.18.0.1:51234"
+	req.Header.Set("X-Real-IP", "203.0.113.7")
+
+	if got := (&Server{}).clientIP(req); got != "172.18.0.1" {
+		t.Errorf("without TrustProxy expected peer address, got %q", got)
+	}
+	if got := (&Server{TrustProxy: true}).clientIP(req); got != "203.0.113.7" {
+		t.Errorf("with TrustProxy expected X-Real-IP, got %q", got)
+	}
+}
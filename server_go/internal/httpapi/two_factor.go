@@ -0,0 +1,432 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+)
+
+// Session keys for a login that passed the password check but still owes
+// the second factor. Until it is paid the session has no user_id, so the
+// user is not logged in.
+const (
+	pendingUserKey  = "2fa_pending_user_id"
+	pendingSinceKey = "2fa_pending_since"
+)
+
+// pendingLoginTTL is how long the second step may take.
+const pendingLoginTTL = 5 * time.Minute
+
+const recoveryCodeCount = 10
+
+const totpIssuer = "WhoKnows"
+
+// TwoFactorView is what two_factor.html shows.
+type TwoFactorView struct {
+	Enabled bool
+	// Secret and QRCode are shown while enrolling.
+	Secret string
+	QRCode template.URL
+	// RecoveryCodes are shown once, right after they were generated.
+	RecoveryCodes          []string
+	RemainingRecoveryCodes int64
+	Required               bool
+}
+
+// twoFactorRequired reports whether policy makes u use two-factor login.
+func (s *Server) twoFactorRequired(u *User) bool {
+	return s.TwoFactorRequiredRole != "" && u.HasRole(s.TwoFactorRequiredRole)
+}
+
+// completeLogin is called once the user's password or provider checked out;
+// method says which, for the audit log. Users with two-factor login on are
+// parked in the pending state and sent to the second step; everyone else is
+// logged in.
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, user *db.UserRow, method string) {
+	if user.TOTPEnabledAt != nil {
+		sess, _ := s.Sessions.Get(r, SessionName)
+		sess.ID = ""
+		delete(sess.Values, csrfSessionKey)
+		delete(sess.Values, "user_id")
+		sess.Values[pendingUserKey] = user.ID
+		sess.Values[pendingSinceKey] = time.Now().Unix()
+		_ = sess.Save(r, w)
+		if wantsJSON(r) {
+			writeAuthResponse(w, http.StatusAccepted, "Two-factor authentication required. Send the code to /api/login/2fa")
+			return
+		}
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	// Only a finished login resets the account counter; a correct
+	// password still waiting for its second factor does not.
+	if _, err := db.ClearLoginFailures(r.Context(), s.DB, db.ThrottleScopeAccount, throttleAccountKey(user.Username)); err != nil {
+		log.Printf("clear login failures failed: %v", err)
+	}
+	s.logIn(w, r, user.ID)
+	s.audit(r, db.EventLogin, user.ID, user.Username, method)
+	if s.twoFactorRequired(userFromRow(user)) {
+		s.authResult(w, r, http.StatusOK, "Your role requires two-factor authentication. Please set it up now", "/settings/2fa")
+		return
+	}
+	if wantsJSON(r) {
+		writeAuthResponse(w, http.StatusOK, "You were logged in")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// pendingLoginUser returns the user whose login waits for a second factor,
+// or nil when there is none or it took too long.
+func (s *Server) pendingLoginUser(r *http.Request) (*db.UserRow, error) {
+	sess, _ := s.Sessions.Get(r, SessionName)
+	id, ok := sess.Values[pendingUserKey].(int64)
+	if !ok {
+		return nil, nil
+	}
+	since, _ := sess.Values[pendingSinceKey].(int64)
+	if time.Since(time.Unix(since, 0)) > pendingLoginTTL {
+		return nil, nil
+	}
+	u, err := db.GetUserByID(r.Context(), s.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// checkSecondFactor accepts either a current TOTP code, once, or an unused
+// recovery code, which is then spent.
+func (s *Server) checkSecondFactor(ctx context.Context, u *db.UserRow, code string) (ok, usedRecovery bool, err error) {
+	if step, valid := auth.ValidateTOTP(u.TOTPSecret, code, time.Now()); valid {
+		ok, err = db.AcceptTOTPStep(ctx, s.DB, u.ID, step)
+		return ok, false, err
+	}
+	ok, err = db.UseRecoveryCode(ctx, s.DB, u.ID, auth.HashRecoveryCode(code))
+	return ok, ok, err
+}
+
+func (s *Server) ServeTwoFactorLoginPage(w http.ResponseWriter, r *http.Request) {
+	u, err := s.pendingLoginUser(r)
+	if err != nil {
+		log.Printf("pending login lookup failed: %v", err)
+	}
+	if u == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	renderTemplate(w, "login_2fa.html", ViewData{Flashes: s.getFlashes(w, r), CSRFToken: s.csrfToken(w, r)})
+}
+
+// VerifyTwoFactorLogin is the second login step. Wrong codes count towards
+// the same lockout as wrong passwords.
+func (s *Server) VerifyTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "code") {
+		return
+	}
+
+	u, err := s.pendingLoginUser(r)
+	if err != nil {
+		log.Printf("pending login lookup failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/login")
+		return
+	}
+	if u == nil || u.TOTPEnabledAt == nil {
+		s.authResult(w, r, http.StatusUnauthorized, "Your login expired, please start again", "/login")
+		return
+	}
+
+	ip, account := s.clientIP(r), throttleAccountKey(u.Username)
+	until, err := s.loginLockedUntil(r.Context(), ip, account)
+	if err != nil {
+		log.Printf("login throttle lookup failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/login/2fa")
+		return
+	}
+	if !until.IsZero() {
+		s.audit(r, db.EventLoginFailed, u.ID, u.Username, "locked")
+		s.authResult(w, r, http.StatusTooManyRequests, lockedMessage(until), "/login")
+		return
+	}
+
+	ok, usedRecovery, err := s.checkSecondFactor(r.Context(), u, r.FormValue("code"))
+	if err != nil {
+		log.Printf("second factor check failed: %v", err)
+		s.authResult(w, r, http.StatusInternalServerError, "Internal error, please try again", "/login/2fa")
+		return
+	}
+	if !ok {
+		s.recordLoginFailure(r.Context(), ip, account)
+		s.audit(r, db.EventLoginFailed, u.ID, u.Username, "invalid second factor")
+		s.authResult(w, r, http.StatusUnauthorized, "Invalid authentication code", "/login/2fa")
+		return
+	}
+
+	if _, err := db.ClearLoginFailures(r.Context(), s.DB, db.ThrottleScopeAccount, account); err != nil {
+		log.Printf("clear login failures failed: %v", err)
+	}
+	s.logIn(w, r, u.ID)
+	if usedRecovery {
+		s.audit(r, db.EventLogin, u.ID, u.Username, "recovery code")
+	} else {
+		s.audit(r, db.EventLogin, u.ID, u.Username, "totp")
+	}
+
+	if usedRecovery {
+		left, err := db.CountUnusedRecoveryCodes(r.Context(), s.DB, u.ID)
+		if err != nil {
+			log.Printf("count recovery codes failed: %v", err)
+		}
+		s.authResult(w, r, http.StatusOK, "You logged in with a recovery code. You have "+pluralize(left, "recovery code")+" left", "/settings/2fa")
+		return
+	}
+	if wantsJSON(r) {
+		writeAuthResponse(w, http.StatusOK, "You were logged in")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) renderTwoFactorPage(w http.ResponseWriter, r *http.Request, recoveryCodes []string) {
+	row, err := db.GetUserByID(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		log.Printf("two-factor page user lookup failed: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	view := &TwoFactorView{
+		Enabled:       row.TOTPEnabledAt != nil,
+		RecoveryCodes: recoveryCodes,
+		Required:      s.twoFactorRequired(currentUser(r)),
+	}
+	if view.Enabled {
+		view.RemainingRecoveryCodes, err = db.CountUnusedRecoveryCodes(r.Context(), s.DB, row.ID)
+		if err != nil {
+			log.Printf("count recovery codes failed: %v", err)
+		}
+	} else {
+		if row.TOTPSecret == "" {
+			row.TOTPSecret = auth.NewTOTPSecret()
+			if err := db.StartTOTPEnrollment(r.Context(), s.DB, row.ID, row.TOTPSecret); err != nil {
+				log.Printf("start totp enrollment failed: %v", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+		png, err := qrcode.Encode(auth.TOTPURI(totpIssuer, row.Username, row.TOTPSecret), qrcode.Medium, 256)
+		if err != nil {
+			log.Printf("qr code encode failed: %v", err)
+		} else {
+			// #nosec G203 -- A data: URL of a PNG we just encoded ourselves.
+			view.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		}
+		view.Secret = groupSecret(row.TOTPSecret)
+	}
+
+	renderTemplate(w, "two_factor.html", ViewData{
+		User:      currentUser(r),
+		Flashes:   s.getFlashes(w, r),
+		TwoFactor: view,
+		CSRFToken: s.csrfToken(w, r),
+	})
+}
+
+// groupSecret splits the secret into blocks of four for typing it in by
+// hand.
+func groupSecret(secret string) string {
+	var parts []string
+	for len(secret) > 4 {
+		parts = append(parts, secret[:4])
+		secret = secret[4:]
+	}
+	return strings.Join(append(parts, secret), " ")
+}
+
+func (s *Server) ServeTwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	if u := currentUser(r); u == nil || u.TokenID != 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	s.renderTwoFactorPage(w, r, nil)
+}
+
+func newRecoveryCodes() (codes, hashes []string) {
+	codes = auth.NewRecoveryCodes(recoveryCodeCount)
+	hashes = make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = auth.HashRecoveryCode(c)
+	}
+	return codes, hashes
+}
+
+// EnableTwoFactor confirms enrollment with a first code from the user's app
+// and shows their recovery codes.
+func (s *Server) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "code") {
+		return
+	}
+	row, err := db.GetUserByID(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		log.Printf("enable two-factor user lookup failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/2fa")
+		return
+	}
+	if row.TOTPEnabledAt != nil {
+		s.flashAndRedirect(w, r, "Two-factor authentication is already on", "/settings/2fa")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(row.TOTPSecret, r.FormValue("code"), time.Now())
+	if !ok {
+		s.flashAndRedirect(w, r, "That code didn't match. Check that your device's clock is correct and try again", "/settings/2fa")
+		return
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err := db.EnableTOTP(r.Context(), s.DB, row.ID, step, hashes); err != nil {
+		log.Printf("enable two-factor failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/2fa")
+		return
+	}
+	s.audit(r, db.EventTwoFactorEnable, row.ID, row.Username, "")
+	s.renderTwoFactorPage(w, r, codes)
+}
+
+// DisableTwoFactor turns two-factor login off after checking a code, unless
+// policy requires it for the user's role.
+func (s *Server) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "code") {
+		return
+	}
+	if s.twoFactorRequired(currentUser(r)) {
+		s.flashAndRedirect(w, r, "Your role requires two-factor authentication", "/settings/2fa")
+		return
+	}
+	row, ok := s.confirmSecondFactor(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.DisableTOTP(r.Context(), s.DB, row.ID); err != nil {
+		log.Printf("disable two-factor failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/2fa")
+		return
+	}
+	s.audit(r, db.EventTwoFactorDisable, row.ID, row.Username, "")
+	s.flashAndRedirect(w, r, "Two-factor authentication is off", "/settings/2fa")
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// a code.
+func (s *Server) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "code") {
+		return
+	}
+	row, ok := s.confirmSecondFactor(w, r)
+	if !ok {
+		return
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err := db.ReplaceRecoveryCodes(r.Context(), s.DB, row.ID, hashes); err != nil {
+		log.Printf("regenerate recovery codes failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/2fa")
+		return
+	}
+	s.renderTwoFactorPage(w, r, codes)
+}
+
+// confirmSecondFactor re-checks the second factor before a sensitive change
+// to it, flashing and redirecting when the code is wrong. Wrong codes count
+// towards the login lockout like wrong passwords do.
+func (s *Server) confirmSecondFactor(w http.ResponseWriter, r *http.Request) (*db.UserRow, bool) {
+	row, err := db.GetUserByID(r.Context(), s.DB, currentUser(r).ID)
+	if err != nil {
+		log.Printf("two-factor user lookup failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/2fa")
+		return nil, false
+	}
+	if row.TOTPEnabledAt == nil {
+		s.flashAndRedirect(w, r, "Two-factor authentication is not on", "/settings/2fa")
+		return nil, false
+	}
+
+	ip, account := s.clientIP(r), throttleAccountKey(row.Username)
+	until, err := s.loginLockedUntil(r.Context(), ip, account)
+	if err != nil {
+		log.Printf("login throttle lookup failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/2fa")
+		return nil, false
+	}
+	if !until.IsZero() {
+		s.flashAndRedirect(w, r, lockedMessage(until), "/settings/2fa")
+		return nil, false
+	}
+
+	ok, _, err := s.checkSecondFactor(r.Context(), row, r.FormValue("code"))
+	if err != nil {
+		log.Printf("second factor check failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/settings/2fa")
+		return nil, false
+	}
+	if !ok {
+		s.recordLoginFailure(r.Context(), ip, account)
+		s.audit(r, db.EventLoginFailed, row.ID, row.Username, "invalid second factor")
+		s.flashAndRedirect(w, r, "Invalid authentication code", "/settings/2fa")
+		return nil, false
+	}
+	return row, true
+}
+
+// AdminResetTwoFactor godoc
+// @Summary Reset Two-Factor
+// @Description Turns two-factor login off for a user and redirects to /admin with a flash message.
+// @Tags admin
+// @Accept x-www-form-urlencoded
+// @Param username formData string true "Username"
+// @Success 303 {string} string "Redirect to /admin"
+// @Failure 401 {object} ErrorResponse "Login required"
+// @Failure 403 {object} ErrorResponse "Invalid or missing CSRF token, or not an admin"
+// @Router /api/admin/users/reset-2fa [post]
+//
+// AdminResetTwoFactor turns two-factor login off for the user in the
+// `username` form field, for users who lost both their device and their
+// recovery codes.
+func (s *Server) AdminResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if !requireFormFields(w, r, "username") {
+		return
+	}
+	target := s.adminTargetUser(w, r)
+	if target == nil {
+		return
+	}
+	if err := db.DisableTOTP(r.Context(), s.DB, target.ID); err != nil {
+		log.Printf("admin reset two-factor failed: %v", err)
+		s.flashAndRedirect(w, r, "Internal error, please try again", "/admin")
+		return
+	}
+	s.audit(r, db.EventTwoFactorDisable, target.ID, target.Username, "reset by admin "+currentUser(r).Username)
+	s.flashAndRedirect(w, r, "Two-factor authentication was reset for "+target.Username, "/admin")
+}
+
+// ParseTwoFactorPolicy reads the least privileged role that must use
+// two-factor login; empty means nobody has to.
+func ParseTwoFactorPolicy(v string) (string, error) {
+	role := strings.TrimSpace(v)
+	if role == "" || db.RoleRank(role) >= 0 {
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown two-factor policy %q (want empty, %s)", v, strings.Join(db.Roles, ", "))
+}
@@ -0,0 +1,172 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+func TestParseTwoFactorPolicy(t *testing.T) {
+	for _, in := range []string{"", "user", "editor", "admin"} {
+		if got, err := ParseTwoFactorPolicy(in); err != nil || got != in {
+			t.Errorf("ParseTwoFactorPolicy(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseTwoFactorPolicy("root"); err == nil {
+		t.Error("expected an error for an unknown role")
+	}
+}
+
+func TestRequireRoleEnforcesTwoFactorPolicy(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	s := &Server{TwoFactorRequiredRole: db.RoleEditor}
+
+	cases := []struct {
+		name string
+		user *User
+		want int
+	}{
+		{"editor without 2fa", &User{ID: 1, Role: db.RoleEditor}, http.StatusForbidden},
+		{"editor with 2fa", &User{ID: 1, Role: db.RoleEditor, TwoFactor: true}, http.StatusNoContent},
+		{"admin without 2fa", &User{ID: 1, Role: db.RoleAdmin}, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/tags", nil)
+		req.Header.Set("Accept", "application/json")
+		req = req.WithContext(context.WithValue(req.Context(), userContextKey, c.user))
+		rec := httptest.NewRecorder()
+
+		s.RequireRole(db.RoleEditor)(ok).ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.want, rec.Code)
+		}
+	}
+}
+
+func TestTwoFactorLoginPageWithoutPendingLoginRedirects(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewRouter(testServer()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login/2fa", nil))
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("expected a redirect to /login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestVerifyTwoFactorLoginWithoutPendingLoginRedirects(t *testing.T) {
+	r := NewRouter(testServer())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login/2fa", strings.NewReader(url.Values{"code": {"123456"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	withCSRF(t, r, req)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("expected a redirect to /login, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestGroupSecret(t *testing.T) {
+	if got := groupSecret("ABCDEFGHIJ"); got != "ABCD EFGH IJ" {
+		t.Errorf("groupSecret = %q", got)
+	}
+}
+
+func TestLoginKeepsAccountFailuresUntilSecondFactor(t *testing.T) {
+	s := newTestDBServer(t)
+	user := mustCreateUser(t, s, "alice", "correct horse")
+	ctx := context.Background()
+	if err := db.StartTOTPEnrollment(ctx, s.DB, user.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnableTOTP(ctx, s.DB, user.ID, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RecordLoginFailure(ctx, s.DB, db.ThrottleScopeAccount, "alice", loginFailureWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(url.Values{"username": {"alice"}, "password": {"correct horse"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	s.Login(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	var failures int
+	if err := s.DB.QueryRow(ctx, "SELECT failures FROM login_throttles WHERE scope = $1 AND key = $2", db.ThrottleScopeAccount, "alice").Scan(&failures); err != nil {
+		t.Fatalf("expected the failure to survive the password step: %v", err)
+	}
+	if failures != 1 {
+		t.Errorf("expected 1 failure, got %d", failures)
+	}
+}
+
+func TestDisableTwoFactorWrongCodeCountsAsLoginFailure(t *testing.T) {
+	s := newTestDBServer(t)
+	user := mustCreateUser(t, s, "alice", "correct horse")
+	ctx := context.Background()
+	if err := db.StartTOTPEnrollment(ctx, s.DB, user.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnableTOTP(ctx, s.DB, user.ID, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := postForm(s.DisableTwoFactor, user, url.Values{"code": {"not a code"}})
+	if got := flashes(t, s, rec); len(got) != 1 || got[0] != "Invalid authentication code" {
+		t.Errorf("unexpected flashes %q", got)
+	}
+	row, err := db.GetUserByID(ctx, s.DB, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.TOTPEnabledAt == nil {
+		t.Error("expected two-factor login to stay on")
+	}
+	var failures int
+	if err := s.DB.QueryRow(ctx, "SELECT failures FROM login_throttles WHERE scope = $1 AND key = $2", db.ThrottleScopeAccount, "alice").Scan(&failures); err != nil {
+		t.Fatalf("expected the wrong code to count towards the lockout: %v", err)
+	}
+	if failures != 1 {
+		t.Errorf("expected 1 failure, got %d", failures)
+	}
+	events, err := db.ListAuthEvents(ctx, s.DB, db.AuthEventFilter{Type: db.EventLoginFailed, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Detail != "invalid second factor" {
+		t.Errorf("expected a second factor failure in the audit log, got %+v", events)
+	}
+}
+
+func TestDisableTwoFactorLockedOut(t *testing.T) {
+	s := newTestDBServer(t)
+	user := mustCreateUser(t, s, "alice", "correct horse")
+	ctx := context.Background()
+	if err := db.StartTOTPEnrollment(ctx, s.DB, user.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnableTOTP(ctx, s.DB, user.ID, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RecordLoginFailure(ctx, s.DB, db.ThrottleScopeAccount, "alice", loginFailureWindow); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LockLogin(ctx, s.DB, db.ThrottleScopeAccount, "alice", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := postForm(s.DisableTwoFactor, user, url.Values{"code": {"not a code"}})
+	if got := flashes(t, s, rec); len(got) != 1 || !strings.HasPrefix(got[0], "Too many failed") {
+		t.Errorf("unexpected flashes %q", got)
+	}
+}
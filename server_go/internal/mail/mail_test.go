@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMailer_RecordsMessages(t *testing.T) {
+	m := &MemoryMailer{}
+	if err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "Hi", Body: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	sent := m.Sent()
+	if len(sent) != 1 || sent[0].To != "a@example.com" {
+		t.Fatalf("expected one message to a@example.com, got %+v", sent)
+	}
+}
+
+func TestFileMailer_WritesEML(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "noreply@example.com"}
+	if err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "Reset", Body: "line1\nline2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(entries))
+	}
+	data, err := os.ReadFile(dir + "/" + entries[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"From: noreply@example.com\r\n", "Subject: Reset\r\n", "\r\n\r\nline1\r\nline2"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected message to contain %q, got:\n%s", want, data)
+		}
+	}
+}
+
+func TestFileMailer_RejectsHeaderInjection(t *testing.T) {
+	m := &FileMailer{Dir: t.TempDir()}
+	err := m.Send(context.Background(), Message{To: "a@example.com\r\nBcc: evil@example.com", Subject: "x"})
+	if err == nil {
+		t.Fatal("expected an error for a header containing CRLF")
+	}
+}
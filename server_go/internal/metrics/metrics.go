@@ -53,6 +53,51 @@ var (
 			Buckets: []float64{0, 1, 2, 5, 10, 20, 50, 100},
 		},
 	)
+
+	legacyPasswordHashes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "whoknows_legacy_password_hashes",
+			Help: "Number of users whose password is still stored as a legacy MD5 hash.",
+		},
+	)
+
+	loginFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "whoknows_login_failures_total",
+			Help: "Total number of rejected login attempts.",
+		},
+		[]string{"reason"},
+	)
+
+	loginLockoutsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "whoknows_login_lockouts_total",
+			Help: "Total number of temporary login lockouts, by ip or account.",
+		},
+		[]string{"scope"},
+	)
+
+	searchLogDroppedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "whoknows_search_log_dropped_total",
+			Help: "Total number of search log entries that were not written, by reason.",
+		},
+		[]string{"reason"},
+	)
+
+	passwordRehashesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "whoknows_password_rehashes_total",
+			Help: "Total number of legacy password hashes upgraded on login.",
+		},
+	)
+
+	apiTokenInvalidTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "whoknows_api_token_invalid_total",
+			Help: "Total number of requests with an unknown or revoked API token.",
+		},
+	)
 )
 
 func ObserveHTTPRequest(method, route string, statusCode int, started time.Time) {
@@ -69,3 +114,37 @@ func ObserveSearch(duration time.Duration, resultCount int) {
 		searchZeroResultsTotal.Inc()
 	}
 }
+
+func SetLegacyPasswordHashes(count int64) {
+	legacyPasswordHashes.Set(float64(count))
+}
+
+// ObservePasswordRehash records a legacy hash being upgraded. The gauge is
+// decremented immediately; the periodic recount corrects any drift from the
+// other blue/green container.
+func ObservePasswordRehash() {
+	passwordRehashesTotal.Inc()
+	legacyPasswordHashes.Dec()
+}
+
+// ObserveLoginFailure records a rejected login. reason is
+// "invalid_credentials" or "locked".
+func ObserveLoginFailure(reason string) {
+	loginFailuresTotal.WithLabelValues(reason).Inc()
+}
+
+// ObserveInvalidAPIToken records a request with an unknown or revoked API
+// token. Only some of them make it into the audit log.
+func ObserveInvalidAPIToken() {
+	apiTokenInvalidTotal.Inc()
+}
+
+func ObserveLoginLockout(scope string) {
+	loginLockoutsTotal.WithLabelValues(scope).Inc()
+}
+
+// ObserveSearchLogDropped records n search log entries lost. reason is
+// "queue_full", "write_failed" or "closed".
+func ObserveSearchLogDropped(reason string, n int) {
+	searchLogDroppedTotal.WithLabelValues(reason).Add(float64(n))
+}
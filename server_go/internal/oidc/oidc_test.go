@@ -0,0 +1,150 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"whoknows_variations/server_go/internal/oidc"
+	"whoknows_variations/server_go/internal/oidc/oidctest"
+)
+
+const redirectURL = "https://whoknows.example/login/oidc/callback"
+
+func discover(t *testing.T, fake *oidctest.Server) *oidc.Provider {
+	t.Helper()
+	p, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:       fake.Issuer(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+		RedirectURL:  redirectURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// authorize runs the browser leg of the flow against the fake provider and
+// returns the code it redirects back with.
+func authorize(t *testing.T, p *oidc.Provider, state, nonce, verifier string) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(p.AuthCodeURL(state, nonce, oidc.PKCEChallenge(verifier)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: expected status 302, got %d", resp.StatusCode)
+	}
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(loc.String(), redirectURL) {
+		t.Fatalf("authorize redirected to %s", loc)
+	}
+	if got := loc.Query().Get("state"); got != state {
+		t.Fatalf("expected state %q back, got %q", state, got)
+	}
+	return loc.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	fake := oidctest.NewServer(t, "whoknows", "s3cret")
+	p := discover(t, fake)
+
+	verifier := oidc.NewPKCEVerifier()
+	code := authorize(t, p, "state-1", "nonce-1", verifier)
+
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "alice@example.com" || !bool(claims.EmailVerified) {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongPKCEVerifier(t *testing.T) {
+	fake := oidctest.NewServer(t, "whoknows", "s3cret")
+	p := discover(t, fake)
+
+	code := authorize(t, p, "state-1", "nonce-1", oidc.NewPKCEVerifier())
+	if _, err := p.Exchange(context.Background(), code, oidc.NewPKCEVerifier(), "nonce-1"); err == nil {
+		t.Fatal("expected the token endpoint to refuse a wrong verifier")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	fake := oidctest.NewServer(t, "whoknows", "s3cret")
+	p := discover(t, fake)
+
+	verifier := oidc.NewPKCEVerifier()
+	code := authorize(t, p, "state-1", "nonce-1", verifier)
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-2"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+	}
+}
+
+func TestExchangeRejectsTamperedClaims(t *testing.T) {
+	cases := []struct {
+		name   string
+		tamper func(map[string]any)
+		want   error
+	}{
+		{"wrong audience", func(c map[string]any) { c["aud"] = "someone-else" }, oidc.ErrInvalidIDToken},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example" }, oidc.ErrInvalidIDToken},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, oidc.ErrExpiredIDToken},
+		{"no subject", func(c map[string]any) { delete(c, "sub") }, oidc.ErrInvalidIDToken},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := oidctest.NewServer(t, "whoknows", "s3cret")
+			fake.Tamper = c.tamper
+			p := discover(t, fake)
+
+			verifier := oidc.NewPKCEVerifier()
+			code := authorize(t, p, "state-1", "nonce-1", verifier)
+			if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); !errors.Is(err, c.want) {
+				t.Fatalf("expected %v, got %v", c.want, err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignSignature(t *testing.T) {
+	fake := oidctest.NewServer(t, "whoknows", "s3cret")
+	other := oidctest.NewServer(t, "whoknows", "s3cret")
+	p := discover(t, fake)
+
+	raw := other.SignIDToken(map[string]any{
+		"iss":   fake.Issuer(),
+		"sub":   "user-1",
+		"aud":   "whoknows",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": "n",
+	})
+	if _, err := p.VerifyIDToken(context.Background(), raw, "n"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+	}
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	fake := oidctest.NewServer(t, "whoknows", "s3cret")
+	_, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:      fake.Issuer() + "/",
+		ClientID:    "whoknows",
+		RedirectURL: redirectURL,
+	})
+	if err == nil {
+		t.Fatal("expected discovery to fail when the issuer doesn't match")
+	}
+}
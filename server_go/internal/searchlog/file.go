@@ -0,0 +1,356 @@
+package searchlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat stamps rotated files: searches.log becomes
+// searches.log.20260301T100000.000000000, plus .gz when compressed.
+const backupTimeFormat = "20060102T150405.000000000"
+
+// FileOptions controls rotation and retention of a FileSink. Zero values
+// turn the corresponding feature off.
+type FileOptions struct {
+	// MaxSize rotates the file before it would grow past this many bytes.
+	MaxSize int64
+	// RotateEvery rotates the file when a new period starts, counted in
+	// UTC from the Unix epoch: 24h rotates at midnight UTC.
+	RotateEvery time.Duration
+	// Compress gzips rotated files.
+	Compress bool
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int
+	// MaxAge deletes rotated files older than this.
+	MaxAge time.Duration
+}
+
+// FileSink appends entries to a JSONL file, which it keeps open, and
+// rotates it according to its FileOptions. It is safe for concurrent use,
+// so Reopen can be called from a signal handler while the Logger writes.
+type FileSink struct {
+	path string
+	opts FileOptions
+	now  func() time.Time
+
+	mu   sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	size int64
+	// oldest is when the first entry in the current file was written.
+	oldest time.Time
+
+	// cleanup runs compression and retention of rotated files one at a
+	// time, off the write path.
+	cleanup   sync.Mutex
+	cleanupWG sync.WaitGroup
+}
+
+// NewFileSink opens path for appending, creating it and its directory if
+// needed.
+func NewFileSink(path string, opts FileOptions) (*FileSink, error) {
+	dir := filepath.Dir(path)
+	if dir != "" && dir != "." {
+		// #nosec G301,G703 -- Log destination comes from deployment config and must be allowed outside the repo.
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, err
+		}
+	}
+	s := &FileSink{path: path, opts: opts, now: time.Now}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open (re)opens the file at s.path. s.mu must be held, or s not yet
+// shared.
+func (s *FileSink) open() error {
+	// #nosec G302,G304,G703 -- Log destination comes from deployment config and is intentionally variable.
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.f, s.w, s.size = f, bufio.NewWriter(f), info.Size()
+	s.oldest = time.Time{}
+	if s.size > 0 {
+		s.oldest = firstEntryTime(s.path)
+	}
+	return nil
+}
+
+// firstEntryTime returns the time of the first entry in the file at path,
+// or the zero time if it can't be read.
+func firstEntryTime(path string) time.Time {
+	// #nosec G304 -- Log destination comes from deployment config.
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer func() { _ = f.Close() }()
+
+	var first time.Time
+	errStop := errors.New("stop")
+	_ = Decode(f, func(e Entry) error {
+		first = e.Time
+		return errStop
+	})
+	return first
+}
+
+// closeFile flushes and closes the current file. s.mu must be held.
+func (s *FileSink) closeFile() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.w.Flush()
+	err = errors.Join(err, s.f.Close())
+	s.f, s.w = nil, nil
+	return err
+}
+
+func (s *FileSink) Write(entries []Entry) error {
+	var buf strings.Builder
+	if err := writeJSONL(&buf, entries); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		// A failed rotation or reopen left no file; try again.
+		if err := s.open(); err != nil {
+			return fmt.Errorf("%s: %w", s.path, err)
+		}
+	}
+	if s.dueForRotation(int64(buf.Len())) {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotate %s: %w", s.path, err)
+		}
+	}
+
+	if s.size == 0 {
+		s.oldest = s.now()
+	}
+	n, err := io.WriteString(s.w, buf.String())
+	s.size += int64(n)
+	if err == nil {
+		err = s.w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	return nil
+}
+
+// dueForRotation reports whether the file must be rotated before n more
+// bytes are written. An empty file is never rotated for size, so a single
+// oversized batch still gets written.
+func (s *FileSink) dueForRotation(n int64) bool {
+	if s.opts.MaxSize > 0 && s.size > 0 && s.size+n > s.opts.MaxSize {
+		return true
+	}
+	if every := s.opts.RotateEvery; every > 0 && s.size > 0 {
+		return !s.now().UTC().Truncate(every).Equal(s.oldest.UTC().Truncate(every))
+	}
+	return false
+}
+
+// rotate renames the current file to a timestamped backup and opens a new
+// one. s.mu must be held.
+func (s *FileSink) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	now := s.now()
+	backup := s.path + "." + now.UTC().Format(backupTimeFormat)
+	// #nosec G703 -- Log destination comes from deployment config.
+	if err := os.Rename(s.path, backup); err != nil {
+		// Keep writing to the old file rather than losing entries.
+		return errors.Join(err, s.open())
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	s.cleanupWG.Add(1)
+	go func() {
+		defer s.cleanupWG.Done()
+		s.cleanup.Lock()
+		defer s.cleanup.Unlock()
+		if s.opts.Compress {
+			if err := compressFile(backup); err != nil {
+				log.Printf("compress %s failed: %v", backup, err)
+			}
+		}
+		if err := s.prune(now); err != nil {
+			log.Printf("prune rotated search logs failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Reopen closes the file and opens s.path again, for when an external
+// tool such as logrotate has moved it away.
+func (s *FileSink) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.closeFile()
+	return errors.Join(err, s.open())
+}
+
+// Purge deletes the rotated files last written before cutoff. It rotates
+// the current file first if it has entries from before cutoff, so with
+// RotateEvery set, entries outlive the cutoff by at most one period.
+func (s *FileSink) Purge(cutoff time.Time) error {
+	s.mu.Lock()
+	var err error
+	if s.f != nil && s.size > 0 && s.oldest.Before(cutoff) {
+		err = s.rotate()
+	}
+	s.mu.Unlock()
+
+	s.cleanup.Lock()
+	defer s.cleanup.Unlock()
+	files, listErr := s.backups()
+	if listErr != nil {
+		return errors.Join(err, listErr)
+	}
+	for _, f := range files {
+		if f.modTime.Before(cutoff) {
+			if rmErr := os.Remove(f.path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+				err = errors.Join(err, rmErr)
+			}
+		}
+	}
+	return err
+}
+
+// Close flushes and closes the file and waits for compression and
+// retention of rotated files to finish.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	err := s.closeFile()
+	s.mu.Unlock()
+	s.cleanupWG.Wait()
+	return err
+}
+
+// compressFile replaces path with path.gz.
+func compressFile(path string) (err error) {
+	// #nosec G304 -- Path is a rotated log file we created.
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	// #nosec G302,G304 -- Path is a rotated log file we created.
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(path + ".gz")
+		}
+	}()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// Keep the time of the last entry, which Purge goes by.
+	if info, err := in.Stat(); err == nil {
+		_ = os.Chtimes(path+".gz", info.ModTime(), info.ModTime())
+	}
+	return os.Remove(path)
+}
+
+type backupFile struct {
+	path string
+	// at is when the file was rotated, modTime when it was last written.
+	at      time.Time
+	modTime time.Time
+}
+
+// backups lists the rotated files of s.path, newest first. Files rotated
+// by other tools, such as searches.log.1, are left alone.
+func (s *FileSink) backups() ([]backupFile, error) {
+	dir, base := filepath.Split(s.path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []backupFile
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), base+".")
+		if !ok || e.IsDir() {
+			continue
+		}
+		at, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ".gz"))
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, backupFile{path: filepath.Join(dir, e.Name()), at: at, modTime: info.ModTime()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].at.After(out[j].at) })
+	return out, nil
+}
+
+// prune deletes the rotated files beyond MaxBackups or older than MaxAge as
+// of now. It runs off s.mu, so the caller reads the clock for it.
+func (s *FileSink) prune(now time.Time) error {
+	if s.opts.MaxBackups <= 0 && s.opts.MaxAge <= 0 {
+		return nil
+	}
+	files, err := s.backups()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	cutoff := now.Add(-s.opts.MaxAge)
+	for i, f := range files {
+		tooMany := s.opts.MaxBackups > 0 && i >= s.opts.MaxBackups
+		tooOld := s.opts.MaxAge > 0 && f.at.Before(cutoff)
+		if tooMany || tooOld {
+			if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,224 @@
+package searchlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestFileSink returns a FileSink in a temp dir whose clock is *now.
+func newTestFileSink(t *testing.T, opts FileOptions, now *time.Time) *FileSink {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "searches.log")
+	s, err := NewFileSink(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return *now }
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func countLines(t *testing.T, paths ...string) int {
+	t.Helper()
+	n := 0
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(p, ".gz") {
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = zr
+		}
+		if err := Decode(r, func(Entry) error { n++; return nil }); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+	}
+	return n
+}
+
+func TestFileSinkRotatesBySize(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	s := newTestFileSink(t, FileOptions{MaxSize: 200}, &now)
+
+	for range 10 {
+		now = now.Add(time.Second)
+		if err := s.Write([]Entry{{Time: now, Query: "golang", ResultCount: 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) < 2 {
+		t.Fatalf("expected several rotated files, got %d", len(backups))
+	}
+	paths := []string{s.path}
+	for _, b := range backups {
+		info, err := os.Stat(b.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s: expected at most 200 bytes, got %d", b.path, info.Size())
+		}
+		paths = append(paths, b.path)
+	}
+	if n := countLines(t, paths...); n != 10 {
+		t.Errorf("expected all 10 entries across the files, got %d", n)
+	}
+}
+
+func TestFileSinkRotatesByTimeAndCompresses(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 59, 0, 0, time.UTC)
+	s := newTestFileSink(t, FileOptions{RotateEvery: 24 * time.Hour, Compress: true}, &now)
+
+	if err := s.Write([]Entry{{Time: now, Query: "monday"}}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := s.Write([]Entry{{Time: now, Query: "tuesday"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || !strings.HasSuffix(backups[0].path, ".gz") {
+		t.Fatalf("expected one gzipped backup, got %+v", backups)
+	}
+	if countLines(t, backups[0].path) != 1 || countLines(t, s.path) != 1 {
+		t.Error("expected one entry in the backup and one in the new file")
+	}
+}
+
+func TestFileSinkRetention(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	s := newTestFileSink(t, FileOptions{MaxSize: 1, MaxBackups: 2, MaxAge: 10 * 24 * time.Hour}, &now)
+
+	// A file rotated by another tool is left alone.
+	other := s.path + ".1"
+	if err := os.WriteFile(other, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 5 {
+		now = now.Add(time.Hour)
+		if err := s.Write([]Entry{{Time: now, Query: "go"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.cleanupWG.Wait()
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups to be kept, got %d", len(backups))
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("expected %s to be kept: %v", other, err)
+	}
+
+	// Everything rotated so far is now too old.
+	now = now.Add(30 * 24 * time.Hour)
+	if err := s.Write([]Entry{{Time: now, Query: "go"}}); err != nil {
+		t.Fatal(err)
+	}
+	s.cleanupWG.Wait()
+	if backups, _ = s.backups(); len(backups) != 1 {
+		t.Errorf("expected only the newest backup to survive MaxAge, got %d", len(backups))
+	}
+}
+
+func TestFileSinkReopenWhileWriting(t *testing.T) {
+	now := time.Now()
+	s := newTestFileSink(t, FileOptions{}, &now)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 200 {
+			if err := s.Write([]Entry{{Time: now, Query: "go"}}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	moved := s.path + ".moved"
+	if err := os.Rename(s.path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countLines(t, moved, s.path); n != 200 {
+		t.Errorf("expected 200 entries across the moved and reopened file, got %d", n)
+	}
+}
+
+func TestFileSinkPurge(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	s := newTestFileSink(t, FileOptions{MaxSize: 1}, &now)
+
+	for range 3 {
+		now = now.Add(time.Hour)
+		if err := s.Write([]Entry{{Time: now, Query: "go"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.cleanupWG.Wait()
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %d", len(backups))
+	}
+	// Make the older backup look like it was last written 100 days ago.
+	old := time.Now().Add(-100 * 24 * time.Hour)
+	if err := os.Chtimes(backups[1].path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// The current file was started before the cutoff, so it's rotated
+	// too, though its backup isn't old enough to go yet.
+	now = now.Add(100 * 24 * time.Hour)
+	if err := s.Purge(time.Now().Add(-90 * 24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	s.cleanupWG.Wait()
+	if backups, _ = s.backups(); len(backups) != 2 {
+		t.Fatalf("expected the old backup to be purged and the current file rotated, got %d backups", len(backups))
+	}
+	if info, err := os.Stat(s.path); err != nil || info.Size() != 0 {
+		t.Errorf("expected a fresh, empty log file, got %v, %v", info, err)
+	}
+}
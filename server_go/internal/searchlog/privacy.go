@@ -0,0 +1,83 @@
+package searchlog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A RedactRule replaces matches of Pattern in logged queries with
+// Replacement.
+type RedactRule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Built-in redaction rules, by name. Phone numbers are matched before long
+// digit strings, so "+45 12 34 56 78" becomes "[phone]" rather than a mix.
+var redactRules = map[string]RedactRule{
+	"email":  {"email", regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[email]"},
+	"phone":  {"phone", regexp.MustCompile(`(?:\+|\b)\d(?:[ ().\-]?\d){7,14}\b`), "[phone]"},
+	"digits": {"digits", regexp.MustCompile(`\d{6,}`), "[number]"},
+}
+
+// DefaultRedact names the rules used when none are configured.
+const DefaultRedact = "email,phone,digits"
+
+// Privacy is applied to every entry before it reaches any sink.
+type Privacy struct {
+	Redact []RedactRule
+	// HashKey, when set, replaces the query with a keyed hash of it, so
+	// repeated searches can be counted without storing what was searched.
+	HashKey []byte
+}
+
+// ParsePrivacy builds a Privacy from the comma-separated names of built-in
+// redaction rules ("email", "phone", "digits" or "none"), an optional
+// extra regular expression whose matches become "[redacted]", and an
+// optional hash key.
+func ParsePrivacy(redact, pattern, hashKey string) (Privacy, error) {
+	var p Privacy
+	for _, name := range strings.Split(redact, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "none" {
+			continue
+		}
+		rule, ok := redactRules[name]
+		if !ok {
+			return p, fmt.Errorf("unknown redaction rule %q (want email, phone, digits or none)", name)
+		}
+		p.Redact = append(p.Redact, rule)
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return p, fmt.Errorf("invalid redaction pattern: %w", err)
+		}
+		p.Redact = append(p.Redact, RedactRule{"custom", re, "[redacted]"})
+	}
+	if hashKey != "" {
+		p.HashKey = []byte(hashKey)
+	}
+	return p, nil
+}
+
+// Apply redacts e's query and, with a hash key, swaps it for its hash.
+// The hash is taken of the redacted query in lower case without
+// surrounding spaces, so it groups searches the way the analytics do.
+func (p Privacy) Apply(e Entry) Entry {
+	for _, r := range p.Redact {
+		e.Query = r.Pattern.ReplaceAllString(e.Query, r.Replacement)
+	}
+	if len(p.HashKey) > 0 {
+		mac := hmac.New(sha256.New, p.HashKey)
+		mac.Write([]byte(strings.ToLower(strings.TrimSpace(e.Query))))
+		e.QueryHash = hex.EncodeToString(mac.Sum(nil)[:16])
+		e.Query = ""
+	}
+	return e
+}
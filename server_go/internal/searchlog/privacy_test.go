@@ -0,0 +1,66 @@
+package searchlog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrivacyRedacts(t *testing.T) {
+	p, err := ParsePrivacy(DefaultRedact, `(?i)cpr`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"mail alice@example.com about go": "mail [email] about go",
+		"call +45 12 34 56 78 now":        "call [phone] now",
+		"card 4111111111111111":           "card [number]",
+		"account 1234567":                 "account [number]",
+		"CPR golang 2026":                 "[redacted] golang 2026",
+		"python 3.12":                     "python 3.12",
+	}
+	for in, want := range cases {
+		if got := p.Apply(Entry{Query: in}).Query; got != want {
+			t.Errorf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestPrivacyHashesQuery(t *testing.T) {
+	p, err := ParsePrivacy("email", "", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := p.Apply(Entry{Query: " Go Tutorial "})
+	b := p.Apply(Entry{Query: "go tutorial"})
+	if a.Query != "" || len(a.QueryHash) != 32 {
+		t.Fatalf("expected only a hash, got %+v", a)
+	}
+	if a.QueryHash != b.QueryHash {
+		t.Error("expected the same hash for queries that differ in case and spaces")
+	}
+
+	// Redaction happens before hashing, so every address counts as one.
+	c := p.Apply(Entry{Query: "alice@example.com"})
+	d := p.Apply(Entry{Query: "bob@example.org"})
+	if c.QueryHash != d.QueryHash {
+		t.Error("expected redacted queries to hash alike")
+	}
+
+	other, _ := ParsePrivacy("", "", "other key")
+	if other.Apply(Entry{Query: "go tutorial"}).QueryHash == b.QueryHash {
+		t.Error("expected the hash to depend on the key")
+	}
+}
+
+func TestParsePrivacyRejectsBadConfig(t *testing.T) {
+	if _, err := ParsePrivacy("email,ssn", "", ""); err == nil || !strings.Contains(err.Error(), "ssn") {
+		t.Errorf("expected an unknown rule error, got %v", err)
+	}
+	if _, err := ParsePrivacy("none", "(", ""); err == nil {
+		t.Error("expected an invalid pattern error")
+	}
+	p, err := ParsePrivacy("none", "", "")
+	if err != nil || len(p.Redact) != 0 {
+		t.Errorf("expected no rules, got %+v, %v", p, err)
+	}
+}
@@ -1,57 +1,208 @@
+// Package searchlog records the searches made on the site. A Logger queues
+// entries and writes them in the background to one or more sinks, such as
+// a JSONL file or the search_log table.
 package searchlog
 
 import (
+	"bufio"
 	"encoding/json"
-	"os"
-	"path/filepath"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"strings"
 	"sync"
 	"time"
-)
 
-const defaultLogPath = "searches.log"
+	"whoknows_variations/server_go/internal/metrics"
+)
 
-var mu sync.Mutex
+const (
+	// DefaultQueueSize is the number of entries a Logger holds before it
+	// starts dropping them.
+	DefaultQueueSize = 1024
+	// maxBatch caps the entries handed to a sink in one Write.
+	maxBatch = 256
+)
 
-type entry struct {
-	Timestamp   string `json:"timestamp"`
-	Query       string `json:"query"`
+// Entry is one search, and one line of the JSONL search log.
+type Entry struct {
+	Time  time.Time `json:"timestamp"`
+	Query string    `json:"query"`
+	// QueryHash replaces Query when the Logger's Privacy has a hash key.
+	QueryHash   string `json:"query_hash,omitempty"`
 	Language    string `json:"language,omitempty"`
 	ResultCount int    `json:"result_count"`
 }
 
-func LogSearch(query string, language *string, resultCount int) error {
-	path := os.Getenv("WHOKNOWS_SEARCH_LOG_PATH")
-	if path == "" {
-		path = defaultLogPath
+// A Sink stores search log entries. A Logger calls Write from a single
+// goroutine, so sinks don't need to lock.
+type Sink interface {
+	Write(entries []Entry) error
+	Close() error
+}
+
+// Logger writes entries to its sinks asynchronously. Log never blocks the
+// request: when the queue is full, the entry is dropped and counted in the
+// whoknows_search_log_dropped_total metric.
+type Logger struct {
+	sinks   []Sink
+	privacy Privacy
+	queue   chan Entry
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Options configures a Logger.
+type Options struct {
+	// QueueSize is the number of entries held before new ones are
+	// dropped; zero means DefaultQueueSize.
+	QueueSize int
+	Privacy   Privacy
+}
+
+// New starts a Logger that writes to sinks.
+func New(opts Options, sinks ...Sink) *Logger {
+	queueSize := opts.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	l := &Logger{
+		sinks:   sinks,
+		privacy: opts.Privacy,
+		queue:   make(chan Entry, queueSize),
+		done:    make(chan struct{}),
 	}
+	go l.run()
+	return l
+}
 
-	dir := filepath.Dir(path)
-	if dir != "" && dir != "." {
-		// #nosec G301,G703 -- Log destination comes from deployment config and must be allowed outside the repo.
-		if err := os.MkdirAll(dir, 0o750); err != nil {
-			return err
-		}
+// Log queues e after applying the Logger's Privacy. A zero Time means now,
+// and the language is trimmed.
+func (l *Logger) Log(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
 	}
+	e.Time = e.Time.UTC()
+	e.Language = strings.TrimSpace(e.Language)
+	e = l.privacy.Apply(e)
 
-	record := entry{
-		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
-		Query:       query,
-		ResultCount: resultCount,
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		metrics.ObserveSearchLogDropped("closed", 1)
+		return
 	}
-	if language != nil {
-		record.Language = strings.TrimSpace(*language)
+	select {
+	case l.queue <- e:
+	default:
+		metrics.ObserveSearchLogDropped("queue_full", 1)
+	}
+}
+
+// Close writes the queued entries and closes the sinks. Entries logged
+// after Close are dropped.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
 	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
 
-	mu.Lock()
-	defer mu.Unlock()
+	<-l.done
+	var errs []error
+	for _, s := range l.sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
 
-	// #nosec G302,G304,G703 -- Log destination comes from deployment config and is intentionally variable.
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
-	if err != nil {
-		return err
+// Reopen reopens the sinks that write to a file, after an external tool
+// such as logrotate has moved it away. It is safe to call while entries
+// are being written.
+func (l *Logger) Reopen() error {
+	var errs []error
+	for _, s := range l.sinks {
+		if r, ok := s.(interface{ Reopen() error }); ok {
+			errs = append(errs, r.Reopen())
+		}
 	}
-	defer func() { _ = f.Close() }()
+	return errors.Join(errs...)
+}
 
-	return json.NewEncoder(f).Encode(record)
+// Purge deletes what the sinks have stored from before cutoff, where they
+// can: the search_log table and rotated log files. Entries sent to stdout
+// or syslog are out of our hands.
+func (l *Logger) Purge(cutoff time.Time) error {
+	var errs []error
+	for _, s := range l.sinks {
+		if p, ok := s.(interface{ Purge(time.Time) error }); ok {
+			errs = append(errs, p.Purge(cutoff))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+
+	batch := make([]Entry, 0, maxBatch)
+	for e := range l.queue {
+		batch = append(batch[:0], e)
+	fill:
+		for len(batch) < maxBatch {
+			select {
+			case e, ok := <-l.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+
+		for _, s := range l.sinks {
+			if err := s.Write(batch); err != nil {
+				log.Printf("search log write failed: %v", err)
+				metrics.ObserveSearchLogDropped("write_failed", len(batch))
+			}
+		}
+	}
+}
+
+// writeJSONL writes entries to w, one JSON object per line.
+func writeJSONL(w io.Writer, entries []Entry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads a search log and calls fn for each entry, stopping at the
+// first error.
+func Decode(r io.Reader, fn func(Entry) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return sc.Err()
 }
@@ -0,0 +1,127 @@
+package searchlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink records what it's given. block, when set, holds up Write
+// until it's closed.
+type memorySink struct {
+	mu      sync.Mutex
+	entries []Entry
+	block   chan struct{}
+	closed  bool
+}
+
+func (s *memorySink) Write(entries []Entry) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestLoggerWritesToEverySink(t *testing.T) {
+	a, b := &memorySink{}, &memorySink{}
+	l := New(Options{QueueSize: 10}, a, b)
+	l.Log(Entry{Query: "go", Language: " en ", ResultCount: 3})
+	l.Log(Entry{Query: "rust"})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []*memorySink{a, b} {
+		if len(s.entries) != 2 || s.entries[0].Query != "go" || s.entries[1].Query != "rust" {
+			t.Fatalf("unexpected entries %+v", s.entries)
+		}
+		if s.entries[0].Language != "en" || s.entries[0].Time.IsZero() {
+			t.Errorf("expected a trimmed language and a time, got %+v", s.entries[0])
+		}
+		if !s.closed {
+			t.Error("expected Close to close the sinks")
+		}
+	}
+}
+
+func TestLoggerDropsWhenQueueIsFull(t *testing.T) {
+	sink := &memorySink{block: make(chan struct{})}
+	l := New(Options{QueueSize: 2}, sink)
+
+	// The first entry may be taken off the queue by the writer, which then
+	// blocks; after that the queue holds two more.
+	for range 10 {
+		l.Log(Entry{Query: "go"})
+	}
+	close(sink.block)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sink.entries); n < 2 || n > 3 {
+		t.Errorf("expected 2 or 3 entries to get through, got %d", n)
+	}
+
+	l.Log(Entry{Query: "after close"})
+	if n := len(sink.entries); n > 3 {
+		t.Errorf("expected entries logged after Close to be dropped, got %d", n)
+	}
+}
+
+func TestFileSinkRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "searches.log")
+	sink, err := NewFileSink(path, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	if err := sink.Write([]Entry{{Time: at, Query: "go", Language: "en", ResultCount: 2}, {Time: at, Query: "rust"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Entry
+	if err := Decode(bytes.NewReader(data), func(e Entry) error { got = append(got, e); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Query != "go" || !got[0].Time.Equal(at) || got[0].ResultCount != 2 {
+		t.Errorf("unexpected entries %+v", got)
+	}
+}
+
+func TestDecodeReportsLine(t *testing.T) {
+	in := `{"timestamp":"2026-03-01T10:00:00Z","query":"go","result_count":1}` + "\n\nnot json\n"
+	err := Decode(bytes.NewBufferString(in), func(Entry) error { return nil })
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("expected an error on line 3, got %v", err)
+	}
+}
+
+func TestLoggerAppliesPrivacy(t *testing.T) {
+	sink := &memorySink{}
+	l := New(Options{Privacy: Privacy{Redact: []RedactRule{redactRules["email"]}}}, sink)
+	l.Log(Entry{Query: "mail alice@example.com"})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.entries) != 1 || sink.entries[0].Query != "mail [email]" {
+		t.Errorf("expected a redacted query, got %+v", sink.entries)
+	}
+}
@@ -0,0 +1,65 @@
+package searchlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/db"
+)
+
+// WriterSink writes entries as JSON lines to an io.Writer, such as stdout
+// for a log collector. Close doesn't close the writer.
+type WriterSink struct {
+	W io.Writer
+}
+
+func (s WriterSink) Write(entries []Entry) error {
+	return writeJSONL(s.W, entries)
+}
+
+func (s WriterSink) Close() error { return nil }
+
+// PostgresSink stores entries in the search_log table, which the admin
+// analytics read from.
+type PostgresSink struct {
+	DB *pgxpool.Pool
+	// Timeout bounds each batch insert; zero means 5 seconds.
+	Timeout time.Duration
+}
+
+func (s PostgresSink) Write(entries []Entry) error {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	rows := make([]db.SearchLogRow, len(entries))
+	for i, e := range entries {
+		rows[i] = db.SearchLogRow{SearchedAt: e.Time, Query: e.Query, QueryHash: e.QueryHash, Language: e.Language, ResultCount: e.ResultCount}
+	}
+	if err := db.RecordSearchLogs(ctx, s.DB, rows); err != nil {
+		return fmt.Errorf("search_log: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes the searches made before cutoff.
+func (s PostgresSink) Purge(cutoff time.Time) error {
+	n, err := db.DeleteSearchLogBefore(context.Background(), s.DB, cutoff)
+	if err != nil {
+		return fmt.Errorf("search_log: %w", err)
+	}
+	if n > 0 {
+		log.Printf("purged %d searches from before %s", n, cutoff.Format(time.DateOnly))
+	}
+	return nil
+}
+
+func (s PostgresSink) Close() error { return nil }
@@ -0,0 +1,79 @@
+package sessionstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// InsecureDefaultSecret is the signing key used when none is configured. The
+// server only accepts it in dev mode.
+const InsecureDefaultSecret = "default-secret-change-me"
+
+// Keys are the session cookie keys, current key first. New cookies are
+// signed with Signing[0] and encrypted with Encryption[0]; the other keys
+// only read cookies issued before a rotation. Encryption[i] pairs with
+// Signing[i], and a missing or empty one means that pair doesn't encrypt.
+type Keys struct {
+	Signing    [][]byte
+	Encryption [][]byte
+}
+
+// ParseKeys reads comma-separated signing and encryption key lists, as in
+// WHOKNOWS_SECRET_KEYS and WHOKNOWS_ENCRYPTION_KEYS. Encryption keys must
+// be 16, 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+func ParseKeys(signing, encryption string) (Keys, error) {
+	var k Keys
+	for _, s := range strings.Split(signing, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return Keys{}, errors.New("signing keys must not be empty")
+		}
+		k.Signing = append(k.Signing, []byte(s))
+	}
+
+	if strings.TrimSpace(encryption) == "" {
+		return k, nil
+	}
+	parts := strings.Split(encryption, ",")
+	if len(parts) > len(k.Signing) {
+		return Keys{}, fmt.Errorf("%d encryption keys but only %d signing keys", len(parts), len(k.Signing))
+	}
+	for i, s := range parts {
+		s = strings.TrimSpace(s)
+		switch len(s) {
+		case 0:
+			k.Encryption = append(k.Encryption, nil)
+		case 16, 24, 32:
+			k.Encryption = append(k.Encryption, []byte(s))
+		default:
+			return Keys{}, fmt.Errorf("encryption key %d is %d bytes, want 16, 24 or 32", i+1, len(s))
+		}
+	}
+	return k, nil
+}
+
+// Pairs returns the keys in the hash key, block key order expected by New
+// and securecookie.CodecsFromPairs.
+func (k Keys) Pairs() [][]byte {
+	pairs := make([][]byte, 0, 2*len(k.Signing))
+	for i, s := range k.Signing {
+		var block []byte
+		if i < len(k.Encryption) {
+			block = k.Encryption[i]
+		}
+		pairs = append(pairs, s, block)
+	}
+	return pairs
+}
+
+// UsesDefault reports whether the insecure default secret is among the
+// signing keys.
+func (k Keys) UsesDefault() bool {
+	for _, s := range k.Signing {
+		if string(s) == InsecureDefaultSecret {
+			return true
+		}
+	}
+	return false
+}
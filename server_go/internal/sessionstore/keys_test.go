@@ -0,0 +1,91 @@
+package sessionstore
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/securecookie"
+)
+
+func TestParseKeys(t *testing.T) {
+	k, err := ParseKeys("new-signing, old-signing", strings.Repeat("n", 32)+",")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.Signing) != 2 || string(k.Signing[1]) != "old-signing" {
+		t.Errorf("unexpected signing keys %q", k.Signing)
+	}
+	pairs := k.Pairs()
+	if len(pairs) != 4 || len(pairs[1]) != 32 || pairs[3] != nil {
+		t.Errorf("unexpected pairs %q", pairs)
+	}
+	if k.UsesDefault() {
+		t.Error("expected UsesDefault to be false")
+	}
+
+	for _, c := range []struct{ signing, encryption string }{
+		{"", ""},
+		{"a,,b", ""},
+		{"a", "too-short"},
+		{"a", strings.Repeat("x", 16) + "," + strings.Repeat("y", 16)},
+	} {
+		if _, err := ParseKeys(c.signing, c.encryption); err == nil {
+			t.Errorf("ParseKeys(%q, %q): expected an error", c.signing, c.encryption)
+		}
+	}
+
+	k, err = ParseKeys("next,"+InsecureDefaultSecret, "")
+	if err != nil || !k.UsesDefault() {
+		t.Errorf("expected the default secret to be detected, got %v", err)
+	}
+}
+
+// A cookie issued before a rotation still decodes once the new key pair is
+// in front, and new cookies no longer decode with the old keys alone.
+func TestRotatedKeysReadOldCookies(t *testing.T) {
+	old, err := ParseKeys("old-signing", strings.Repeat("o", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := ParseKeys("new-signing,old-signing", strings.Repeat("n", 32)+","+strings.Repeat("o", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCodecs := securecookie.CodecsFromPairs(old.Pairs()...)
+	rotatedCodecs := securecookie.CodecsFromPairs(rotated.Pairs()...)
+
+	encoded, err := securecookie.EncodeMulti("session", "token", oldCodecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := securecookie.DecodeMulti("session", encoded, &got, rotatedCodecs...); err != nil || got != "token" {
+		t.Fatalf("expected the old cookie to decode after rotation, got %q, %v", got, err)
+	}
+
+	encoded, err = securecookie.EncodeMulti("session", "token", rotatedCodecs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := securecookie.DecodeMulti("session", encoded, &got, oldCodecs...); err == nil {
+		t.Error("expected a cookie from the new key not to decode with the old key")
+	}
+}
+
+// A deploy copied from the example env file must start.
+func TestDeployExampleKeysParse(t *testing.T) {
+	data, err := os.ReadFile("../../deploy/env.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(line, "#") {
+			env[k] = v
+		}
+	}
+	if _, err := ParseKeys(env["WHOKNOWS_SECRET_KEYS"], env["WHOKNOWS_ENCRYPTION_KEYS"]); err != nil {
+		t.Errorf("deploy/env.example keys don't parse: %v", err)
+	}
+}
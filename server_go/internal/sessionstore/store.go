@@ -0,0 +1,196 @@
+// Package sessionstore implements a gorilla sessions.Store backed by the
+// Postgres sessions table. The cookie only carries a signed random token;
+// session values, expiry and metadata live server-side so sessions can be
+// listed and revoked.
+package sessionstore
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"whoknows_variations/server_go/internal/auth"
+	"whoknows_variations/server_go/internal/db"
+)
+
+// touchInterval limits how often a session's last_seen_at is written, so an
+// active user doesn't cause a write on every request.
+const touchInterval = time.Minute
+
+const maxUserAgentLen = 512
+
+type Store struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // default configuration
+
+	db         *pgxpool.Pool
+	serializer securecookie.GobEncoder
+}
+
+// New returns a Store using pool for storage and keyPairs to sign and
+// optionally encrypt the session cookie. See Keys.Pairs and
+// sessions.NewCookieStore for the key pair format.
+//
+// The cookie is Secure by default. Clear Options.Secure for sites served
+// over plain HTTP, or browsers won't send it back.
+func New(pool *pgxpool.Pool, keyPairs ...[]byte) *Store {
+	s := &Store{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   86400 * 30,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		db: pool,
+	}
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// HashID maps the token stored in the cookie (session.ID) to the key of the
+// sessions table. Only the hash is stored, so a database leak doesn't leak
+// usable session cookies.
+func HashID(token string) string {
+	return auth.HashToken(token)
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the
+// registry. A missing, expired or revoked session yields a fresh one.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+	var token string
+	if err := securecookie.DecodeMulti(name, c.Value, &token, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	row, err := db.GetSession(r.Context(), s.db, HashID(token))
+	if errors.Is(err, db.ErrSessionNotFound) {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := s.serializer.Deserialize(row.Data, &session.Values); err != nil {
+		return session, err
+	}
+
+	session.ID = token
+	session.IsNew = false
+	if time.Since(row.LastSeenAt) > touchInterval {
+		if err := db.TouchSession(r.Context(), s.db, row.ID); err != nil {
+			log.Printf("session touch failed: %v", err)
+		}
+	}
+	return session, nil
+}
+
+// Save persists the session and writes the cookie. A session with
+// Options.MaxAge <= 0 is deleted from the database and the cookie cleared.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := db.DeleteSession(r.Context(), s.db, HashID(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(
+			securecookie.GenerateRandomKey(32))
+	}
+
+	data, err := s.serializer.Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+
+	row := db.SessionRow{
+		ID:        HashID(session.ID),
+		Data:      data,
+		UserAgent: truncate(r.UserAgent(), maxUserAgentLen),
+		ExpiresAt: time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+	if uid, ok := session.Values["user_id"].(int64); ok {
+		row.UserID = &uid
+	}
+	if err := db.SaveSession(r.Context(), s.db, row); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// MaxAge sets the maximum age for the store and the underlying cookie
+// implementation. Individual sessions can be deleted by setting
+// Options.MaxAge = -1 for that session.
+func (s *Store) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// Sweep deletes expired sessions every interval until ctx is cancelled.
+// It's safe to run in both the blue and green container at once.
+func (s *Store) Sweep(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := db.DeleteExpiredSessions(ctx, s.db)
+		if err != nil {
+			log.Printf("session sweep failed: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("session sweep removed %d expired sessions", n)
+		}
+	}
+}
+
+// truncate cuts s to at most n bytes without leaving a partial UTF-8
+// sequence, which Postgres would reject.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE languages (
+    code TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    text_search_config REGCONFIG NOT NULL DEFAULT 'simple',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+INSERT INTO languages (code, name, text_search_config) VALUES
+    ('en', 'English', 'english'),
+    ('da', 'Dansk', 'danish');
+
+ALTER TABLE pages DROP CONSTRAINT pages_language_check;
+ALTER TABLE pages
+    ADD CONSTRAINT pages_language_fkey
+    FOREIGN KEY (language) REFERENCES languages (code) ON UPDATE CASCADE;
+
+-- +goose Down
+ALTER TABLE pages DROP CONSTRAINT pages_language_fkey;
+ALTER TABLE pages ADD CONSTRAINT pages_language_check CHECK (language IN ('en', 'da'));
+DROP TABLE languages;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE tags (
+    id BIGSERIAL PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE page_tags (
+    page_title TEXT NOT NULL REFERENCES pages (title) ON UPDATE CASCADE ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (page_title, tag_id)
+);
+
+CREATE INDEX page_tags_tag_id_idx ON page_tags (tag_id);
+
+-- +goose Down
+DROP TABLE page_tags;
+DROP TABLE tags;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Accounts created before verification existed are trusted as-is, so turning
+-- on WHOKNOWS_EMAIL_VERIFICATION doesn't lock them out.
+UPDATE users SET email_verified_at = now();
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN email_verified_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- One row per throttled key: scope is 'ip' or 'account' (lowercased
+-- username, whether or not the user exists).
+CREATE TABLE login_throttles (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ,
+    PRIMARY KEY (scope, key)
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
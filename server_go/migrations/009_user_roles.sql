@@ -0,0 +1,9 @@
+-- +goose Up
+-- Roles are ordered: editors can do everything users can, admins everything
+-- editors can.
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+        CONSTRAINT users_role_check CHECK (role IN ('user', 'editor', 'admin'));
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Audit trail of authentication events. user_id is kept when known, and
+-- username as entered so failed logins for unknown names show up too.
+-- Events outlive deleted users (user_id becomes NULL) until the retention
+-- sweep removes them.
+CREATE TABLE auth_events (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    type TEXT NOT NULL,
+    user_id BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    username TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX auth_events_occurred_at_idx ON auth_events (occurred_at);
+CREATE INDEX auth_events_username_idx ON auth_events (lower(username), occurred_at);
+
+-- +goose Down
+DROP TABLE auth_events;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Per-user search history. Users can turn it off with
+-- search_history_enabled; their rows go with the account.
+ALTER TABLE users ADD COLUMN search_history_enabled BOOLEAN NOT NULL DEFAULT true;
+
+CREATE TABLE search_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    query TEXT NOT NULL,
+    language TEXT NOT NULL DEFAULT '',
+    result_count INTEGER NOT NULL DEFAULT 0,
+    searched_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX search_history_user_idx ON search_history (user_id, id);
+
+-- +goose Down
+DROP TABLE search_history;
+ALTER TABLE users DROP COLUMN search_history_enabled;
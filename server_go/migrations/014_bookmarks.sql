@@ -0,0 +1,14 @@
+-- +goose Up
+-- Pages users starred. There is deliberately no foreign key to pages:
+-- re-importing or removing a page must not silently drop bookmarks, so the
+-- URL is kept and the page is looked up when bookmarks are listed.
+CREATE TABLE bookmarks (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    page_title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, page_title)
+);
+
+-- +goose Down
+DROP TABLE bookmarks;
@@ -0,0 +1,44 @@
+-- +goose Up
+-- Saved searches are re-run on a schedule and the user is told about pages
+-- that are new or updated since the last run. last_checked_at is NULL until
+-- the first run, which only records what already matches.
+CREATE TABLE saved_searches (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    query TEXT NOT NULL,
+    language TEXT NOT NULL DEFAULT '',
+    notify TEXT NOT NULL DEFAULT 'email' CHECK (notify IN ('none', 'email', 'webhook')),
+    webhook_url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_checked_at TIMESTAMPTZ,
+    UNIQUE (user_id, query, language)
+);
+
+CREATE INDEX saved_searches_last_checked_at_idx ON saved_searches (last_checked_at NULLS FIRST);
+
+-- Pages a saved search has matched, with the version that was seen.
+CREATE TABLE saved_search_seen (
+    saved_search_id BIGINT NOT NULL REFERENCES saved_searches (id) ON DELETE CASCADE,
+    page_title TEXT NOT NULL,
+    last_updated TIMESTAMPTZ,
+    PRIMARY KEY (saved_search_id, page_title)
+);
+
+-- In-app notifications. They outlive the saved search that raised them.
+CREATE TABLE notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    saved_search_id BIGINT REFERENCES saved_searches (id) ON DELETE SET NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    read_at TIMESTAMPTZ
+);
+
+CREATE INDEX notifications_user_idx ON notifications (user_id, id);
+
+-- +goose Down
+DROP TABLE notifications;
+DROP TABLE saved_search_seen;
+DROP TABLE saved_searches;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Per-user search and display preferences. Users without a row get the
+-- defaults, or what their preferences cookie says.
+CREATE TABLE user_preferences (
+    user_id BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    search_language TEXT NOT NULL DEFAULT '',
+    page_size INTEGER NOT NULL DEFAULT 30 CHECK (page_size BETWEEN 1 AND 100),
+    show_snippets BOOLEAN NOT NULL DEFAULT false,
+    ui_language TEXT NOT NULL DEFAULT 'en',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE user_preferences;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Every search made on the site, for the admin analytics. Unlike
+-- search_history it isn't tied to a user.
+CREATE TABLE search_log (
+    id BIGSERIAL PRIMARY KEY,
+    searched_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    query TEXT NOT NULL,
+    language TEXT NOT NULL DEFAULT '',
+    result_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX search_log_searched_at_idx ON search_log (searched_at);
+
+-- +goose Down
+DROP TABLE search_log;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- With WHOKNOWS_SEARCH_LOG_HASH_KEY set, searches are logged as a keyed
+-- hash of the query instead of the query itself.
+ALTER TABLE search_log ADD COLUMN query_hash TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE search_log DROP COLUMN query_hash;
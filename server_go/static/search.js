@@ -1,7 +1,9 @@
 let searchInput;
+let languageSelect;
 
   document.addEventListener('DOMContentLoaded', () => {
     searchInput = document.getElementById("search-input");
+    languageSelect = document.getElementById("language-select");
 
     // Focus the input field
     searchInput.focus();
@@ -12,11 +14,46 @@ let searchInput;
           makeSearchRequest();
         }
     });
+
+    loadLanguages();
   });
 
+  // Fill the language picker from the enabled languages on the server and
+  // preselect the one in the current URL, else the preferred one.
+  async function loadLanguages() {
+    if (!languageSelect) {
+      return;
+    }
+    const current = new URL(window.location.href).searchParams.get('language') || languageSelect.dataset.language || '';
+
+    const anyOption = document.createElement('option');
+    anyOption.value = '';
+    anyOption.textContent = 'Default language';
+    languageSelect.appendChild(anyOption);
+
+    try {
+      const response = await fetch('/api/languages');
+      const body = await response.json();
+      for (const language of body.data) {
+        const option = document.createElement('option');
+        option.value = language.code;
+        option.textContent = language.name;
+        option.selected = language.code === current;
+        languageSelect.appendChild(option);
+      }
+    } catch (err) {
+      languageSelect.hidden = true;
+    }
+  }
+
   function makeSearchRequest() {
     const query = searchInput.value;
     const url = new URL(window.location.href);
     url.searchParams.set('q', query);
+    if (languageSelect && languageSelect.value) {
+      url.searchParams.set('language', languageSelect.value);
+    } else {
+      url.searchParams.delete('language');
+    }
     window.location.href = url.toString();
-  }
\ No newline at end of file
+  }